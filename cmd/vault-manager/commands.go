@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+)
+
+// version is the version of vault-manager, set when building with
+// -ldflags "-X main.version=<version>".
+var version = "dev"
+
+// command is an operation of vault-manager, with its own flags.
+type command struct {
+	name        string
+	summary     string
+	description string
+	// flags defines the flags of the command and returns the function running
+	// it once they are parsed.
+	flags func(fs *flag.FlagSet) func()
+}
+
+var commands = []command{
+	{
+		name:    "apply",
+		summary: "reconcile the Vault instance with the configuration (default)",
+		description: "Reconciles the Vault instance with the configuration read from CONFIG_FILE or the\n" +
+			"GraphQL server. Running vault-manager without a command is the same as running apply.",
+		flags: applyCommand,
+	},
+	{
+		name:    "plan",
+		summary: "show the changes apply would make, without making them",
+		description: "Logs the changes apply would make, without making them. With -out, they are written\n" +
+			"to a plan file that apply -plan makes exactly.",
+		flags: planCommand,
+	},
+	{
+		name:    "validate",
+		summary: "check the configuration without contacting Vault",
+		description: "Checks the configuration read from CONFIG_FILE or the GraphQL server without\n" +
+			"contacting Vault, reporting unknown top-levels and fields, values of the wrong type\n" +
+			"and missing required fields.",
+		flags: validateCommand,
+	},
+	{
+		name:    "export",
+		summary: "write the configuration of the Vault instance as YAML",
+		description: "Reads the configuration of the Vault instance and writes it to stdout as YAML, in\n" +
+			"the format of CONFIG_FILE. Entries built into Vault, such as the default policies,\n" +
+			"are left out.",
+		flags: exportCommand,
+	},
+	{
+		name:    "mirror",
+		summary: "reconcile a Vault instance with the configuration of another one",
+		description: "Reads the configuration of the -from instance, as export does, and reconciles the -to\n" +
+			"instance with it, so that a standby or regional instance is kept in lockstep with a\n" +
+			"primary one without exporting its configuration first.",
+		flags: mirrorCommand,
+	},
+	{
+		name:        "version",
+		summary:     "print the version of vault-manager",
+		description: "Prints the version of vault-manager.",
+		flags:       versionCommand,
+	},
+}
+
+// runCommand parses the flags of the named command and runs it.
+func runCommand(name string, args []string) {
+	if name == "help" {
+		help(args)
+		return
+	}
+
+	c, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(1)
+	}
+
+	fs, run := c.flagSet()
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %q\n\n", fs.Args())
+		fs.Usage()
+		os.Exit(1)
+	}
+	run()
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// flagSet returns the flags of the command, whose usage is its help.
+func (c command) flagSet() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("vault-manager "+c.name, flag.ExitOnError)
+	run := c.flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: vault-manager %s [flags]\n\n%s\n", c.name, c.description)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(os.Stderr, "\nFlags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs, run
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: vault-manager <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s%s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'vault-manager help <command>' for the flags of a command.\n")
+}
+
+// help prints the help of a command, or the list of commands.
+func help(args []string) {
+	if len(args) == 0 {
+		usage()
+		return
+	}
+
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage()
+		os.Exit(1)
+	}
+	fs, _ := c.flagSet()
+	fs.Usage()
+}
+
+// runFlags are the flags of the commands computing the changes of every
+// top-level.
+type runFlags struct {
+	target           string
+	adopt            string
+	preflight        bool
+	timeout          time.Duration
+	toplevelTimeout  time.Duration
+	output           string
+	detailedExitCode bool
+	only             string
+	skip             string
+	includePaths     string
+	excludePaths     string
+	namespaces       string
+	noPrune          string
+	protectedPaths   string
+	concurrency      int
+	rateLimit        float64
+	maxAttempts      int
+	retryBackoff     time.Duration
+	// confirm is only a flag of apply.
+	confirm bool
+}
+
+func (f *runFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.target, "target", "", "If set, explains how the entry with this key is reconciled without making changes")
+	fs.StringVar(&f.adopt, "adopt", "", "If set to review, existing entries differing from configuration are recorded as adoptable and left unchanged; confirm updates the recorded ones")
+	fs.BoolVar(&f.preflight, "preflight", false, "If true, checks that the token is authorized to perform every planned change before applying it")
+	fs.DurationVar(&f.timeout, "timeout", 0, "If set, cancels the run once it has lasted this long")
+	fs.DurationVar(&f.toplevelTimeout, "toplevel-timeout", 0, "If set, cancels the application of each top-level configuration once it has lasted this long")
+	fs.StringVar(&f.output, "output", "text", "If set to json, writes the changes of every top-level to stdout as a JSON document")
+	fs.BoolVar(&f.detailedExitCode, "detailed-exitcode", false, "If true, exits with 2 when the Vault instance differs from the configuration")
+	fs.StringVar(&f.only, "only", "", "If set, applies only these comma-separated top-levels")
+	fs.StringVar(&f.skip, "skip", "", "If set, doesn't apply these comma-separated top-levels")
+	fs.StringVar(&f.includePaths, "include-paths", "", "If set, only changes the Vault paths matching one of these comma-separated globs")
+	fs.StringVar(&f.excludePaths, "exclude-paths", "", "If set, never changes the Vault paths matching one of these comma-separated globs")
+	fs.StringVar(&f.namespaces, "namespaces", "", "If set, only reconciles the namespaces matching one of these comma-separated globs, * including the root namespace")
+	fs.StringVar(&f.noPrune, "no-prune", "", "If set, never deletes entries of these comma-separated top-levels, or of all of them if set to all")
+	fs.StringVar(&f.protectedPaths, "protected-paths", "", "If set, never deletes the entries whose path or name matches one of these comma-separated globs")
+	fs.IntVar(&f.concurrency, "concurrency", 1, "Changes up to this many independent entries of a top-level at once")
+	fs.Float64Var(&f.rateLimit, "rate-limit", 0, "If set, sends at most this many requests per second to Vault")
+	fs.IntVar(&f.maxAttempts, "max-attempts", 3, "Sends requests failing with a transient error up to this many times")
+	fs.DurationVar(&f.retryBackoff, "retry-backoff", time.Second, "Waits this long before retrying a request for the first time, twice as long after every attempt")
+}
+
+func applyCommand(fs *flag.FlagSet) func() {
+	var f runFlags
+	var dryRun bool
+	var planFile string
+	fs.BoolVar(&dryRun, "dry-run", false, "If true, will only print planned actions")
+	fs.StringVar(&planFile, "plan", "", "If set, makes exactly the changes of this plan file, failing if they differ")
+	fs.BoolVar(&f.confirm, "confirm", false, "If true, logs the changes to be made and asks for confirmation before making them")
+	f.register(fs)
+
+	return func() {
+		run(f, dryRun, "", planFile, getConfig)
+	}
+}
+
+func planCommand(fs *flag.FlagSet) func() {
+	var f runFlags
+	var planOut string
+	fs.StringVar(&planOut, "out", "", "If set, writes the planned changes to this file")
+	f.register(fs)
+
+	return func() {
+		run(f, true, planOut, "", getConfig)
+	}
+}
+
+func validateCommand(fs *flag.FlagSet) func() {
+	return func() {
+		cfg, err := getConfig(context.Background())
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to parse config")
+		}
+
+		valid := true
+		for _, c := range sortedConfigs(cfg) {
+			dataBytes, err := yaml.Marshal(cfg[c.Name])
+			if err != nil {
+				logrus.WithField("name", c.Name).Fatal("failed to remarshal configuration")
+			}
+			err = toplevel.Validate(c.Name, dataBytes)
+			if err == nil {
+				continue
+			}
+			valid = false
+			errs, ok := err.(toplevel.ValidationErrors)
+			if !ok {
+				errs = toplevel.ValidationErrors{err}
+			}
+			for _, err := range errs {
+				logrus.WithField("name", c.Name).Error(err)
+			}
+		}
+		if !valid {
+			os.Exit(1)
+		}
+		logrus.Info("configuration is valid")
+	}
+}
+
+func exportCommand(fs *flag.FlagSet) func() {
+	var toplevels, instance string
+	var timeout time.Duration
+	fs.StringVar(&toplevels, "toplevels", "", "If set, exports only these comma-separated top-levels instead of all of the supported ones")
+	fs.StringVar(&instance, "instance", "", "If set, exports the configuration of this instance instead of the default one")
+	fs.DurationVar(&timeout, "timeout", 0, "If set, cancels the export once it has lasted this long")
+
+	return func() {
+		names := toplevel.Exporters()
+		if toplevels != "" {
+			names = splitList(toplevels)
+		}
+
+		ctx, cancel := runContext(timeout)
+		defer cancel()
+
+		vault.SetInstance(instance)
+		cfg, err := exportConfig(ctx, names)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to export configuration")
+		}
+
+		b, err := yaml.Marshal(cfg)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to encode configuration")
+		}
+		os.Stdout.Write(b)
+	}
+}
+
+// exportConfig reads the configuration of the named top-levels from the
+// current instance.
+func exportConfig(ctx context.Context, names []string) (config, error) {
+	cfg := make(config, len(names))
+	for _, name := range names {
+		entries, err := toplevel.Export(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		cfg[name] = entries
+	}
+	return cfg, nil
+}
+
+func mirrorCommand(fs *flag.FlagSet) func() {
+	var f runFlags
+	var dryRun bool
+	var from, to string
+	fs.BoolVar(&dryRun, "dry-run", false, "If true, will only print planned actions")
+	fs.StringVar(&from, "from", "", "If set, mirrors the configuration of this instance instead of the default one")
+	fs.StringVar(&to, "to", "", "If set, reconciles this instance instead of the default one")
+	fs.BoolVar(&f.confirm, "confirm", false, "If true, logs the changes to be made and asks for confirmation before making them")
+	f.register(fs)
+
+	return func() {
+		if from == to {
+			logrus.WithField("instance", from).Fatal("-from and -to must be different instances")
+		}
+		// the exported entries don't carry an instance and are applied to -to
+		toplevel.SetDefaultInstance(to)
+		defer toplevel.SetDefaultInstance("")
+		run(f, dryRun, "", "", func(ctx context.Context) (config, error) {
+			return mirroredConfig(ctx, from)
+		})
+	}
+}
+
+// mirroredConfig reads the configuration of the top-levels that can be
+// exported from the instance from.
+func mirroredConfig(ctx context.Context, from string) (config, error) {
+	vault.SetInstance(from)
+	cfg, err := exportConfig(ctx, toplevel.Exporters())
+	vault.SetInstance("")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read configuration of instance %q", from)
+	}
+	return cfg, nil
+}
+
+func versionCommand(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Println("vault-manager", version)
+	}
+}
+
+// splitList splits a comma-separated list of names.
+func splitList(s string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -1,26 +1,75 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/base64"
-	"flag"
+	"fmt"
+	"github.com/app-sre/vault-manager/pkg/configfile"
+	"github.com/app-sre/vault-manager/pkg/cooldown"
+	"github.com/app-sre/vault-manager/pkg/tracing"
+	"github.com/app-sre/vault-manager/pkg/vault"
 	"github.com/app-sre/vault-manager/toplevel"
 	"github.com/machinebox/graphql"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"sort"
+	"strings"
+	"time"
 
 	// Register top-level configurations.
 	_ "github.com/app-sre/vault-manager/toplevel/audit"
 	_ "github.com/app-sre/vault-manager/toplevel/auth"
+	_ "github.com/app-sre/vault-manager/toplevel/aws"
+	_ "github.com/app-sre/vault-manager/toplevel/azure"
+	_ "github.com/app-sre/vault-manager/toplevel/cert"
+	_ "github.com/app-sre/vault-manager/toplevel/consul"
+	_ "github.com/app-sre/vault-manager/toplevel/database"
+	_ "github.com/app-sre/vault-manager/toplevel/gcp"
+	_ "github.com/app-sre/vault-manager/toplevel/generic"
+	_ "github.com/app-sre/vault-manager/toplevel/github"
+	_ "github.com/app-sre/vault-manager/toplevel/identity"
+	_ "github.com/app-sre/vault-manager/toplevel/kerberos"
+	_ "github.com/app-sre/vault-manager/toplevel/keymgmt"
+	_ "github.com/app-sre/vault-manager/toplevel/kmip"
+	_ "github.com/app-sre/vault-manager/toplevel/kubernetes"
+	_ "github.com/app-sre/vault-manager/toplevel/kv"
+	_ "github.com/app-sre/vault-manager/toplevel/ldap"
+	_ "github.com/app-sre/vault-manager/toplevel/license"
+	_ "github.com/app-sre/vault-manager/toplevel/mfa"
+	_ "github.com/app-sre/vault-manager/toplevel/namespace"
+	_ "github.com/app-sre/vault-manager/toplevel/nomad"
+	_ "github.com/app-sre/vault-manager/toplevel/oidc"
+	_ "github.com/app-sre/vault-manager/toplevel/okta"
+	_ "github.com/app-sre/vault-manager/toplevel/pki"
+	_ "github.com/app-sre/vault-manager/toplevel/plugin"
 	_ "github.com/app-sre/vault-manager/toplevel/policy"
+	_ "github.com/app-sre/vault-manager/toplevel/quota"
+	_ "github.com/app-sre/vault-manager/toplevel/rabbitmq"
+	_ "github.com/app-sre/vault-manager/toplevel/radius"
+	_ "github.com/app-sre/vault-manager/toplevel/raft"
+	_ "github.com/app-sre/vault-manager/toplevel/replication"
 	_ "github.com/app-sre/vault-manager/toplevel/role"
 	_ "github.com/app-sre/vault-manager/toplevel/secretsengine"
+	_ "github.com/app-sre/vault-manager/toplevel/ssh"
+	_ "github.com/app-sre/vault-manager/toplevel/sysconfig"
+	_ "github.com/app-sre/vault-manager/toplevel/terraform"
+	_ "github.com/app-sre/vault-manager/toplevel/token"
+	_ "github.com/app-sre/vault-manager/toplevel/totp"
+	_ "github.com/app-sre/vault-manager/toplevel/transform"
+	_ "github.com/app-sre/vault-manager/toplevel/transit"
+	_ "github.com/app-sre/vault-manager/toplevel/userpass"
 )
 
+// driftExitCode is the exit code of runs with -detailed-exitcode that found
+// changes. Errors exit with 1.
+const driftExitCode = 2
+
 type TopLevelConfig struct {
 	Name     string
 	Priority int
@@ -39,15 +88,162 @@ func (a ByPriority) Swap(i, j int) {
 }
 
 func main() {
-	var dryRun bool
-	flag.BoolVar(&dryRun, "dry-run", false, "If true, will only print planned actions")
-	flag.Parse()
+	name, args := "apply", os.Args[1:]
+	// without a command, flags are those of apply
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	runCommand(name, args)
+}
+
+// run reconciles the Vault instance with the configuration returned by load,
+// or only logs the changes to be made in dry-run mode.
+func run(f runFlags, dryRun bool, planOut, planFile string, load func(context.Context) (config, error)) {
+	vault.SetPreflight(f.preflight)
+	vault.SetPathFilter(splitList(f.includePaths), splitList(f.excludePaths))
+	vault.SetNamespaceFilter(splitList(f.namespaces))
+	vault.SetProtectedPaths(splitList(f.protectedPaths))
+	vault.SetConcurrency(f.concurrency)
+	vault.SetRateLimit(f.rateLimit)
+	vault.SetRetry(f.maxAttempts, f.retryBackoff)
+	if err := checkNames(cooldown.Classes()); err != nil {
+		logrus.WithError(err).Fatal("failed to parse COOLDOWNS")
+	}
+	vault.SetCooldowns(cooldown.Windows{})
 
-	cfg, err := getConfig()
+	switch mode := vault.AdoptMode(f.adopt); mode {
+	case vault.AdoptOff, vault.AdoptReview, vault.AdoptConfirm:
+		vault.SetAdoptMode(mode)
+	default:
+		logrus.WithField("adopt", f.adopt).Fatal("unknown adopt mode")
+	}
+
+	// explaining an entry never makes changes
+	if f.target != "" {
+		vault.SetExplainTarget(f.target)
+		dryRun = true
+	}
+
+	switch f.output {
+	case "text":
+	case "json":
+		vault.RecordChanges()
+	default:
+		logrus.WithField("output", f.output).Fatal("unknown output format")
+	}
+
+	// planning never makes changes
+	if planOut != "" {
+		vault.RecordChanges()
+		dryRun = true
+	}
+
+	if planFile != "" {
+		if err := vault.LoadPlan(planFile); err != nil {
+			logrus.WithError(err).Fatal("failed to load plan")
+		}
+		logrus.AddHook(planIDHook(vault.AppliedPlanID()))
+		logrus.WithField("file", planFile).Info("applying plan")
+	}
+
+	ctx, cancel := runContext(f.timeout)
+	defer cancel()
+
+	// a failing run exits through logrus, which ends and exports its trace
+	if err := tracing.Init(); err != nil {
+		logrus.WithError(err).Warn("failed to configure tracing, runs aren't traced")
+	}
+	ctx, span := tracing.Start(ctx, "vault-manager run", tracing.KindInternal)
+	span.SetAttribute("vault_manager.version", version)
+	span.SetAttribute("vault_manager.dry_run", dryRun)
+	logrus.RegisterExitHandler(func() {
+		span.End(errors.New("run failed"))
+		flushTraces()
+	})
+	defer flushTraces()
+	defer span.End(nil)
+
+	cfg, err := load(ctx)
 	if err != nil {
 		logrus.WithError(err).Fatal("failed to parse config")
 	}
 
+	topLevelConfigs, err := selectConfigs(sortedConfigs(cfg), splitList(f.only), splitList(f.skip))
+	if err != nil {
+		logrus.WithError(err).Fatal("failed to select top-level configurations")
+	}
+
+	noPrune := splitList(f.noPrune)
+	if f.noPrune != "all" {
+		if err := checkNames(noPrune); err != nil {
+			logrus.WithError(err).Fatal("failed to parse -no-prune")
+		}
+	}
+
+	applyConfigs := func(dryRun bool) {
+		for _, config := range topLevelConfigs {
+			// Marshal the contents of this object back into bytes so that it can be
+			// unmarshaled into a specific type in the application.
+			dataBytes, err := yaml.Marshal(cfg[config.Name])
+			if err != nil {
+				logrus.WithField("name", config.Name).Fatal("failed to remarshal configuration")
+			}
+			vault.SetPrune(f.noPrune != "all" && !listed(noPrune, config.Name))
+			if err := applyConfig(ctx, config.Name, dataBytes, dryRun, f.toplevelTimeout); err != nil {
+				logrus.WithError(err).WithField("name", config.Name).Fatal("failed to apply configuration")
+			}
+		}
+	}
+
+	// check the changes of every top-level against the plan, or show them to
+	// be confirmed, before making any
+	if (planFile != "" || f.confirm) && !dryRun {
+		applyConfigs(true)
+	}
+	if f.confirm && !dryRun && vault.Drifted() && !confirmed(os.Stdin) {
+		logrus.Fatal("apply cancelled, the changes were not confirmed")
+	}
+	applyConfigs(dryRun)
+
+	if planOut != "" {
+		id, err := vault.SavePlan(planOut)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to save plan")
+		}
+		logrus.WithFields(logrus.Fields{"file": planOut, "plan_id": id}).Info("saved plan")
+	}
+	if planFile != "" {
+		logrus.Info("successfully applied plan")
+	}
+
+	if f.output == "json" {
+		if err := vault.WriteReport(os.Stdout, dryRun); err != nil {
+			logrus.WithError(err).Fatal("failed to write changes")
+		}
+	}
+
+	if f.detailedExitCode && vault.Drifted() {
+		span.End(nil)
+		flushTraces()
+		cancel()
+		os.Exit(driftExitCode)
+	}
+}
+
+// flushTraces exports the spans of the run, giving up after a while so that
+// an unreachable collector doesn't hold the run back.
+func flushTraces() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracing.Flush(ctx); err != nil {
+		logrus.WithError(err).Warn("failed to export traces")
+	}
+}
+
+// sortedConfigs returns the top-levels of a configuration in the order they
+// are applied.
+func sortedConfigs(cfg config) []TopLevelConfig {
 	topLevelConfigs := []TopLevelConfig{}
 
 	for key := range cfg {
@@ -57,21 +253,107 @@ func main() {
 
 	// sort configs by priority
 	sort.Sort(ByPriority(topLevelConfigs))
+	return topLevelConfigs
+}
 
-	for _, config := range topLevelConfigs {
-		// Marshal the contents of this object back into bytes so that it can be
-		// unmarshaled into a specific type in the application.
-		dataBytes, err := yaml.Marshal(cfg[config.Name])
-		if err != nil {
-			logrus.WithField("name", config.Name).Fatal("failed to remarshal configuration")
+// confirmed asks whether to make the changes logged in dry-run mode, which
+// only "yes" confirms.
+func confirmed(in io.Reader) bool {
+	fmt.Fprint(os.Stderr, "Make the changes above? Only 'yes' will be accepted: ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
+
+// runContext returns a context cancelled on SIGINT, or once the timeout has
+// elapsed if set.
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupted:
+			logrus.Warn("interrupted, cancelling the remaining changes")
+			cancel()
+		case <-ctx.Done():
 		}
-		toplevel.Apply(config.Name, dataBytes, dryRun)
+		signal.Stop(interrupted)
+	}()
+
+	return ctx, cancel
+}
+
+// applyConfig applies a top-level configuration, within the timeout if set.
+func applyConfig(ctx context.Context, name string, cfg []byte, dryRun bool, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
+	return toplevel.Apply(ctx, name, cfg, dryRun)
+}
+
+// selectConfigs returns the top-levels that are listed in only, if any, and
+// aren't listed in skip.
+func selectConfigs(configs []TopLevelConfig, only, skip []string) ([]TopLevelConfig, error) {
+	if err := checkNames(append(append([]string{}, only...), skip...)); err != nil {
+		return nil, err
+	}
+
+	selected := make([]TopLevelConfig, 0, len(configs))
+	for _, c := range configs {
+		if len(only) > 0 && !listed(only, c.Name) {
+			logrus.WithField("name", c.Name).Info("skipping configuration not listed in -only")
+			continue
+		}
+		if listed(skip, c.Name) {
+			logrus.WithField("name", c.Name).Info("skipping configuration listed in -skip")
+			continue
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+// checkNames returns an error if any of the names isn't the one of a
+// top-level.
+func checkNames(names []string) error {
+	for _, name := range names {
+		if !toplevel.Registered(name) {
+			return errors.Errorf("unknown top-level configuration %s", name)
+		}
+	}
+	return nil
+}
+
+func listed(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
 }
 
 type config map[string]interface{}
 
-func getConfig() (config, error) {
+func getConfig(ctx context.Context) (config, error) {
+	// read configuration from a local file instead of the graphql server
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		cfg, err := configfile.Load(configFile)
+		if err != nil {
+			return config{}, errors.Wrap(err, "failed to load configuration file")
+		}
+		return cfg, nil
+	}
+
 	graphqlServer := os.Getenv("GRAPHQL_SERVER")
 	if graphqlServer == "" {
 		graphqlServer = "http://localhost:4000/graphql"
@@ -103,9 +385,6 @@ func getConfig() (config, error) {
 		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(graphqlUsername+":"+graphqlPassword)))
 	}
 
-	// define a Context for the request
-	ctx := context.Background()
-
 	var response map[string]interface{}
 
 	// execute query and capture the response
@@ -119,18 +398,146 @@ func getConfig() (config, error) {
 func resolveConfigPriority(s string) int {
 	var priority int
 	switch s {
+	// namespaces hold the resources of every other top-level
+	case "vault_namespaces":
+		priority = -2
+	// plugins are registered before secrets engines and auth methods use them
+	case "vault_plugins":
+		priority = -1
 	case "vault_policies":
 		priority = 1
-	case "vault_audit_backends":
+	case "vault_password_policies":
 		priority = 2
-	case "vault_secret_engines":
+	case "vault_audit_backends":
 		priority = 3
-	case "vault_auth_backends":
+	case "vault_secret_engines":
 		priority = 4
-	case "vault_roles":
+	case "vault_auth_backends":
 		priority = 5
+	case "vault_roles":
+		priority = 6
+	case "vault_kubernetes_auth":
+		priority = 7
+	case "vault_ldap_auth":
+		priority = 8
+	case "vault_github_auth":
+		priority = 9
+	case "vault_oidc_auth":
+		priority = 10
+	case "vault_identity_entities":
+		priority = 11
+	case "vault_identity_entity_aliases":
+		priority = 12
+	case "vault_identity_groups":
+		priority = 13
+	case "vault_identity_group_aliases":
+		priority = 14
+	case "vault_database":
+		priority = 15
+	case "vault_pki":
+		priority = 16
+	case "vault_ssh":
+		priority = 17
+	case "vault_transit":
+		priority = 18
+	case "vault_transform":
+		priority = 19
+	case "vault_totp":
+		priority = 20
+	case "vault_aws":
+		priority = 21
+	case "vault_gcp":
+		priority = 22
+	case "vault_azure":
+		priority = 23
+	case "vault_consul":
+		priority = 24
+	case "vault_rabbitmq":
+		priority = 25
+	case "vault_nomad":
+		priority = 26
+	case "vault_kv":
+		priority = 27
+	case "vault_kv_secrets":
+		priority = 28
+	case "vault_rate_limit_quotas":
+		priority = 29
+	case "vault_lease_count_quotas":
+		priority = 30
+	case "vault_mfa_methods":
+		priority = 31
+	case "vault_mfa_login_enforcements":
+		priority = 32
+	case "vault_identity_oidc_keys":
+		priority = 33
+	case "vault_identity_oidc_assignments":
+		priority = 34
+	case "vault_identity_oidc_scopes":
+		priority = 35
+	case "vault_identity_oidc_clients":
+		priority = 36
+	case "vault_identity_oidc_providers":
+		priority = 37
+	case "vault_identity_oidc_roles":
+		priority = 38
+	case "vault_token_roles":
+		priority = 39
+	case "vault_cors":
+		priority = 40
+	case "vault_ui_headers":
+		priority = 41
+	case "vault_ui_custom_messages":
+		priority = 42
+	case "vault_audited_request_headers":
+		priority = 43
+	case "vault_egp_policies":
+		priority = 44
+	case "vault_rgp_policies":
+		priority = 45
+	case "vault_cert_auth":
+		priority = 46
+	case "vault_userpass_auth":
+		priority = 47
+	case "vault_okta_auth":
+		priority = 48
+	case "vault_radius_auth":
+		priority = 49
+	case "vault_kerberos_auth":
+		priority = 50
+	case "vault_raft_autopilot":
+		priority = 51
+	case "vault_license":
+		priority = 52
+	case "vault_replication":
+		priority = 53
+	case "vault_kmip":
+		priority = 54
+	case "vault_keymgmt":
+		priority = 55
+	case "vault_terraform":
+		priority = 56
+	case "vault_generic":
+		priority = 57
 	default:
 		priority = 0
 	}
 	return priority
 }
+
+// planIDHook adds the ID of the applied plan to every log entry, so that logs
+// show which reviewed plan made each change.
+type planIDHook string
+
+func (h planIDHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h planIDHook) Fire(e *logrus.Entry) error {
+	data := make(logrus.Fields, len(e.Data)+1)
+	for k, v := range e.Data {
+		data[k] = v
+	}
+	data["plan_id"] = string(h)
+	e.Data = data
+	return nil
+}
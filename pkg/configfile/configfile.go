@@ -0,0 +1,306 @@
+// Package configfile implements loading vault-manager configuration from local
+// files, as an alternative to querying a GraphQL server.
+//
+// Files are decoded according to their extension, either as YAML (".yaml",
+// ".yml") or HCL (".hcl"), and a directory is loaded by merging all of the
+// configuration files it directly contains in lexical order. In HCL, entries
+// of a top-level are declared as repeated blocks and nested blocks or objects
+// decode into mappings, while explicit lists (`[...]`) stay lists.
+//
+// Any mapping in a file may carry an `_include` key holding a path (or a list
+// of paths) to other files. The included mappings are merged into the
+// including one, with lists being concatenated and local values taking
+// precedence otherwise. A list item consisting solely of an `_include` key is
+// replaced by the items of the included lists. Relative paths are resolved
+// against the directory of the including file.
+package configfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const includeKey = "_include"
+
+// Load reads the configuration stored at path, which is either a file or a
+// directory of files, recursively resolving all of the include directives it
+// contains.
+func Load(path string) (map[string]interface{}, error) {
+	files := []string{path}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read configuration path %s", path)
+	}
+	if info.IsDir() {
+		if files, err = configFiles(path); err != nil {
+			return nil, err
+		}
+	}
+
+	m := make(map[interface{}]interface{})
+	for _, f := range files {
+		l := &loader{}
+		data, err := l.load(f)
+		if err != nil {
+			return nil, err
+		}
+
+		fm, ok := data.(map[interface{}]interface{})
+		if !ok {
+			return nil, errors.Errorf("%s: configuration must be a mapping of top-level names", f)
+		}
+		merge(m, fm)
+	}
+
+	cfg := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cfg[fmt.Sprintf("%v", k)] = v
+	}
+
+	return cfg, nil
+}
+
+// loader keeps track of the chain of files being loaded in order to detect
+// include cycles.
+type loader struct {
+	stack []string
+}
+
+func (l *loader) load(path string) (interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve path %s", path)
+	}
+
+	for _, p := range l.stack {
+		if p == abs {
+			return nil, errors.Errorf("include cycle detected: %s -> %s", strings.Join(l.stack, " -> "), abs)
+		}
+	}
+	l.stack = append(l.stack, abs)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	b, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read configuration file %s", abs)
+	}
+
+	data, err := decode(abs, b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode configuration file %s", abs)
+	}
+
+	return l.resolve(data, filepath.Dir(abs))
+}
+
+// configFiles returns the configuration files directly inside dir.
+func configFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read configuration directory %s", dir)
+	}
+
+	var files []string
+	for _, info := range infos {
+		switch filepath.Ext(info.Name()) {
+		case ".yaml", ".yml", ".hcl":
+			if !info.IsDir() {
+				files = append(files, filepath.Join(dir, info.Name()))
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// decode parses the contents of a configuration file according to its
+// extension into the same structures produced by decoding YAML.
+func decode(path string, b []byte) (interface{}, error) {
+	if filepath.Ext(path) != ".hcl" {
+		var data interface{}
+		err := yaml.Unmarshal(b, &data)
+		return data, err
+	}
+
+	var data map[string]interface{}
+	if err := hcl.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+
+	// Repeated top-level blocks are the entries of a top-level configuration.
+	root := make(map[interface{}]interface{}, len(data))
+	for k, v := range data {
+		if blocks, ok := v.([]map[string]interface{}); ok {
+			entries := make([]interface{}, 0, len(blocks))
+			for _, b := range blocks {
+				entries = append(entries, fromHCL(b))
+			}
+			root[k] = entries
+			continue
+		}
+		root[k] = fromHCL(v)
+	}
+
+	return root, nil
+}
+
+// fromHCL converts a value decoded from HCL into its YAML equivalent.
+//
+// HCL decodes blocks and objects into lists of mappings, so a list holding a
+// single mapping is turned back into that mapping.
+func fromHCL(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []map[string]interface{}:
+		if len(v) == 1 {
+			return fromHCL(v[0])
+		}
+		xs := make([]interface{}, 0, len(v))
+		for _, m := range v {
+			xs = append(xs, fromHCL(m))
+		}
+		return xs
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, x := range v {
+			m[k] = fromHCL(x)
+		}
+		return m
+	case []interface{}:
+		xs := make([]interface{}, 0, len(v))
+		for _, x := range v {
+			xs = append(xs, fromHCL(x))
+		}
+		return xs
+	default:
+		return v
+	}
+}
+
+func (l *loader) resolve(data interface{}, dir string) (interface{}, error) {
+	switch v := data.(type) {
+	case map[interface{}]interface{}:
+		return l.resolveMap(v, dir)
+	case []interface{}:
+		return l.resolveList(v, dir)
+	default:
+		return data, nil
+	}
+}
+
+func (l *loader) resolveMap(m map[interface{}]interface{}, dir string) (interface{}, error) {
+	local := make(map[interface{}]interface{}, len(m))
+	for k, v := range m {
+		if k == includeKey {
+			continue
+		}
+		resolved, err := l.resolve(v, dir)
+		if err != nil {
+			return nil, err
+		}
+		local[k] = resolved
+	}
+
+	directive, ok := m[includeKey]
+	if !ok {
+		return local, nil
+	}
+
+	included, err := l.include(directive, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[interface{}]interface{})
+	for _, data := range included {
+		im, ok := data.(map[interface{}]interface{})
+		if !ok {
+			return nil, errors.Errorf("%s: included files must contain a mapping", dir)
+		}
+		merge(merged, im)
+	}
+	merge(merged, local)
+
+	return merged, nil
+}
+
+func (l *loader) resolveList(xs []interface{}, dir string) (interface{}, error) {
+	resolved := make([]interface{}, 0, len(xs))
+	for _, x := range xs {
+		if m, ok := x.(map[interface{}]interface{}); ok && len(m) == 1 && m[includeKey] != nil {
+			included, err := l.include(m[includeKey], dir)
+			if err != nil {
+				return nil, err
+			}
+			for _, data := range included {
+				if items, ok := data.([]interface{}); ok {
+					resolved = append(resolved, items...)
+				} else {
+					resolved = append(resolved, data)
+				}
+			}
+			continue
+		}
+
+		r, err := l.resolve(x, dir)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, r)
+	}
+
+	return resolved, nil
+}
+
+// include loads every file referenced by an include directive.
+func (l *loader) include(directive interface{}, dir string) ([]interface{}, error) {
+	var paths []string
+	switch v := directive.(type) {
+	case string:
+		paths = []string{v}
+	case []interface{}:
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, errors.Errorf("%s: %s entries must be paths", dir, includeKey)
+			}
+			paths = append(paths, s)
+		}
+	default:
+		return nil, errors.Errorf("%s: %s must be a path or a list of paths", dir, includeKey)
+	}
+
+	included := make([]interface{}, 0, len(paths))
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		data, err := l.load(p)
+		if err != nil {
+			return nil, err
+		}
+		included = append(included, data)
+	}
+
+	return included, nil
+}
+
+// merge copies src into dst, concatenating values that are lists in both.
+func merge(dst, src map[interface{}]interface{}) {
+	for k, v := range src {
+		existing, ok := dst[k].([]interface{})
+		items, isList := v.([]interface{})
+		if ok && isList {
+			dst[k] = append(append([]interface{}{}, existing...), items...)
+			continue
+		}
+		dst[k] = v
+	}
+}
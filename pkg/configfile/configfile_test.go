@@ -0,0 +1,178 @@
+package configfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "configfile")
+	require.NoError(t, err)
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	table := []struct {
+		description string
+		files       map[string]string
+		expected    map[string]interface{}
+	}{
+		{
+			description: "file without includes is loaded as is",
+			files: map[string]string{
+				"main.yaml": "vault_policies:\n- name: x\n",
+			},
+			expected: map[string]interface{}{
+				"vault_policies": []interface{}{
+					map[interface{}]interface{}{"name": "x"},
+				},
+			},
+		},
+		{
+			description: "top-level lists are concatenated",
+			files: map[string]string{
+				"main.yaml":            "_include: common/policies.yaml\nvault_policies:\n- name: z\n",
+				"common/policies.yaml": "vault_policies:\n- name: x\n",
+			},
+			expected: map[string]interface{}{
+				"vault_policies": []interface{}{
+					map[interface{}]interface{}{"name": "x"},
+					map[interface{}]interface{}{"name": "z"},
+				},
+			},
+		},
+		{
+			description: "list items are spliced relative to the including file",
+			files: map[string]string{
+				"main.yaml":             "_include: [sub/audit.yaml]\n",
+				"sub/audit.yaml":        "vault_audit_backends:\n- _include: devices.yaml\n",
+				"sub/devices.yaml":      "- _path: file/\n  options:\n    _include: options/file.yaml\n",
+				"sub/options/file.yaml": "file_path: /var/log/vault.log\n",
+			},
+			expected: map[string]interface{}{
+				"vault_audit_backends": []interface{}{
+					map[interface{}]interface{}{
+						"_path":   "file/",
+						"options": map[interface{}]interface{}{"file_path": "/var/log/vault.log"},
+					},
+				},
+			},
+		},
+		{
+			description: "local values take precedence over included ones",
+			files: map[string]string{
+				"main.yaml": "vault_audit_backends:\n- _path: file/\n  options:\n    _include: opts.yaml\n    file_path: /local.log\n",
+				"opts.yaml": "file_path: /shared.log\n",
+			},
+			expected: map[string]interface{}{
+				"vault_audit_backends": []interface{}{
+					map[interface{}]interface{}{
+						"_path":   "file/",
+						"options": map[interface{}]interface{}{"file_path": "/local.log"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			defer os.RemoveAll(dir)
+
+			cfg, err := Load(filepath.Join(dir, "main.yaml"))
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, cfg)
+		})
+	}
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.yaml": "_include: a.yaml\n",
+		"a.yaml":    "_include: b.yaml\n",
+		"b.yaml":    "_include: a.yaml\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := Load(filepath.Join(dir, "main.yaml"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "include cycle detected")
+}
+
+func TestLoadHCL(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.hcl": `
+vault_audit_backends {
+  _path = "file/"
+  type = "file"
+  options {
+    file_path = "/var/log/vault.log"
+  }
+}
+
+vault_auth_backends = [{
+  _path = "github/"
+  policy_mappings = [{
+    github_team = { team = "sre" }
+    policies = [{ name = "admin" }]
+  }]
+}]
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := Load(filepath.Join(dir, "main.hcl"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"vault_audit_backends": []interface{}{
+			map[interface{}]interface{}{
+				"_path":   "file/",
+				"type":    "file",
+				"options": map[interface{}]interface{}{"file_path": "/var/log/vault.log"},
+			},
+		},
+		"vault_auth_backends": []interface{}{
+			map[interface{}]interface{}{
+				"_path": "github/",
+				"policy_mappings": []interface{}{
+					map[interface{}]interface{}{
+						"github_team": map[interface{}]interface{}{"team": "sre"},
+						"policies": []interface{}{
+							map[interface{}]interface{}{"name": "admin"},
+						},
+					},
+				},
+			},
+		},
+	}, cfg)
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.yaml":    "vault_policies:\n- name: a\n",
+		"b.hcl":     "vault_policies {\n  name = \"b\"\n}\n",
+		"notes.txt": "not configuration",
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := Load(dir)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"vault_policies": []interface{}{
+			map[interface{}]interface{}{"name": "a"},
+			map[interface{}]interface{}{"name": "b"},
+		},
+	}, cfg)
+}
@@ -0,0 +1,145 @@
+// Package cooldown throttles disruptive changes to a class of Vault resources
+// by remembering, across runs, when the last change to that class was made.
+//
+// Cooldown windows are configured through the COOLDOWNS environment variable
+// as a comma-separated list of `<class>=<duration>` pairs, e.g.
+// `vault_audit_backends=10m`. The time of the last change is persisted in the
+// file named by COOLDOWN_STATE_FILE, separately for every instance and
+// namespace the class is applied in.
+//
+// Classes are the names of top-levels, whose changes are held back by
+// vault.Reconcile and vault.Act once Windows is set with vault.SetCooldowns.
+package cooldown
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/pkg/errors"
+)
+
+// now is replaced in tests.
+var now = time.Now
+
+// Windows holds back the changes to the top-levels during the cooldown windows
+// configured by COOLDOWNS.
+type Windows struct{}
+
+var _ vault.Cooldowns = Windows{}
+
+// Remaining returns for how long changes to a top-level must still be held
+// back.
+func (Windows) Remaining(name string) (time.Duration, error) {
+	return Remaining(name)
+}
+
+// Record persists that changes to a top-level have just been made.
+func (Windows) Record(name string) error {
+	return Record(name)
+}
+
+// Classes returns the classes that COOLDOWNS configures a window for.
+func Classes() []string {
+	classes := make([]string, 0)
+	for _, pair := range strings.Split(os.Getenv("COOLDOWNS"), ",") {
+		if kv := strings.SplitN(strings.TrimSpace(pair), "=", 2); len(kv) == 2 {
+			classes = append(classes, kv[0])
+		}
+	}
+	return classes
+}
+
+// Remaining returns for how long changes to the provided class must still be
+// held back, or zero if they can be made right away.
+func Remaining(class string) (time.Duration, error) {
+	window, err := windowFor(class)
+	if err != nil || window == 0 {
+		return 0, err
+	}
+
+	state, err := readState()
+	if err != nil {
+		return 0, err
+	}
+	last, ok := state[vault.ScopeKey(class)]
+	if !ok {
+		return 0, nil
+	}
+
+	if remaining := last.Add(window).Sub(now()); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// Record persists that a change to the provided class has just been made.
+//
+// Nothing is recorded for classes without a configured cooldown.
+func Record(class string) error {
+	if window, err := windowFor(class); err != nil || window == 0 {
+		return err
+	}
+
+	state, err := readState()
+	if err != nil {
+		return err
+	}
+	state[vault.ScopeKey(class)] = now()
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode cooldown state")
+	}
+
+	if err := ioutil.WriteFile(statePath(), b, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write cooldown state to %s", statePath())
+	}
+	return nil
+}
+
+func windowFor(class string) (time.Duration, error) {
+	for _, pair := range strings.Split(os.Getenv("COOLDOWNS"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[0] != class {
+			continue
+		}
+
+		window, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to parse cooldown window of %s", class)
+		}
+		return window, nil
+	}
+
+	return 0, nil
+}
+
+func statePath() string {
+	if path := os.Getenv("COOLDOWN_STATE_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join(os.TempDir(), "vault-manager-cooldown.json")
+}
+
+func readState() (map[string]time.Time, error) {
+	state := make(map[string]time.Time)
+
+	b, err := ioutil.ReadFile(statePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read cooldown state from %s", statePath())
+	}
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode cooldown state from %s", statePath())
+	}
+
+	return state, nil
+}
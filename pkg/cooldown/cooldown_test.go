@@ -0,0 +1,57 @@
+package cooldown
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCooldown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cooldown")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("COOLDOWN_STATE_FILE", filepath.Join(dir, "state.json"))
+	os.Setenv("COOLDOWNS", "vault_audit_backends=10m")
+	defer os.Unsetenv("COOLDOWN_STATE_FILE")
+	defer os.Unsetenv("COOLDOWNS")
+
+	start := time.Now()
+	defer func() { now = time.Now }()
+
+	remaining := func(class string) time.Duration {
+		r, err := Remaining(class)
+		require.NoError(t, err)
+		return r
+	}
+
+	now = func() time.Time { return start }
+	require.Equal(t, time.Duration(0), remaining("vault_audit_backends"), "nothing recorded yet")
+
+	require.NoError(t, Record("vault_audit_backends"))
+	require.NoError(t, Record("vault_policies"))
+
+	now = func() time.Time { return start.Add(4 * time.Minute) }
+	require.Equal(t, 6*time.Minute, remaining("vault_audit_backends"), "within the window")
+	require.Equal(t, time.Duration(0), remaining("vault_policies"), "class without a cooldown")
+
+	vault.SetNamespace("team")
+	require.Equal(t, time.Duration(0), remaining("vault_audit_backends"), "changed in another namespace")
+	vault.SetNamespace("")
+
+	now = func() time.Time { return start.Add(11 * time.Minute) }
+	require.Equal(t, time.Duration(0), remaining("vault_audit_backends"), "window has elapsed")
+}
+
+func TestCooldownFailsOnInvalidWindows(t *testing.T) {
+	os.Setenv("COOLDOWNS", "vault_audit_backends=soon")
+	defer os.Unsetenv("COOLDOWNS")
+
+	_, err := Remaining("vault_audit_backends")
+	require.Error(t, err)
+}
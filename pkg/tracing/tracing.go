@@ -0,0 +1,334 @@
+// Package tracing emits OpenTelemetry traces of vault-manager runs: a span for
+// the run, a child span for every top-level it applies and a grandchild span
+// for every request sent to Vault.
+//
+// Spans are exported with the OTLP/HTTP JSON encoding to the endpoint
+// configured by the standard OpenTelemetry environment variables:
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT (or OTEL_EXPORTER_OTLP_ENDPOINT, suffixed
+// with /v1/traces), OTEL_EXPORTER_OTLP_HEADERS, OTEL_EXPORTER_OTLP_TIMEOUT,
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES. Tracing is disabled, and
+// spans are no-ops, unless an endpoint is set, or when OTEL_TRACES_EXPORTER is
+// "none" or OTEL_SDK_DISABLED is "true". A run continues the trace of the W3C
+// trace context in TRACEPARENT, if set.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// protocol is the only OTLP protocol spans are exported with.
+const protocol = "http/json"
+
+// Span kinds of the OTLP encoding.
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+// Status codes of the OTLP encoding.
+const (
+	statusOK    = 1
+	statusError = 2
+)
+
+// exporter sends the ended spans to an OTLP endpoint.
+type exporter struct {
+	endpoint string
+	headers  map[string]string
+	resource map[string]interface{}
+	client   *http.Client
+}
+
+// current is the exporter of the run, nil when tracing is disabled, and ended
+// holds the spans to be exported.
+var (
+	current *exporter
+	ended   []*Span
+	m       sync.Mutex
+)
+
+// Init enables tracing if the environment configures it, or disables it.
+func Init() error {
+	m.Lock()
+	current, ended = nil, nil
+	m.Unlock()
+
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil
+	}
+	switch e := os.Getenv("OTEL_TRACES_EXPORTER"); e {
+	case "", "otlp":
+	case "none":
+		return nil
+	default:
+		return errors.Errorf("unsupported OTEL_TRACES_EXPORTER %s, only otlp and none are", e)
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil
+	}
+
+	if p := otlpEnv("PROTOCOL"); p != "" && p != protocol {
+		return errors.Errorf("unsupported OTLP protocol %s, only %s is", p, protocol)
+	}
+	timeout := 10 * time.Second
+	if t := otlpEnv("TIMEOUT"); t != "" {
+		ms, err := strconv.Atoi(t)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse OTLP timeout %s", t)
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	resource := make(map[string]interface{})
+	for k, v := range pairs(os.Getenv("OTEL_RESOURCE_ATTRIBUTES")) {
+		resource[k] = v
+	}
+	resource["service.name"] = "vault-manager"
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	current = &exporter{
+		endpoint: endpoint,
+		headers:  pairs(otlpEnv("HEADERS")),
+		resource: resource,
+		client:   &http.Client{Timeout: timeout},
+	}
+	return nil
+}
+
+// Enabled reports whether spans are recorded.
+func Enabled() bool {
+	m.Lock()
+	defer m.Unlock()
+	return current != nil
+}
+
+// otlpEnv returns the setting of the OTLP exporter for traces, falling back to
+// the one for every signal.
+func otlpEnv(name string) string {
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_" + name); v != "" {
+		return v
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + name)
+}
+
+// pairs decodes a comma-separated list of key=value pairs whose values are
+// URL-encoded, as in OTEL_EXPORTER_OTLP_HEADERS.
+func pairs(s string) map[string]string {
+	decoded := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			continue
+		}
+		v, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			v = strings.TrimSpace(kv[1])
+		}
+		decoded[strings.TrimSpace(kv[0])] = v
+	}
+	return decoded
+}
+
+// Span is an operation of a trace. A nil span, returned while tracing is
+// disabled, records nothing.
+type Span struct {
+	traceID, spanID, parentID string
+	name                      string
+	kind                      int
+	start, end                time.Time
+	attributes                map[string]interface{}
+	err                       error
+}
+
+type spanKey struct{}
+
+// Start starts a span, a child of the span of the context if any, and returns
+// a context carrying it.
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+
+	s := &Span{
+		spanID:     randomID(8),
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else if traceID, parentID, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		s.traceID, s.parentID = traceID, parentID
+	} else {
+		s.traceID = randomID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttribute sets an attribute of the span, a string, an int or a bool.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	s.attributes[key] = value
+}
+
+// End ends the span, as failed if err is set. Spans are only ended once.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	if current != nil {
+		ended = append(ended, s)
+	}
+}
+
+// Flush exports the ended spans.
+func Flush(ctx context.Context) error {
+	m.Lock()
+	e, spans := current, ended
+	ended = nil
+	m.Unlock()
+	if e == nil || len(spans) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return errors.Wrap(err, "failed to encode spans")
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to export spans")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "failed to export spans to %s", e.endpoint)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("failed to export spans to %s: %s", e.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// payload encodes spans as an OTLP/JSON export request.
+func (e *exporter) payload(spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		span := map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        attributes(s.attributes),
+			"status":            map[string]interface{}{"code": statusOK},
+		}
+		if s.parentID != "" {
+			span["parentSpanId"] = s.parentID
+		}
+		if s.err != nil {
+			span["status"] = map[string]interface{}{"code": statusError, "message": s.err.Error()}
+		}
+		encoded = append(encoded, span)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{"attributes": attributes(e.resource)},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": "github.com/app-sre/vault-manager"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// attributes encodes attributes as OTLP/JSON key-values, sorted by key.
+func attributes(attrs map[string]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	encoded := make([]map[string]interface{}, 0, len(keys))
+	for _, k := range keys {
+		var value map[string]interface{}
+		switch v := attrs[k].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprintf("%v", v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": k, "value": value})
+	}
+	return encoded
+}
+
+// parseTraceparent returns the trace and parent span IDs of a W3C trace
+// context, e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceparent(s string) (traceID, parentID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil || strings.Trim(id, "0") == "" {
+			return "", "", false
+		}
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), true
+}
+
+// randomID returns a random ID of n bytes, hex-encoded.
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
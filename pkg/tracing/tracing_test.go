@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// exportRequest is the part of an OTLP/JSON export request checked by tests.
+type exportRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []attribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      string      `json:"traceId"`
+				SpanID       string      `json:"spanId"`
+				ParentSpanID string      `json:"parentSpanId"`
+				Name         string      `json:"name"`
+				Kind         int         `json:"kind"`
+				Attributes   []attribute `json:"attributes"`
+				Status       struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type attribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// collector starts an OTLP endpoint and configures tracing to export to it.
+func collector(t *testing.T) (*[]exportRequest, func()) {
+	requests := make([]exportRequest, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.Equal(t, "secret token", r.Header.Get("Authorization"))
+		var req exportRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+	}))
+
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL)
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=secret%20token")
+	os.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=test")
+	require.NoError(t, Init())
+	return &requests, func() {
+		server.Close()
+		os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		os.Unsetenv("OTEL_EXPORTER_OTLP_HEADERS")
+		os.Unsetenv("OTEL_RESOURCE_ATTRIBUTES")
+		require.NoError(t, Init())
+	}
+}
+
+func TestSpansAreExportedWithTheirParents(t *testing.T) {
+	requests, stop := collector(t)
+	defer stop()
+
+	ctx, run := Start(context.Background(), "vault-manager run", KindInternal)
+	ctx, apply := Start(ctx, "apply vault_policies", KindInternal)
+	_, call := Start(ctx, "vault.write", KindClient)
+	call.SetAttribute("vault.path", "sys/policies/acl/app")
+	call.SetAttribute("http.response.status_code", 204)
+	call.End(nil)
+	apply.End(errors.New("failed to write policy"))
+	run.End(nil)
+	run.End(errors.New("ended twice"))
+	require.NoError(t, Flush(context.Background()))
+
+	require.Len(t, *requests, 1)
+	resource := (*requests)[0].ResourceSpans[0]
+	require.Equal(t, []attribute{
+		{Key: "deployment.environment", Value: map[string]interface{}{"stringValue": "test"}},
+		{Key: "service.name", Value: map[string]interface{}{"stringValue": "vault-manager"}},
+	}, resource.Resource.Attributes)
+
+	spans := resource.ScopeSpans[0].Spans
+	require.Len(t, spans, 3)
+	require.Equal(t, "vault.write", spans[0].Name)
+	require.Equal(t, KindClient, spans[0].Kind)
+	require.Equal(t, []attribute{
+		{Key: "http.response.status_code", Value: map[string]interface{}{"intValue": "204"}},
+		{Key: "vault.path", Value: map[string]interface{}{"stringValue": "sys/policies/acl/app"}},
+	}, spans[0].Attributes)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	require.Equal(t, spans[2].SpanID, spans[1].ParentSpanID)
+	require.Empty(t, spans[2].ParentSpanID)
+	for _, s := range spans {
+		require.Equal(t, spans[2].TraceID, s.TraceID)
+	}
+
+	require.Equal(t, statusOK, spans[0].Status.Code)
+	require.Equal(t, statusError, spans[1].Status.Code)
+	require.Equal(t, "failed to write policy", spans[1].Status.Message)
+	require.Equal(t, statusOK, spans[2].Status.Code, "a span is only ended once")
+
+	require.NoError(t, Flush(context.Background()))
+	require.Len(t, *requests, 1, "exported spans are only exported once")
+}
+
+func TestRunsContinueTheTraceOfTraceparent(t *testing.T) {
+	requests, stop := collector(t)
+	defer stop()
+	os.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	defer os.Unsetenv("TRACEPARENT")
+
+	_, run := Start(context.Background(), "vault-manager run", KindInternal)
+	run.End(nil)
+	require.NoError(t, Flush(context.Background()))
+
+	span := (*requests)[0].ResourceSpans[0].ScopeSpans[0].Spans[0]
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+	require.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+}
+
+func TestTracingIsDisabledUnlessConfigured(t *testing.T) {
+	table := []struct {
+		description string
+		env         map[string]string
+		enabled     bool
+		err         bool
+	}{
+		{"no endpoint", nil, false, false},
+		{"endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318"}, true, false},
+		{"traces endpoint", map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://localhost:4318/v1/traces"}, true, false},
+		{"exporter none", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318", "OTEL_TRACES_EXPORTER": "none"}, false, false},
+		{"sdk disabled", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318", "OTEL_SDK_DISABLED": "true"}, false, false},
+		{"unsupported exporter", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318", "OTEL_TRACES_EXPORTER": "zipkin"}, false, true},
+		{"unsupported protocol", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, false, true},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+			err := Init()
+			require.Equal(t, tt.err, err != nil)
+			require.Equal(t, tt.enabled, Enabled())
+
+			if !tt.enabled {
+				ctx := context.Background()
+				spanCtx, span := Start(ctx, "vault-manager run", KindInternal)
+				require.Nil(t, span)
+				require.Equal(t, ctx, spanCtx)
+				span.SetAttribute("ignored", true)
+				span.End(nil)
+			}
+		})
+	}
+	require.NoError(t, Init())
+}
@@ -0,0 +1,52 @@
+package vault
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// authAccessors holds the accessors of the enabled auth methods by path, for
+// every instance and namespace they were listed in during the run.
+var (
+	authAccessors  = make(map[string]map[string]string)
+	authAccessorsM sync.Mutex
+)
+
+// AuthAccessors returns the accessors of the auth methods enabled in the
+// current instance and namespace by path, without slashes. They are listed
+// once per run and shared by the top-levels resolving auth methods by path.
+func AuthAccessors(client *api.Client) (map[string]string, error) {
+	authAccessorsM.Lock()
+	defer authAccessorsM.Unlock()
+
+	key := ScopeKey("")
+	if _, ok := authAccessors[key]; !ok {
+		auths, err := client.Sys().ListAuth()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list authentication backends from Vault instance")
+		}
+		accessors := make(map[string]string, len(auths))
+		for p, auth := range auths {
+			accessors[strings.Trim(p, "/")] = auth.Accessor
+		}
+		authAccessors[key] = accessors
+	}
+
+	accessors := make(map[string]string, len(authAccessors[key]))
+	for p, a := range authAccessors[key] {
+		accessors[p] = a
+	}
+	return accessors, nil
+}
+
+// ForgetAuthAccessors drops the accessors listed in the current instance and
+// namespace, so that they are listed again once auth methods were enabled or
+// disabled.
+func ForgetAuthAccessors() {
+	authAccessorsM.Lock()
+	defer authAccessorsM.Unlock()
+	delete(authAccessors, ScopeKey(""))
+}
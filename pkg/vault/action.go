@@ -0,0 +1,91 @@
+package vault
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Action is a change made to a Vault instance besides writing and deleting
+// the items of a top-level, such as generating a key or rotating credentials.
+type Action struct {
+	// Name is what the action does, e.g. "rotate".
+	Name string
+	// Key identifies what the action changes, e.g. "database/static-roles/app".
+	Key string
+	// Data, if set, describes the state written by the action, for plans to
+	// detect that it changed. Its secret fields are neither digested nor
+	// logged.
+	Data map[string]interface{}
+	// Operations lists the requests made to Vault to perform the action.
+	Operations []Operation
+	// Perform makes the change.
+	Perform func(client *api.Client) error
+}
+
+func (a Action) String() string {
+	return a.Name + " " + a.Key
+}
+
+// Act performs the actions of a top-level, in order, once they have been
+// checked against the plan and the capabilities of the token. Any action is
+// recorded as drift. Actions changing paths outside of the path filter aren't
+// performed, and none are during the cooldown of the top-level.
+//
+// In dry-run mode, the actions are only logged.
+func Act(ctx context.Context, name, pkg string, actions []Action, dryRun bool) error {
+	actions = managedActions(actions)
+	if len(actions) > 0 {
+		cooldown, err := cooldownFor(name)
+		if err != nil {
+			return err
+		}
+		if cooldown > 0 {
+			heldBack(name, pkg, cooldown, dryRun)
+			actions = []Action{}
+		}
+	}
+	if err := PlanActions(name, actions); err != nil {
+		return err
+	}
+
+	// Check that the token is allowed to perform every planned action.
+	ops := make([]Operation, 0, len(actions))
+	for _, a := range actions {
+		ops = append(ops, a.Operations...)
+	}
+	authorized, err := Preflight(ctx, name, ops)
+	if err != nil {
+		return err
+	}
+	if !authorized && !dryRun {
+		return errors.Errorf("token is not authorized to apply %s configuration", name)
+	}
+
+	if !dryRun && len(actions) > 0 {
+		if err := recordCooldown(name); err != nil {
+			return err
+		}
+	}
+	for _, a := range actions {
+		if dryRun && a.Data != nil {
+			logrus.Infof("[Dry Run]\tpackage=%s\taction to be performed='%v'\tdata='%v'", pkg, a, withoutSecretFields(a.Data))
+			continue
+		}
+		if dryRun {
+			logrus.Infof("[Dry Run]\tpackage=%s\taction to be performed='%v'", pkg, a)
+			continue
+		}
+
+		client, err := ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := a.Perform(client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package vault
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// AdoptMode controls how items that already exist in a Vault instance, but
+// differ from their configuration, are handled.
+type AdoptMode string
+
+const (
+	// AdoptOff updates existing items right away. This is the default.
+	AdoptOff AdoptMode = ""
+	// AdoptReview leaves existing items unchanged and records them as
+	// adoptable so that their differences can be reviewed.
+	AdoptReview AdoptMode = "review"
+	// AdoptConfirm updates the existing items that have previously been
+	// recorded as adoptable and records any new ones.
+	AdoptConfirm AdoptMode = "confirm"
+)
+
+var (
+	adoptMode AdoptMode
+	adoptM    sync.Mutex
+)
+
+// SetAdoptMode selects how existing items are adopted.
+func SetAdoptMode(mode AdoptMode) {
+	adoptMode = mode
+}
+
+// FilterAdoptable removes from toBeWritten the items whose key already exists
+// in the Vault instance but that haven't been confirmed for adoption, logging
+// how they differ and recording them as adoptable.
+//
+// Adoptable items are persisted in the file named by the ADOPT_STATE_FILE
+// environment variable, separately for every instance and namespace, and
+// forgotten once their adoption is confirmed. In dry-run mode, the items are
+// filtered as they would be but the file is left untouched, so that a dry run
+// never changes what the next run adopts.
+func FilterAdoptable(name string, toBeWritten, existing []Item, dryRun bool) ([]Item, error) {
+	if adoptMode == AdoptOff {
+		return toBeWritten, nil
+	}
+
+	adoptM.Lock()
+	defer adoptM.Unlock()
+
+	state, err := readAdoptState()
+	if err != nil {
+		return nil, err
+	}
+	scope := ScopeKey(name)
+	adoptable := make(map[string]bool)
+	for _, key := range state[scope] {
+		adoptable[key] = true
+	}
+
+	filtered := make([]Item, 0, len(toBeWritten))
+	adopted := make(map[string]bool)
+	recorded := false
+	for _, w := range toBeWritten {
+		e, ok := findItem(existing, w.Key())
+		if !ok {
+			filtered = append(filtered, w)
+			continue
+		}
+		if adoptMode == AdoptConfirm && adoptable[w.Key()] {
+			filtered = append(filtered, w)
+			adopted[w.Key()] = true
+			continue
+		}
+
+		fields := logrus.Fields{"name": name, "key": w.Key()}
+		if differ, ok := w.(FieldDiffer); ok {
+			fields["fields"] = differ.Differences(e)
+		}
+		logrus.WithFields(fields).Warn("existing entry differs from configuration; recorded as adoptable and left unchanged")
+		MarkDrift()
+
+		if !adoptable[w.Key()] {
+			adoptable[w.Key()] = true
+			state[scope] = append(state[scope], w.Key())
+			recorded = true
+		}
+	}
+
+	if dryRun || (!recorded && len(adopted) == 0) {
+		return filtered, nil
+	}
+	kept := make([]string, 0, len(state[scope]))
+	for _, key := range state[scope] {
+		if !adopted[key] {
+			kept = append(kept, key)
+		}
+	}
+	state[scope] = kept
+	if len(kept) == 0 {
+		delete(state, scope)
+	}
+	if err := writeAdoptState(state); err != nil {
+		return nil, err
+	}
+
+	return filtered, nil
+}
+
+func adoptStatePath() string {
+	return defaultGetenv("ADOPT_STATE_FILE", filepath.Join(os.TempDir(), "vault-manager-adopt.json"))
+}
+
+func readAdoptState() (map[string][]string, error) {
+	state := make(map[string][]string)
+
+	b, err := ioutil.ReadFile(adoptStatePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read adopt state from %s", adoptStatePath())
+	}
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode adopt state from %s", adoptStatePath())
+	}
+
+	return state, nil
+}
+
+func writeAdoptState(state map[string][]string) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode adopt state")
+	}
+
+	if err := ioutil.WriteFile(adoptStatePath(), b, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write adopt state to %s", adoptStatePath())
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterAdoptable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adopt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("ADOPT_STATE_FILE", filepath.Join(dir, "state.json"))
+	defer os.Unsetenv("ADOPT_STATE_FILE")
+	defer SetAdoptMode(AdoptOff)
+
+	existing := intoInterface([]item{{"x", "old"}})
+	toBeWritten := intoInterface([]item{{"x", "new"}, {"y", "y"}})
+
+	filter := func(name string, toBeWritten []Item) []Item {
+		filtered, err := FilterAdoptable(name, toBeWritten, existing, false)
+		require.NoError(t, err)
+		return filtered
+	}
+
+	SetAdoptMode(AdoptOff)
+	require.Equal(t, toBeWritten, filter("test", toBeWritten), "adopting is disabled")
+
+	SetAdoptMode(AdoptReview)
+	require.Equal(t, []item{{"y", "y"}}, outOfInterface(filter("test", toBeWritten)), "existing items are held back")
+	require.Equal(t, []item{{"y", "y"}}, outOfInterface(filter("test", toBeWritten)), "reviewing twice still holds back")
+
+	SetAdoptMode(AdoptConfirm)
+	require.Equal(t, toBeWritten, filter("test", toBeWritten), "reviewed items are adopted")
+	require.Equal(t, map[string][]string{}, readState(t), "adopted items are forgotten")
+	require.Equal(t, []item{}, outOfInterface(filter("other", toBeWritten[:1])), "unreviewed items are held back")
+
+	SetNamespace("team")
+	defer SetNamespace("")
+	require.Equal(t, []item{}, outOfInterface(filter("test", toBeWritten[:1])), "items reviewed in another namespace are held back")
+}
+
+func TestFilterAdoptableInDryRunLeavesTheStateUntouched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adopt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("ADOPT_STATE_FILE", filepath.Join(dir, "state.json"))
+	defer os.Unsetenv("ADOPT_STATE_FILE")
+	defer SetAdoptMode(AdoptOff)
+
+	existing := intoInterface([]item{{"x", "old"}})
+	toBeWritten := intoInterface([]item{{"x", "new"}})
+
+	SetAdoptMode(AdoptReview)
+	filtered, err := FilterAdoptable("test", toBeWritten, existing, true)
+	require.NoError(t, err)
+	require.Empty(t, filtered, "existing items are held back in dry-run mode too")
+	_, err = os.Stat(filepath.Join(dir, "state.json"))
+	require.True(t, os.IsNotExist(err), "a dry run records nothing")
+
+	_, err = FilterAdoptable("test", toBeWritten, existing, false)
+	require.NoError(t, err)
+
+	SetAdoptMode(AdoptConfirm)
+	filtered, err = FilterAdoptable("test", toBeWritten, existing, true)
+	require.NoError(t, err)
+	require.Equal(t, toBeWritten, filtered)
+	require.Equal(t, map[string][]string{"test": {"x"}}, readState(t), "a dry run forgets nothing")
+}
+
+func readState(t *testing.T) map[string][]string {
+	state, err := readAdoptState()
+	require.NoError(t, err)
+	return state
+}
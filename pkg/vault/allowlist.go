@@ -0,0 +1,69 @@
+package vault
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ryanuber/go-glob"
+)
+
+// allowlistTransport refuses any request modifying a Vault path that doesn't
+// match one of the allowed patterns, regardless of the token's capabilities.
+type allowlistTransport struct {
+	next     http.RoundTripper
+	patterns []string
+	// loginPath is where vault-manager logs in, if it does.
+	loginPath string
+}
+
+// alwaysAllowed holds the paths vault-manager writes to without changing the
+// state of the Vault instance, besides the one it logs in at.
+var alwaysAllowed = map[string]bool{
+	"sys/capabilities-self": true,
+}
+
+// allowlistFromEnv returns the path patterns configured through the
+// VAULT_PATH_ALLOWLIST environment variable as a comma-separated list of globs
+// (e.g. "sys/audit/*,sys/policies/acl/*"), or VAULT_PATH_ALLOWLIST_<INSTANCE>
+// for a named instance.
+//
+// An empty list means every path is allowed.
+func allowlistFromEnv() (patterns []string) {
+	for _, p := range strings.Split(os.Getenv(instanceEnvFallback("VAULT_PATH_ALLOWLIST")), ",") {
+		if p = strings.Trim(strings.TrimSpace(p), "/"); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return
+}
+
+func (t *allowlistTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete:
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/v1/"), "/")
+		if path != t.loginPath && !alwaysAllowed[path] && !PathAllowed(t.patterns, path) {
+			return nil, fmt.Errorf("path %q is not in the vault-manager path allowlist", path)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// PathAllowed reports whether the provided path matches any of the allowlist
+// patterns, where "*" matches any sequence of characters.
+//
+// An empty allowlist allows every path.
+func PathAllowed(patterns []string, path string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	path = strings.Trim(path, "/")
+	for _, p := range patterns {
+		if glob.Glob(strings.Trim(p, "/"), path) {
+			return true
+		}
+	}
+	return false
+}
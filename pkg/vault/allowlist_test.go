@@ -0,0 +1,53 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathAllowed(t *testing.T) {
+	table := []struct {
+		description string
+		patterns    []string
+		path        string
+		expected    bool
+	}{
+		{
+			description: "empty allowlist allows everything",
+			patterns:    nil,
+			path:        "sys/mounts/secret",
+			expected:    true,
+		},
+		{
+			description: "path matching a glob is allowed",
+			patterns:    []string{"sys/audit/*", "sys/policies/acl/*"},
+			path:        "sys/audit/file",
+			expected:    true,
+		},
+		{
+			description: "surrounding slashes are ignored",
+			patterns:    []string{"/sys/audit/*"},
+			path:        "/sys/audit/file/",
+			expected:    true,
+		},
+		{
+			description: "path outside of the allowlist is refused",
+			patterns:    []string{"sys/audit/*", "sys/policies/acl/*"},
+			path:        "sys/mounts/secret",
+			expected:    false,
+		},
+		{
+			description: "exact pattern only matches itself",
+			patterns:    []string{"sys/audit/file"},
+			path:        "sys/audit/file2",
+			expected:    false,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			require.Equal(t, tt.expected, PathAllowed(tt.patterns, tt.path))
+		})
+	}
+}
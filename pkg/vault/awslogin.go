@@ -0,0 +1,217 @@
+package vault
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// getCallerIdentityBody is the body of the sts:GetCallerIdentity request
+// signed to log in with the AWS auth method.
+const getCallerIdentityBody = "Action=GetCallerIdentity&Version=2011-06-15"
+
+// awsCredentials sign requests to AWS.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// awsLoginData returns the data logging in with the IAM method of the AWS auth
+// method as the role: an sts:GetCallerIdentity request signed with the
+// credentials of the environment, which Vault sends to AWS to identify
+// vault-manager.
+//
+// Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN or, when unset, obtained for the role AWS_ROLE_ARN with the
+// web identity token of AWS_WEB_IDENTITY_TOKEN_FILE, as set up for the service
+// accounts of EKS. The request is sent to the STS endpoint of VAULT_AWS_REGION
+// or to the global one, and carries VAULT_AWS_HEADER_VALUE, if set, as the
+// X-Vault-AWS-IAM-Server-ID header.
+func awsLoginData(ctx context.Context, role string) (map[string]interface{}, error) {
+	creds, err := awsCredentialsFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	region := defaultGetenv(instanceEnvFallback("VAULT_AWS_REGION"), "us-east-1")
+	req, err := http.NewRequest(http.MethodPost, stsEndpoint(region), strings.NewReader(getCallerIdentityBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if v := os.Getenv(instanceEnvFallback("VAULT_AWS_HEADER_VALUE")); v != "" {
+		req.Header.Set("X-Vault-AWS-IAM-Server-ID", v)
+	}
+	signAWSRequest(req, []byte(getCallerIdentityBody), creds, region, "sts", time.Now())
+
+	headers, err := json.Marshal(req.Header)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"role":                    role,
+		"iam_http_request_method": req.Method,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(req.URL.String())),
+		"iam_request_body":        base64.StdEncoding.EncodeToString([]byte(getCallerIdentityBody)),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+	}, nil
+}
+
+// stsEndpoint returns the STS endpoint of a region, the global one being in
+// us-east-1.
+func stsEndpoint(region string) string {
+	if region == "us-east-1" {
+		return "https://sts.amazonaws.com/"
+	}
+	return fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+}
+
+func awsCredentialsFromEnv(ctx context.Context) (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			accessKeyID:     id,
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	roleARN, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if roleARN == "" || tokenFile == "" {
+		return awsCredentials{}, errors.New("no AWS credentials: neither AWS_ACCESS_KEY_ID nor AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE are set")
+	}
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, errors.Wrap(err, "failed to read the web identity token")
+	}
+	return assumeRoleWithWebIdentity(ctx, stsEndpoint("us-east-1"), roleARN, strings.TrimSpace(string(token)))
+}
+
+// assumeRoleWithWebIdentity obtains temporary credentials for a role with a
+// web identity token, which doesn't need to be signed.
+func assumeRoleWithWebIdentity(ctx context.Context, endpoint, roleARN, token string) (awsCredentials, error) {
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {"vault-manager"},
+		"WebIdentityToken": {token},
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return awsCredentials{}, errors.Wrap(err, "failed to assume role with web identity")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, errors.Errorf("failed to assume role %s with web identity: %s", roleARN, resp.Status)
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return awsCredentials{}, errors.Wrap(err, "failed to decode the credentials of the assumed role")
+	}
+	return awsCredentials{
+		accessKeyID:     result.Credentials.AccessKeyID,
+		secretAccessKey: result.Credentials.SecretAccessKey,
+		sessionToken:    result.Credentials.SessionToken,
+	}, nil
+}
+
+// signAWSRequest signs a request with AWS Signature Version 4, setting its
+// X-Amz-Date, X-Amz-Security-Token and Authorization headers. Every header of
+// the request is signed, along with its host.
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		trimmed := make([]string, 0, len(values))
+		for _, v := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	date := amzDate[:8]
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + creds.secretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes a query string as AWS signs it, sorted and with
+// spaces encoded as %20.
+func canonicalQuery(query url.Values) string {
+	return strings.Replace(query.Encode(), "+", "%20", -1)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,54 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	// example of the AWS Signature Version 4 documentation
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	creds := awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	require.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	require.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", req.Header.Get("Authorization"))
+}
+
+func TestAssumeRoleWithWebIdentity(t *testing.T) {
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+		require.Equal(t, "arn:aws:iam::123456789012:role/vault-manager", r.Form.Get("RoleArn"))
+		require.Equal(t, "token", r.Form.Get("WebIdentityToken"))
+		w.Write([]byte(`<AssumeRoleWithWebIdentityResponse>
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer sts.Close()
+
+	creds, err := assumeRoleWithWebIdentity(context.Background(), sts.URL, "arn:aws:iam::123456789012:role/vault-manager", "token")
+	require.NoError(t, err)
+	require.Equal(t, awsCredentials{accessKeyID: "ASIAEXAMPLE", secretAccessKey: "secret", sessionToken: "session"}, creds)
+}
+
+func TestSTSEndpoint(t *testing.T) {
+	require.Equal(t, "https://sts.amazonaws.com/", stsEndpoint("us-east-1"))
+	require.Equal(t, "https://sts.eu-west-1.amazonaws.com/", stsEndpoint("eu-west-1"))
+}
@@ -3,11 +3,12 @@
 package vault
 
 import (
+	"context"
+	"net/http"
 	"os"
-	"strings"
 
 	"github.com/hashicorp/vault/api"
-	"github.com/sirupsen/logrus"
+	"github.com/pkg/errors"
 )
 
 /*
@@ -101,50 +102,107 @@ func (c *EnvClient) DisableSecretsEngine(path string) error {
 */
 
 // ClientFromEnv initializes a Vault client using the environment variables:
-// VAULT_ADDR, VAULT_ROLE_ID, VAULT_SECRET_ID, VAULT_TOKEN.
+// VAULT_ADDR and VAULT_AUTHTYPE, along with the credentials of the auth method
+// it selects: VAULT_ROLE_ID and VAULT_SECRET_ID for approle, the default,
+// VAULT_KUBERNETES_ROLE for kubernetes, VAULT_AWS_ROLE for aws and VAULT_TOKEN
+// for token.
+//
+// If VAULT_PATH_ALLOWLIST is set, the client refuses to write to or delete any
+// path outside of the allowlist. The client connects to the instance set by
+// SetInstance and is scoped to the namespace set by SetNamespace. Its requests
+// are limited to the rate set by SetRateLimit, retried as set by SetRetry,
+// traced as children of the span of the provided context and cancelled along
+// with it.
 //
 // Because individual tokens have usage limits, we re-authenticate for each new
 // client.
-func ClientFromEnv() *api.Client {
+func ClientFromEnv(ctx context.Context) (*api.Client, error) {
 	vaultCFG := api.DefaultConfig()
-	vaultCFG.Address = mustGetenv("VAULT_ADDR")
+	addr, err := mustGetenv(instanceEnv("VAULT_ADDR"))
+	if err != nil {
+		return nil, err
+	}
+	vaultCFG.Address = addr
+	loginPath, loginData, err := loginFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if limiter != nil {
+		vaultCFG.HttpClient.Transport = &rateLimitTransport{
+			next:    vaultCFG.HttpClient.Transport,
+			limiter: limiter,
+		}
+	}
+	// Requests are retried by retryTransport instead of the Vault API client,
+	// which would retry the ones retryTransport already retried.
+	vaultCFG.MaxRetries = 0
+	vaultCFG.HttpClient.Transport = &retryTransport{
+		next:     vaultCFG.HttpClient.Transport,
+		attempts: maxAttempts,
+		backoff:  retryBackoff,
+	}
+	vaultCFG.HttpClient.Transport = &tracingTransport{next: vaultCFG.HttpClient.Transport}
+	vaultCFG.HttpClient.Transport = &contextTransport{
+		next: vaultCFG.HttpClient.Transport,
+		ctx:  ctx,
+	}
+
+	if patterns := allowlistFromEnv(); len(patterns) > 0 {
+		vaultCFG.HttpClient.Transport = &allowlistTransport{
+			next:      vaultCFG.HttpClient.Transport,
+			patterns:  patterns,
+			loginPath: loginPath,
+		}
+	}
 
 	client, err := api.NewClient(vaultCFG)
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to initialize Vault client")
+		return nil, errors.Wrap(err, "failed to initialize Vault client")
 	}
 
-	switch authType := defaultGetenv("VAULT_AUTHTYPE", "approle"); strings.ToLower(authType) {
-	case "approle":
-		roleID := mustGetenv("VAULT_ROLE_ID")
-		secretID := mustGetenv("VAULT_SECRET_ID")
-
-		secret, err := client.Logical().Write("auth/approle/login", map[string]interface{}{
-			"role_id":   roleID,
-			"secret_id": secretID,
-		})
+	if loginPath == "" {
+		token, err := mustGetenv(instanceEnvFallback("VAULT_TOKEN"))
+		if err != nil {
+			return nil, err
+		}
+		client.SetToken(token)
+	} else {
+		secret, err := client.Logical().Write(loginPath, loginData)
 		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
-				"role":   roleID,
-				"secret": secretID,
-			}).Fatal("failed to login to Vault with AppRole")
+			return nil, errors.Wrapf(err, "failed to login to Vault at %s", loginPath)
+		}
+		if secret == nil || secret.Auth == nil {
+			return nil, errors.Errorf("failed to login to Vault at %s: no token was returned", loginPath)
 		}
 		client.SetToken(secret.Auth.ClientToken)
-	case "token":
-		client.SetToken(mustGetenv("VAULT_TOKEN"))
-	default:
-		logrus.WithField("authType", authType).Fatal("unsuported auth type")
 	}
 
-	return client
+	if namespace != "" {
+		client.SetNamespace(namespace)
+	}
+
+	return client, nil
+}
+
+// contextTransport sends requests with a context, since the Vault API client
+// doesn't accept one.
+type contextTransport struct {
+	next http.RoundTripper
+	ctx  context.Context
 }
 
-func mustGetenv(name string) string {
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
+
+// mustGetenv returns the value of an environment variable, or an error if it's
+// unset.
+func mustGetenv(name string) (string, error) {
 	env := os.Getenv(name)
 	if env == "" {
-		logrus.WithField("env", name).Fatal("required environment variable is unset")
+		return "", errors.Errorf("required environment variable %s is unset", name)
 	}
-	return env
+	return env, nil
 }
 
 func defaultGetenv(name, defaultName string) string {
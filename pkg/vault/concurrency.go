@@ -0,0 +1,104 @@
+package vault
+
+import (
+	"path"
+	"sync"
+)
+
+// concurrency is the number of items ForEach processes at once.
+var concurrency = 1
+
+// SetConcurrency sets the number of items processed at once by ForEach, which
+// processes them one after the other by default.
+func SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	concurrency = n
+}
+
+// Barrier is implemented by items that are processed on their own, after the
+// items before them and before the items after them, even if their parent path
+// is shared, e.g. the settings of a mount that its other settings require.
+type Barrier interface {
+	Barrier() bool
+}
+
+// ForEach calls fn for every item and returns the first error that occurs.
+//
+// Consecutive items whose keys share the same parent path, e.g. the roles of a
+// mount, are independent and up to the configured number of them are
+// processed at once, unless they are barriers. Other items are processed in
+// order, so that items can depend on the ones before them, e.g. the roles of a
+// database on its connections. No item is started anymore once an error has
+// occurred, but the ones already started are waited for.
+func ForEach(items []Item, fn func(Item) error) error {
+	if concurrency == 1 {
+		for _, i := range items {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for start := 0; start < len(items); {
+		end := start + 1
+		for end < len(items) && !barrier(items[start]) && !barrier(items[end]) &&
+			path.Dir(items[end].Key()) == path.Dir(items[start].Key()) {
+			end++
+		}
+		if err := forEachConcurrently(items[start:end], fn); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// barrier reports whether an item is processed on its own.
+func barrier(i Item) bool {
+	b, ok := i.(Barrier)
+	return ok && b.Barrier()
+}
+
+// forEachConcurrently calls fn for every item, processing up to the
+// configured number of items at once.
+func forEachConcurrently(items []Item, fn func(Item) error) error {
+	var (
+		wg       sync.WaitGroup
+		m        sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return firstErr != nil
+	}
+
+	workers := make(chan struct{}, concurrency)
+	for _, i := range items {
+		workers <- struct{}{}
+		if failed() {
+			<-workers
+			break
+		}
+
+		wg.Add(1)
+		go func(i Item) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			if err := fn(i); err != nil {
+				m.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				m.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return firstErr
+}
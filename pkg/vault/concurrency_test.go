@@ -0,0 +1,87 @@
+package vault
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEachProcessesEveryItem(t *testing.T) {
+	defer SetConcurrency(1)
+
+	for _, n := range []int{1, 4} {
+		SetConcurrency(n)
+
+		var m sync.Mutex
+		processed := make(map[string]bool)
+		err := ForEach([]Item{item{Name: "a"}, item{Name: "b"}, item{Name: "c"}}, func(i Item) error {
+			m.Lock()
+			defer m.Unlock()
+			processed[i.Key()] = true
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]bool{"a": true, "b": true, "c": true}, processed)
+	}
+}
+
+func TestForEachReturnsTheFirstError(t *testing.T) {
+	defer SetConcurrency(1)
+
+	for _, n := range []int{1, 4} {
+		SetConcurrency(n)
+
+		err := ForEach([]Item{item{Name: "a"}, item{Name: "b"}}, func(i Item) error {
+			return errors.New("failed to write " + i.Key())
+		})
+		require.Error(t, err)
+	}
+}
+
+func TestForEachKeepsTheOrderOfDependentItems(t *testing.T) {
+	defer SetConcurrency(1)
+	SetConcurrency(4)
+
+	var m sync.Mutex
+	var order []string
+	err := ForEach([]Item{item{Name: "db/config/a"}, item{Name: "db/config/b"}, item{Name: "db/roles/r"}}, func(i Item) error {
+		m.Lock()
+		defer m.Unlock()
+		order = append(order, i.Key())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "db/roles/r", order[2])
+}
+
+// barrierItem is an item processed on its own.
+type barrierItem struct {
+	item
+}
+
+func (barrierItem) Barrier() bool {
+	return true
+}
+
+func TestForEachProcessesBarriersOnTheirOwn(t *testing.T) {
+	defer SetConcurrency(1)
+	SetConcurrency(4)
+
+	var m sync.Mutex
+	var order []string
+	items := []Item{barrierItem{item{Name: "pki/config/cluster"}}, item{Name: "pki/config/acme"}, item{Name: "pki/config/urls"}}
+	err := ForEach(items, func(i Item) error {
+		if i.Key() == "pki/config/cluster" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		m.Lock()
+		defer m.Unlock()
+		order = append(order, i.Key())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "pki/config/cluster", order[0])
+}
@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"sync"
+	"time"
+)
+
+// Cooldowns holds back the changes to top-levels for a while once changes
+// were made to them, across runs.
+type Cooldowns interface {
+	// Remaining returns for how long changes to a top-level must still be
+	// held back in the current instance and namespace, or zero.
+	Remaining(name string) (time.Duration, error)
+	// Record persists that changes to a top-level are being made in the
+	// current instance and namespace.
+	Record(name string) error
+}
+
+// cooldowns holds back the changes of Reconcile and Act, when set, and
+// remaining holds for how long by scope for the run.
+var (
+	cooldowns  Cooldowns
+	remaining  = make(map[string]time.Duration)
+	cooldownsM sync.Mutex
+)
+
+// SetCooldowns makes Reconcile and Act hold back the changes to top-levels
+// during their cooldowns.
+func SetCooldowns(c Cooldowns) {
+	cooldownsM.Lock()
+	defer cooldownsM.Unlock()
+	cooldowns = c
+	remaining = make(map[string]time.Duration)
+}
+
+// cooldownFor returns for how long the changes to a top-level must still be
+// held back. It's only checked once per run for every instance and namespace,
+// so that the changes made by a top-level don't hold back its later ones.
+func cooldownFor(name string) (time.Duration, error) {
+	cooldownsM.Lock()
+	defer cooldownsM.Unlock()
+	if cooldowns == nil {
+		return 0, nil
+	}
+
+	key := ScopeKey(name)
+	if r, ok := remaining[key]; ok {
+		return r, nil
+	}
+	r, err := cooldowns.Remaining(name)
+	if err != nil {
+		return 0, err
+	}
+	remaining[key] = r
+	return r, nil
+}
+
+// recordCooldown records that changes to a top-level are being made.
+func recordCooldown(name string) error {
+	cooldownsM.Lock()
+	defer cooldownsM.Unlock()
+	if cooldowns == nil {
+		return nil
+	}
+	return cooldowns.Record(name)
+}
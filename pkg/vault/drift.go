@@ -0,0 +1,18 @@
+package vault
+
+import "sync/atomic"
+
+// drifted is non-zero once a change has been found.
+var drifted int32
+
+// MarkDrift records that the Vault instance differs from the configuration,
+// i.e. that a change is made or, in dry-run mode, would be made.
+func MarkDrift() {
+	atomic.StoreInt32(&drifted, 1)
+}
+
+// Drifted reports whether MarkDrift has been called, either directly or by
+// PlanChanges for top-levels with changes.
+func Drifted() bool {
+	return atomic.LoadInt32(&drifted) != 0
+}
@@ -0,0 +1,20 @@
+package vault
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanChangesMarksDrift(t *testing.T) {
+	atomic.StoreInt32(&drifted, 0)
+	defer atomic.StoreInt32(&drifted, 0)
+
+	existing := intoInterface([]item{{"x", "x"}})
+	require.NoError(t, PlanChanges("test", nil, nil, existing))
+	require.False(t, Drifted(), "nothing changes")
+
+	require.NoError(t, PlanChanges("test", nil, existing, existing))
+	require.True(t, Drifted(), "an item is deleted")
+}
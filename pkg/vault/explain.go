@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var explainTarget string
+
+// SetExplainTarget makes Explain report on the item identified by key.
+func SetExplainTarget(key string) {
+	explainTarget = key
+}
+
+// Explain logs, for the item selected with SetExplainTarget, its desired and
+// existing states, how each of its fields compares and what reconciling the
+// provided items decides to do with it. A change that Reconcile leaves out
+// after diffing, e.g. as it's outside of the path filter or held back by a
+// cooldown, is explained as skipped with the reason why.
+//
+// Nothing is logged if no target has been set.
+func Explain(name string, desired, existing []Item, left leftOut) {
+	if explainTarget == "" {
+		return
+	}
+
+	d, inDesired := findItem(desired, explainTarget)
+	e, inExisting := findItem(existing, explainTarget)
+	if !inDesired && !inExisting {
+		return
+	}
+
+	// a policy that can't be read is reported by the top-level before
+	// comparing items, every field is significant otherwise
+	policy, _ := FieldPolicyFor(name)
+	logf := func(format string, args ...interface{}) {
+		logrus.Infof("[Explain]\tname=%s\tkey=%s\t"+format, append([]interface{}{name, explainTarget}, args...)...)
+	}
+
+	if inDesired {
+		logf("desired='%+v'", d)
+	} else {
+		logf("desired=<none>")
+	}
+	if inExisting {
+		logf("existing='%+v'", e)
+	} else {
+		logf("existing=<none>")
+	}
+
+	var decision, reason string
+	switch {
+	case !inExisting:
+		decision, reason = "create", "not present in the Vault instance"
+	case !inDesired:
+		decision, reason = "delete", "not present in configuration"
+	case d.Equals(e):
+		if differ, ok := d.(FieldDiffer); ok {
+			for _, field := range differ.Differences(e) {
+				logf("field=%s\tresult=differs\tsensitivity=%s", field, policy.Of(field))
+			}
+		}
+		decision, reason = "no-op", "desired and existing states are equal"
+	default:
+		decision, reason = "update", "desired and existing states differ"
+		if differ, ok := d.(FieldDiffer); ok {
+			var significant []string
+			for _, field := range differ.Differences(e) {
+				sensitivity := policy.Of(field)
+				logf("field=%s\tresult=differs\tsensitivity=%s", field, sensitivity)
+				if sensitivity == Update {
+					significant = append(significant, field)
+				}
+			}
+			reason = "fields differ: " + strings.Join(significant, ", ")
+		}
+	}
+
+	if decision != "no-op" && left.reason != "" {
+		logf("decision=skip\treason='would %s (%s), but %s'", decision, reason, left.reason)
+		return
+	}
+	logf("decision=%s\treason='%s'", decision, reason)
+}
+
+// leftOut records why a stage of Reconcile left out the change of the
+// explained item, if any did.
+type leftOut struct {
+	reason string
+}
+
+// note records the reason why a stage filtering before into after left out
+// the explained item, unless an earlier stage already did.
+func (l *leftOut) note(before, after []Item, reason string) {
+	if explainTarget == "" || l.reason != "" {
+		return
+	}
+	if _, ok := findItem(before, explainTarget); !ok {
+		return
+	}
+	if _, ok := findItem(after, explainTarget); !ok {
+		l.reason = reason
+	}
+}
+
+func findItem(items []Item, key string) (Item, bool) {
+	for _, i := range items {
+		if EqualPathNames(i.Key(), key) {
+			return i, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,93 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainReportsWhatIsApplied(t *testing.T) {
+	var logs bytes.Buffer
+	defer logrus.SetOutput(logrus.StandardLogger().Out)
+	logrus.SetOutput(&logs)
+	SetExplainTarget("app")
+	defer SetExplainTarget("")
+
+	table := []struct {
+		description string
+		setup       func()
+		existing    []Item
+		decision    string
+	}{
+		{"change is applied", func() {}, []Item{item{"app", "old"}}, "decision=update"},
+		{"nothing changes", func() {}, []Item{item{"app", "new"}}, "decision=no-op"},
+		{
+			"change is outside of the path filter",
+			func() { SetPathFilter(nil, []string{"sys/mounts/app"}) },
+			[]Item{item{"app", "old"}},
+			"decision=skip\treason='would update (desired and existing states differ), but it changes paths outside of the path filter'",
+		},
+		{
+			"change is held back by a cooldown",
+			func() { SetCooldowns(&fakeCooldowns{remaining: time.Minute}) },
+			[]Item{item{"app", "old"}},
+			"decision=skip\treason='would update (desired and existing states differ), but changes are held back by cooldown for 1m0s'",
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			defer SetPathFilter(nil, nil)
+			defer SetCooldowns(nil)
+			tt.setup()
+			logs.Reset()
+
+			_, _, err := Reconcile(context.Background(), Changes{
+				Name:     "test_items",
+				Package:  "test",
+				Desired:  []Item{item{"app", "new"}},
+				Existing: tt.existing,
+				Operations: func(i Item, delete bool) []Operation {
+					return []Operation{WriteOperation(path.Join("sys/mounts", i.Key()), false)}
+				},
+			}, true)
+			require.NoError(t, err)
+
+			var decisions []string
+			for _, line := range strings.Split(logs.String(), "\n") {
+				if i := strings.Index(line, "decision="); i >= 0 {
+					decisions = append(decisions, strings.TrimSuffix(strings.Replace(line[i:], `\t`, "\t", -1), `"`))
+				}
+			}
+			require.Len(t, decisions, 1)
+			require.True(t, strings.HasPrefix(decisions[0], tt.decision), decisions[0])
+		})
+	}
+}
+
+func TestExplainReportsProtectedDeletions(t *testing.T) {
+	var logs bytes.Buffer
+	defer logrus.SetOutput(logrus.StandardLogger().Out)
+	logrus.SetOutput(&logs)
+	SetExplainTarget("app")
+	defer SetExplainTarget("")
+	SetProtectedPaths([]string{"app"})
+	defer SetProtectedPaths(nil)
+
+	_, _, err := Reconcile(context.Background(), Changes{
+		Name:     "test_items",
+		Package:  "test",
+		Existing: []Item{item{"app", "old"}},
+		Operations: func(i Item, delete bool) []Operation {
+			return []Operation{DeleteOperation(i.Key(), false)}
+		},
+	}, true)
+	require.NoError(t, err)
+	require.Contains(t, strings.Replace(logs.String(), `\t`, "\t", -1), "decision=skip\treason='would delete (not present in configuration), but the path is protected'")
+}
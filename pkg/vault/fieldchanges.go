@@ -0,0 +1,73 @@
+package vault
+
+import (
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces the values of secret fields when they are logged.
+const Redacted = "<redacted>"
+
+// secretFields lists the names of fields whose values are never logged.
+var secretFields = map[string]bool{
+	"bindpass":      true,
+	"client_secret": true,
+	"credentials":   true,
+	"hmac_key":      true,
+	"password":      true,
+	"private_key":   true,
+	"secret":        true,
+	"secret_id":     true,
+	"secret_key":    true,
+	"token":         true,
+}
+
+// FieldValuer is an Item able to report the values of the fields listed by
+// its Differences.
+type FieldValuer interface {
+	FieldDiffer
+	FieldValue(field string) interface{}
+}
+
+// LogFieldChanges logs, for an item to be written, how each of its fields
+// differs from the existing item with the same key, before and after the
+// change. The values of secret fields are redacted.
+//
+// Nothing is logged for items that don't exist yet or can't report the values
+// of their fields.
+func LogFieldChanges(pkg string, w Item, existing []Item) {
+	desired, ok := w.(FieldValuer)
+	if !ok {
+		return
+	}
+	e, ok := findItem(existing, w.Key())
+	if !ok {
+		return
+	}
+	current, ok := e.(FieldValuer)
+	if !ok {
+		return
+	}
+
+	for _, field := range desired.Differences(e) {
+		before, after := current.FieldValue(field), desired.FieldValue(field)
+		if isSecretField(field) {
+			before, after = Redacted, Redacted
+		}
+		logrus.Infof("[Dry Run]\tpackage=%s\tkey=%s\tfield=%s\tbefore='%v'\tafter='%v'", pkg, w.Key(), field, before, after)
+	}
+}
+
+// isSecretField reports whether a field, such as "options.password", holds a
+// secret.
+func isSecretField(field string) bool {
+	name := strings.ToLower(path.Ext(field))
+	if name == "" {
+		name = strings.ToLower(field)
+	} else {
+		name = name[1:]
+	}
+	return secretFields[name] || strings.HasSuffix(name, "_password") || strings.HasSuffix(name, "_secret")
+}
@@ -0,0 +1,23 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSecretField(t *testing.T) {
+	for field, secret := range map[string]bool{
+		"password":         true,
+		"options.password": true,
+		"bind_password":    true,
+		"client_secret":    true,
+		"secret_id":        true,
+		"secret_id_ttl":    false,
+		"token_ttl":        false,
+		"options.format":   false,
+		"description":      false,
+	} {
+		require.Equal(t, secret, isSecretField(field), field)
+	}
+}
@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Sensitivity describes how a difference in a single field between the
+// configuration and a Vault instance is handled.
+type Sensitivity string
+
+const (
+	// Update makes a difference trigger an update. This is the default.
+	Update Sensitivity = "update"
+	// Warn only reports a difference.
+	Warn Sensitivity = "warn"
+	// Ignore disregards a difference entirely.
+	Ignore Sensitivity = "ignore"
+)
+
+// FieldPolicy maps field names, such as "description" or "options.format", to
+// their Sensitivity.
+type FieldPolicy map[string]Sensitivity
+
+// Of returns the Sensitivity of a field, defaulting to Update.
+func (p FieldPolicy) Of(field string) Sensitivity {
+	if s, ok := p[field]; ok {
+		return s
+	}
+	return Update
+}
+
+// Significant reports whether any of the provided differing fields must
+// trigger an update.
+func (p FieldPolicy) Significant(fields []string) bool {
+	for _, f := range fields {
+		if p.Of(f) == Update {
+			return true
+		}
+	}
+	return false
+}
+
+// Warnings returns those of the provided differing fields that must only be
+// reported.
+func (p FieldPolicy) Warnings(fields []string) (warnings []string) {
+	for _, f := range fields {
+		if p.Of(f) == Warn {
+			warnings = append(warnings, f)
+		}
+	}
+	return
+}
+
+// FieldDiffer is an Item able to list the fields differing from another Item.
+type FieldDiffer interface {
+	Item
+	Differences(interface{}) []string
+}
+
+var (
+	fieldPolicies     map[string]FieldPolicy
+	fieldPoliciesErr  error
+	fieldPoliciesOnce sync.Once
+)
+
+// FieldPolicyFor returns the FieldPolicy of a top-level configuration.
+//
+// Policies are read from the YAML file named by the DIFF_POLICY_FILE
+// environment variable, which maps top-level names to field policies. Without
+// it, every field is significant.
+func FieldPolicyFor(name string) (FieldPolicy, error) {
+	fieldPoliciesOnce.Do(func() {
+		fieldPolicies, fieldPoliciesErr = readFieldPolicies(os.Getenv("DIFF_POLICY_FILE"))
+	})
+	if fieldPoliciesErr != nil {
+		return nil, fieldPoliciesErr
+	}
+	return fieldPolicies[name], nil
+}
+
+func readFieldPolicies(path string) (map[string]FieldPolicy, error) {
+	policies := make(map[string]FieldPolicy)
+	if path == "" {
+		return policies, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read diff policy file %s", path)
+	}
+	if err := yaml.Unmarshal(b, &policies); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode diff policy file %s", path)
+	}
+
+	for topLevel, policy := range policies {
+		for field, s := range policy {
+			if s != Update && s != Warn && s != Ignore {
+				return nil, errors.Errorf("unknown diff sensitivity %q of field %s of %s in %s", s, field, topLevel, path)
+			}
+		}
+	}
+	return policies, nil
+}
+
+// WarnDrift logs every field of the desired items that differs from the
+// existing item with the same key but is only reported by the policy.
+func WarnDrift(policy FieldPolicy, desired, existing []Item) {
+	for _, d := range desired {
+		differ, ok := d.(FieldDiffer)
+		if !ok {
+			continue
+		}
+		for _, e := range existing {
+			if !EqualPathNames(d.Key(), e.Key()) {
+				continue
+			}
+			for _, field := range policy.Warnings(differ.Differences(e)) {
+				logrus.WithFields(logrus.Fields{
+					"key":   d.Key(),
+					"field": field,
+				}).Warn("field differs from configuration but is not updated")
+			}
+		}
+	}
+}
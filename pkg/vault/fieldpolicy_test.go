@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldPolicy(t *testing.T) {
+	policy := FieldPolicy{
+		"description":    Warn,
+		"options.format": Update,
+		"options.prefix": Ignore,
+	}
+
+	table := []struct {
+		description string
+		fields      []string
+		significant bool
+		warnings    []string
+	}{
+		{
+			description: "no differences",
+			fields:      nil,
+			significant: false,
+			warnings:    nil,
+		},
+		{
+			description: "fields missing from the policy trigger an update",
+			fields:      []string{"type"},
+			significant: true,
+			warnings:    nil,
+		},
+		{
+			description: "warn-only fields are reported but not significant",
+			fields:      []string{"description", "options.prefix"},
+			significant: false,
+			warnings:    []string{"description"},
+		},
+		{
+			description: "update fields are significant",
+			fields:      []string{"description", "options.format"},
+			significant: true,
+			warnings:    []string{"description"},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			require.Equal(t, tt.significant, policy.Significant(tt.fields))
+			require.Equal(t, tt.warnings, policy.Warnings(tt.fields))
+		})
+	}
+}
+
+func TestOptionsDiff(t *testing.T) {
+	x := map[string]interface{}{"a": "1", "b": "2", "token_ttl": "60s"}
+	y := map[string]interface{}{"b": "3", "c": "4", "token_ttl": "1m"}
+
+	require.Equal(t, []string{"a", "b", "c"}, OptionsDiff(x, y))
+}
@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// instance is the Vault instance the clients returned by ClientFromEnv connect
+// to, the one configured by VAULT_ADDR when empty.
+var instance string
+
+// SetInstance makes the clients returned by ClientFromEnv connect to a named
+// Vault instance, or to the default one when empty.
+//
+// A named instance is configured by the environment variables of the default
+// one suffixed with its name in upper case, e.g. VAULT_ADDR_DR for the
+// instance dr. Its other variables fall back to those of the default instance
+// when unset, but its address doesn't, so that entries of an instance are
+// never applied to another one.
+func SetInstance(name string) {
+	instance = name
+}
+
+// Instance returns the Vault instance the clients returned by ClientFromEnv
+// connect to.
+func Instance() string {
+	return instance
+}
+
+// instanceEnv returns the name of the environment variable configuring the
+// current instance in place of the provided one of the default instance.
+func instanceEnv(name string) string {
+	if instance == "" {
+		return name
+	}
+	suffix := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, instance)
+	return name + "_" + suffix
+}
+
+// instanceEnvFallback returns the name of the environment variable configuring
+// the current instance if set, or the provided one of the default instance.
+func instanceEnvFallback(name string) string {
+	if env := instanceEnv(name); os.Getenv(env) != "" {
+		return env
+	}
+	return name
+}
+
+// ScopeKey identifies a top-level applied in the current instance and
+// namespace, e.g. "dr:team-a/vault_policies".
+func ScopeKey(name string) string {
+	key := path.Join(namespace, name)
+	if instance != "" {
+		key = instance + ":" + key
+	}
+	return key
+}
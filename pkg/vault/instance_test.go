@@ -0,0 +1,26 @@
+package vault
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceEnv(t *testing.T) {
+	defer SetInstance("")
+
+	require.Equal(t, "VAULT_ADDR", instanceEnv("VAULT_ADDR"))
+	SetInstance("us-east.dr")
+	require.Equal(t, "VAULT_ADDR_US_EAST_DR", instanceEnv("VAULT_ADDR"))
+}
+
+func TestInstanceEnvFallback(t *testing.T) {
+	defer SetInstance("")
+	defer os.Unsetenv("VAULT_TOKEN_DR")
+
+	SetInstance("dr")
+	require.Equal(t, "VAULT_TOKEN", instanceEnvFallback("VAULT_TOKEN"), "unset variables fall back to the default instance")
+	os.Setenv("VAULT_TOKEN_DR", "token")
+	require.Equal(t, "VAULT_TOKEN_DR", instanceEnvFallback("VAULT_TOKEN"))
+}
@@ -0,0 +1,70 @@
+package vault
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// kubernetesTokenPath is where Kubernetes mounts the token of the service
+// account of a pod.
+const kubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// loginFromEnv returns where vault-manager logs in with the auth method
+// selected by VAULT_AUTHTYPE, and the data it logs in with. The path is empty
+// when using a token, which doesn't log in.
+//
+// Auth methods are expected to be mounted at their default path, unless
+// VAULT_AUTH_PATH is set.
+func loginFromEnv(ctx context.Context) (string, map[string]interface{}, error) {
+	authType := strings.ToLower(defaultGetenv(instanceEnvFallback("VAULT_AUTHTYPE"), "approle"))
+
+	var data map[string]interface{}
+	switch authType {
+	case "token":
+		return "", nil, nil
+	case "approle":
+		roleID, err := mustGetenv(instanceEnvFallback("VAULT_ROLE_ID"))
+		if err != nil {
+			return "", nil, err
+		}
+		secretID, err := mustGetenv(instanceEnvFallback("VAULT_SECRET_ID"))
+		if err != nil {
+			return "", nil, err
+		}
+		data = map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": secretID,
+		}
+	case "kubernetes":
+		role, err := mustGetenv(instanceEnvFallback("VAULT_KUBERNETES_ROLE"))
+		if err != nil {
+			return "", nil, err
+		}
+		file := defaultGetenv(instanceEnvFallback("VAULT_KUBERNETES_TOKEN_PATH"), kubernetesTokenPath)
+		jwt, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "failed to read the Kubernetes service account token")
+		}
+		data = map[string]interface{}{
+			"role": role,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		}
+	case "aws":
+		role, err := mustGetenv(instanceEnvFallback("VAULT_AWS_ROLE"))
+		if err != nil {
+			return "", nil, err
+		}
+		if data, err = awsLoginData(ctx, role); err != nil {
+			return "", nil, errors.Wrap(err, "failed to sign the AWS IAM login request")
+		}
+	default:
+		return "", nil, errors.Errorf("unsupported auth type %s", authType)
+	}
+
+	mount := strings.Trim(defaultGetenv(instanceEnvFallback("VAULT_AUTH_PATH"), authType), "/")
+	return path.Join("auth", mount, "login"), data, nil
+}
@@ -0,0 +1,54 @@
+package vault
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "login")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	token := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(token, []byte("jwt\n"), 0600))
+
+	env := map[string]string{
+		"VAULT_AUTHTYPE":              "kubernetes",
+		"VAULT_KUBERNETES_ROLE":       "vault-manager",
+		"VAULT_KUBERNETES_TOKEN_PATH": token,
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	path, data, err := loginFromEnv(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "auth/kubernetes/login", path)
+	require.Equal(t, map[string]interface{}{"role": "vault-manager", "jwt": "jwt"}, data)
+
+	os.Setenv("VAULT_AUTH_PATH", "/k8s/prod/")
+	defer os.Unsetenv("VAULT_AUTH_PATH")
+	path, _, err = loginFromEnv(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "auth/k8s/prod/login", path, "auth methods can be mounted elsewhere")
+
+	os.Setenv("VAULT_AUTHTYPE", "token")
+	path, data, err = loginFromEnv(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "", path, "tokens don't log in")
+	require.Nil(t, data)
+
+	os.Setenv("VAULT_AUTHTYPE", "ldap")
+	_, _, err = loginFromEnv(context.Background())
+	require.Error(t, err, "unsupported auth types are reported")
+
+	os.Setenv("VAULT_AUTHTYPE", "approle")
+	_, _, err = loginFromEnv(context.Background())
+	require.Error(t, err, "missing credentials are reported")
+}
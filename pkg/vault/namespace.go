@@ -0,0 +1,38 @@
+package vault
+
+// namespace is the Vault Enterprise namespace of the clients returned by
+// ClientFromEnv, the root namespace when empty.
+var namespace string
+
+// SetNamespace scopes the clients returned by ClientFromEnv to a Vault
+// Enterprise namespace, or to the root namespace when empty.
+//
+// Clients still authenticate in the namespace configured by VAULT_NAMESPACE,
+// if any.
+func SetNamespace(ns string) {
+	namespace = ns
+}
+
+// Namespace returns the namespace of the clients returned by ClientFromEnv.
+func Namespace() string {
+	return namespace
+}
+
+// namespaceFilter restricts the namespaces that are reconciled.
+var namespaceFilter []string
+
+// SetNamespaceFilter restricts the namespaces that are reconciled to the ones
+// whose path matches one of the patterns, if any, where "*" matches any
+// sequence of characters, e.g. "team-*". The root namespace has an empty path,
+// only matched by "*".
+//
+// Nothing is changed in the other namespaces, which are never pruned either.
+func SetNamespaceFilter(patterns []string) {
+	namespaceFilter = patterns
+}
+
+// NamespaceManaged reports whether the namespace with the provided path is
+// reconciled.
+func NamespaceManaged(ns string) bool {
+	return PathAllowed(namespaceFilter, ns)
+}
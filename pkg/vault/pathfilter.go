@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// includedPaths and excludedPaths restrict the changes made by Reconcile and
+// Act.
+var includedPaths, excludedPaths []string
+
+// SetPathFilter restricts the changes to the ones whose Vault paths all match
+// one of the included patterns, if any, and none of the excluded ones.
+// Patterns are globs where "*" matches any sequence of characters, e.g.
+// "sys/mounts/app-*".
+//
+// The other items are left untouched, whether they are declared or not, and
+// the other actions aren't performed.
+func SetPathFilter(include, exclude []string) {
+	includedPaths, excludedPaths = include, exclude
+}
+
+// Managed reports whether changes can be made to the provided Vault path.
+func Managed(key string) bool {
+	if !PathAllowed(includedPaths, key) {
+		return false
+	}
+	return len(excludedPaths) == 0 || !PathAllowed(excludedPaths, key)
+}
+
+// managedOperations reports whether the path of every operation is managed.
+func managedOperations(ops []Operation) bool {
+	for _, op := range ops {
+		if !Managed(op.Path) {
+			return false
+		}
+	}
+	return true
+}
+
+// managedItems filters out the items that are left untouched by the path
+// filter, given the operations writing, or deleting, them.
+func managedItems(items []Item, delete bool, operations func(Item, bool) []Operation) []Item {
+	operation := "writing it"
+	if delete {
+		operation = "deleting it"
+	}
+
+	managed := make([]Item, 0, len(items))
+	for _, i := range items {
+		if !managedOperations(operations(i, delete)) {
+			logrus.WithField("key", i.Key()).Debugf("leaving entry outside of the managed paths untouched instead of %s", operation)
+			continue
+		}
+		managed = append(managed, i)
+	}
+	return managed
+}
+
+// managedActions filters out the actions changing paths outside of the path
+// filter.
+func managedActions(actions []Action) []Action {
+	managed := make([]Action, 0, len(actions))
+	for _, a := range actions {
+		if !managedOperations(a.Operations) {
+			logrus.WithField("key", a.Key).Debugf("not performing action outside of the managed paths: %s", a.Name)
+			continue
+		}
+		managed = append(managed, a)
+	}
+	return managed
+}
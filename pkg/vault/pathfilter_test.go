@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManaged(t *testing.T) {
+	defer SetPathFilter(nil, nil)
+
+	require.True(t, Managed("app-a/"))
+
+	SetPathFilter([]string{"app-*"}, nil)
+	require.True(t, Managed("app-a/"))
+	require.True(t, Managed("app-a/roles/r"))
+	require.True(t, Managed("/app-a/"))
+	require.False(t, Managed("infra/"))
+
+	SetPathFilter([]string{"app-*"}, []string{"app-legacy/*"})
+	require.True(t, Managed("app-a/"))
+	require.False(t, Managed("app-legacy/roles/r"))
+
+	SetPathFilter(nil, []string{"infra/"})
+	require.True(t, Managed("app-a/"))
+	require.False(t, Managed("infra/"))
+}
+
+func TestReconcileLeavesUnmanagedItemsUntouched(t *testing.T) {
+	defer SetPathFilter(nil, nil)
+	SetPathFilter([]string{"sys/mounts/app-*"}, nil)
+
+	toBeWritten, toBeDeleted, err := Reconcile(context.Background(), Changes{
+		Name:     "test_items",
+		Package:  "test",
+		Desired:  []Item{item{Name: "app-a", Data: "new"}, item{Name: "infra", Data: "new"}},
+		Existing: []Item{item{Name: "app-a", Data: "old"}, item{Name: "app-b"}, item{Name: "manual"}},
+		Operations: func(i Item, delete bool) []Operation {
+			p := path.Join("sys/mounts", i.Key())
+			if delete {
+				return []Operation{DeleteOperation(p, false)}
+			}
+			// Writing also tunes the mount, which must be managed too.
+			return []Operation{WriteOperation(p, false), WriteOperation(path.Join(p, "tune"), false)}
+		},
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, []Item{item{Name: "app-a", Data: "new"}}, toBeWritten)
+	require.Equal(t, []Item{item{Name: "app-b"}}, toBeDeleted)
+}
+
+func TestManagedActions(t *testing.T) {
+	defer SetPathFilter(nil, nil)
+	SetPathFilter([]string{"database/*"}, []string{"database/rotate-role/manual"})
+
+	actions := make([]Action, 0)
+	for _, p := range []string{"database/rotate-role/app", "database/rotate-role/manual", "auth/token/roles/app"} {
+		actions = append(actions, Action{Name: "rotate", Key: p, Operations: []Operation{WriteOperation(p, false)}})
+	}
+	require.Equal(t, actions[:1], managedActions(actions))
+}
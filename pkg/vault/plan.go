@@ -0,0 +1,349 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// plannedChange is an item written or deleted by a plan.
+type plannedChange struct {
+	Key string `json:"key"`
+	// Update is true if the item already exists.
+	Update bool `json:"update,omitempty"`
+	// Fields lists the fields of an existing item that differ from its
+	// configuration.
+	Fields []string `json:"fields,omitempty"`
+	// Digest identifies the desired state of a written item.
+	Digest string `json:"digest,omitempty"`
+}
+
+// plannedAction is an action performed by a plan.
+type plannedAction struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// Digest identifies the state written by the action, if any.
+	Digest string `json:"digest,omitempty"`
+}
+
+// plannedChanges are the changes of a top-level in an instance and namespace.
+type plannedChanges struct {
+	Write   []plannedChange `json:"write"`
+	Delete  []plannedChange `json:"delete"`
+	Actions []plannedAction `json:"actions,omitempty"`
+	// Findings are only reported, they aren't part of the plan.
+	Findings []string `json:"-"`
+}
+
+var (
+	// recorded holds the changes recorded by PlanChanges while recording, and
+	// recordedOrder the order they were computed in.
+	recording     bool
+	recorded      = make(map[string]plannedChanges)
+	recordedOrder []string
+	// plan holds the changes expected by PlanChanges, if loaded, and planID
+	// identifies it.
+	plan   map[string]plannedChanges
+	planID string
+	planM  sync.Mutex
+)
+
+// RecordChanges makes PlanChanges record the changes of every top-level, to be
+// saved with SavePlan or reported with WriteReport.
+func RecordChanges() {
+	planM.Lock()
+	defer planM.Unlock()
+
+	recording = true
+	recorded = make(map[string]plannedChanges)
+	recordedOrder = nil
+}
+
+// LoadPlan reads a plan saved by SavePlan and makes PlanChanges check the
+// changes of every top-level against it.
+func LoadPlan(file string) error {
+	planM.Lock()
+	defer planM.Unlock()
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read plan from %s", file)
+	}
+	loaded := make(map[string]plannedChanges)
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		return errors.Wrapf(err, "failed to decode plan from %s", file)
+	}
+	id, err := identify(loaded)
+	if err != nil {
+		return err
+	}
+
+	plan, planID = loaded, id
+	return nil
+}
+
+// SavePlan writes the recorded plan to a file and returns its ID.
+func SavePlan(file string) (string, error) {
+	planM.Lock()
+	defer planM.Unlock()
+
+	saved := recordedPlan()
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode plan")
+	}
+	id, err := identify(saved)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(file, b, 0600); err != nil {
+		return "", errors.Wrapf(err, "failed to write plan to %s", file)
+	}
+	return id, nil
+}
+
+// AppliedPlanID returns the ID of the loaded plan, if any.
+func AppliedPlanID() string {
+	planM.Lock()
+	defer planM.Unlock()
+
+	return planID
+}
+
+// identify returns the ID of a plan, the digest of its JSON encoding, which
+// sorts the keys of maps, so that identical plans have the same ID.
+func identify(p map[string]plannedChanges) (string, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode plan")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// recordedPlan returns the recorded changes, leaving out the top-levels that
+// only reported findings.
+func recordedPlan() map[string]plannedChanges {
+	p := make(map[string]plannedChanges, len(recorded))
+	for key, changes := range recorded {
+		if len(changes.Write)+len(changes.Delete)+len(changes.Actions) > 0 {
+			p[key] = changes
+		}
+	}
+	return p
+}
+
+// PlanChanges records the changes of a top-level in the current instance and
+// namespace, or checks that they are exactly the ones of the loaded plan.
+// Top-levels missing from the plan are expected not to change anything.
+//
+// Changes that differ from the plan mean that the configuration or the Vault
+// instance changed since it was made, and are reported as an error. Any change
+// is also recorded as drift.
+func PlanChanges(name string, toBeWritten, toBeDeleted, existing []Item) error {
+	if len(toBeWritten)+len(toBeDeleted) > 0 {
+		MarkDrift()
+	}
+
+	planM.Lock()
+	defer planM.Unlock()
+
+	if !recording && plan == nil {
+		return nil
+	}
+
+	key := ScopeKey(name)
+	changes, err := planned(toBeWritten, toBeDeleted, existing)
+	if err != nil {
+		return err
+	}
+
+	if recording && len(changes.Write)+len(changes.Delete) > 0 {
+		r := record(key)
+		r.Write, r.Delete = changes.Write, changes.Delete
+		recorded[key] = r
+	}
+	if plan == nil {
+		return nil
+	}
+
+	expected := plan[key]
+	if !samePlan(expected.Write, changes.Write) || !samePlan(expected.Delete, changes.Delete) {
+		return errors.Errorf("changes of %s differ from the plan; the configuration or the Vault instance changed since it was made", key)
+	}
+	return nil
+}
+
+// PlanActions records the actions of a top-level in the current instance and
+// namespace, or checks that they are exactly the ones of the loaded plan, like
+// PlanChanges does with the items of the top-level. Any action is also
+// recorded as drift.
+func PlanActions(name string, actions []Action) error {
+	if len(actions) > 0 {
+		MarkDrift()
+	}
+
+	planM.Lock()
+	defer planM.Unlock()
+
+	if !recording && plan == nil {
+		return nil
+	}
+
+	key := ScopeKey(name)
+	planned := make([]plannedAction, 0, len(actions))
+	for _, a := range actions {
+		p := plannedAction{Name: a.Name, Key: a.Key}
+		if a.Data != nil {
+			d, err := digestFields(a.Key, a.Data)
+			if err != nil {
+				return err
+			}
+			p.Digest = d
+		}
+		planned = append(planned, p)
+	}
+	sort.Slice(planned, func(i, j int) bool {
+		if planned[i].Key != planned[j].Key {
+			return planned[i].Key < planned[j].Key
+		}
+		return planned[i].Name < planned[j].Name
+	})
+
+	if recording && len(planned) > 0 {
+		r := record(key)
+		r.Actions = planned
+		recorded[key] = r
+	}
+	if plan == nil {
+		return nil
+	}
+
+	if !samePlan(plan[key].Actions, planned) {
+		return errors.Errorf("actions of %s differ from the plan; the configuration or the Vault instance changed since it was made", key)
+	}
+	return nil
+}
+
+// record returns the changes recorded for a key, remembering the order it was
+// first recorded in.
+func record(key string) plannedChanges {
+	r, ok := recorded[key]
+	if !ok {
+		recordedOrder = append(recordedOrder, key)
+	}
+	return r
+}
+
+func planned(toBeWritten, toBeDeleted, existing []Item) (plannedChanges, error) {
+	changes := plannedChanges{
+		Write:  make([]plannedChange, 0, len(toBeWritten)),
+		Delete: make([]plannedChange, 0, len(toBeDeleted)),
+	}
+	for _, w := range toBeWritten {
+		d, err := digest(w)
+		if err != nil {
+			return plannedChanges{}, err
+		}
+		c := plannedChange{Key: w.Key(), Digest: d}
+		if e, ok := findItem(existing, w.Key()); ok {
+			c.Update = true
+			if differ, ok := w.(FieldDiffer); ok {
+				c.Fields = differ.Differences(e)
+				sort.Strings(c.Fields)
+			}
+		}
+		changes.Write = append(changes.Write, c)
+	}
+	for _, d := range toBeDeleted {
+		changes.Delete = append(changes.Delete, plannedChange{Key: d.Key()})
+	}
+
+	sort.Slice(changes.Write, func(i, j int) bool { return changes.Write[i].Key < changes.Write[j].Key })
+	sort.Slice(changes.Delete, func(i, j int) bool { return changes.Delete[i].Key < changes.Delete[j].Key })
+	return changes, nil
+}
+
+// Digester is an Item that reports the fields compared by Equals, for plans to
+// digest in place of its declared fields.
+type Digester interface {
+	DigestFields() map[string]interface{}
+}
+
+// digest identifies the compared state of an item, without revealing it.
+//
+// The fields are encoded as JSON, which sorts the keys of maps, and secret
+// fields are left out.
+func digest(i Item) (string, error) {
+	if d, ok := i.(Digester); ok {
+		return digestFields(i.Key(), d.DigestFields())
+	}
+
+	// the fields of an item are the ones declared in its configuration
+	var fields interface{}
+	b, err := yaml.Marshal(i)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to digest %s", i.Key())
+	}
+	if err := yaml.Unmarshal(b, &fields); err != nil {
+		return "", errors.Wrapf(err, "failed to digest %s", i.Key())
+	}
+	return digestFields(i.Key(), fields)
+}
+
+func digestFields(key string, fields interface{}) (string, error) {
+	b, err := json.Marshal(withoutSecretFields(fields))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to digest %s", key)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// withoutSecretFields returns a copy of a value decoded from YAML or JSON with
+// string keys, leaving out the secret fields of its maps.
+func withoutSecretFields(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			if name := fmt.Sprintf("%v", k); !isSecretField(name) {
+				m[name] = withoutSecretFields(x)
+			}
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			if !isSecretField(k) {
+				m[k] = withoutSecretFields(x)
+			}
+		}
+		return m
+	case []interface{}:
+		xs := make([]interface{}, 0, len(v))
+		for _, x := range v {
+			xs = append(xs, withoutSecretFields(x))
+		}
+		return xs
+	default:
+		return v
+	}
+}
+
+// samePlan compares planned changes or actions, a top-level missing from the
+// plan being expected not to change anything.
+func samePlan(expected, actual interface{}) bool {
+	x, _ := json.Marshal(expected)
+	y, _ := json.Marshal(actual)
+	return string(x) == string(y) || (isEmptyPlan(x) && isEmptyPlan(y))
+}
+
+func isEmptyPlan(b []byte) bool {
+	return string(b) == "null" || string(b) == "[]"
+}
@@ -0,0 +1,126 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { recording, plan, planID = false, nil, "" }()
+
+	file := filepath.Join(dir, "plan.json")
+	existing := intoInterface([]item{{"x", "old"}, {"z", "z"}})
+	toBeWritten := intoInterface([]item{{"x", "new"}, {"y", "y"}})
+	toBeDeleted := intoInterface([]item{{"z", "z"}})
+
+	RecordChanges()
+	require.NoError(t, PlanChanges("test", toBeWritten, toBeDeleted, existing))
+	require.NoError(t, PlanChanges("unchanged", nil, nil, existing))
+	id, err := SavePlan(file)
+	require.NoError(t, err)
+
+	recording = false
+	require.NoError(t, LoadPlan(file))
+	require.Equal(t, id, AppliedPlanID(), "the loaded plan has the ID it was saved with")
+	require.NoError(t, PlanChanges("test", toBeWritten, toBeDeleted, existing), "planned changes are applied")
+	require.NoError(t, PlanChanges("unchanged", nil, nil, existing), "top-levels without changes are left out")
+	require.Error(t, PlanChanges("test", intoInterface([]item{{"x", "newer"}, {"y", "y"}}), toBeDeleted, existing), "written items changed")
+	require.Error(t, PlanChanges("test", toBeWritten, nil, existing), "deleted items changed")
+	require.Error(t, PlanChanges("unchanged", toBeDeleted, nil, existing), "unplanned changes")
+
+	SetNamespace("team-a")
+	defer SetNamespace("")
+	require.Error(t, PlanChanges("test", toBeWritten, toBeDeleted, existing), "changes are planned by namespace")
+
+	SetInstance("dr")
+	defer SetInstance("")
+	require.Error(t, PlanChanges("test", toBeWritten, toBeDeleted, existing), "changes are planned by instance")
+}
+
+type optionsItem struct {
+	Name    string                 `yaml:"name"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+func (i optionsItem) Key() string {
+	return i.Name
+}
+
+func (i optionsItem) Equals(interface{}) bool {
+	return false
+}
+
+func TestDigest(t *testing.T) {
+	digestOf := func(i Item) string {
+		d, err := digest(i)
+		require.NoError(t, err)
+		return d
+	}
+
+	options := map[string]interface{}{"a": "1", "b": "2", "c": map[interface{}]interface{}{"d": "3", "e": "4"}}
+	reordered := map[string]interface{}{"c": map[interface{}]interface{}{"e": "4", "d": "3"}, "b": "2", "a": "1"}
+	require.Equal(t, digestOf(optionsItem{"x", options}), digestOf(optionsItem{"x", reordered}), "keys are sorted")
+	require.NotEqual(t, digestOf(optionsItem{"x", options}), digestOf(optionsItem{"x", map[string]interface{}{"a": "2"}}), "fields are digested")
+
+	require.Equal(t,
+		digestOf(optionsItem{"x", map[string]interface{}{"a": "1", "password": "old"}}),
+		digestOf(optionsItem{"x", map[string]interface{}{"a": "1", "password": "new"}}),
+		"secret fields are left out")
+}
+
+func TestPlanActions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { recording, plan, planID = false, nil, "" }()
+
+	file := filepath.Join(dir, "plan.json")
+	toBeWritten := intoInterface([]item{{"x", "new"}})
+	actions := []Action{
+		{Name: "rotate", Key: "database/rotate-role/app"},
+		{Name: "create", Key: "transit/keys/app", Data: map[string]interface{}{"type": "aes256-gcm96"}},
+	}
+
+	RecordChanges()
+	require.NoError(t, PlanActions("test", actions))
+	require.NoError(t, PlanChanges("test", toBeWritten, nil, nil), "items are recorded along the actions")
+	_, err = SavePlan(file)
+	require.NoError(t, err)
+
+	recording = false
+	require.NoError(t, LoadPlan(file))
+	require.NoError(t, PlanChanges("test", toBeWritten, nil, nil))
+	require.NoError(t, PlanActions("test", []Action{actions[1], actions[0]}), "planned actions are performed in any order")
+	require.Error(t, PlanActions("test", actions[:1]), "actions changed")
+	require.Error(t, PlanActions("test", []Action{actions[0], {Name: "create", Key: "transit/keys/app", Data: map[string]interface{}{"type": "rsa-2048"}}}), "written state changed")
+	require.NoError(t, PlanActions("other", nil), "top-levels without actions are left out")
+	require.Error(t, PlanActions("other", actions), "unplanned actions")
+}
+
+func TestPlanID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { recording = false }()
+
+	save := func(toBeWritten []Item, findings ...string) string {
+		RecordChanges()
+		require.NoError(t, PlanChanges("test", toBeWritten, nil, nil))
+		ReportFindings("checked", findings)
+		id, err := SavePlan(filepath.Join(dir, "plan.json"))
+		require.NoError(t, err)
+		return id
+	}
+
+	id := save(intoInterface([]item{{"x", "new"}, {"y", "y"}}))
+	require.Equal(t, id, save(intoInterface([]item{{"y", "y"}, {"x", "new"}})), "identical plans have the same ID")
+	require.Equal(t, id, save(intoInterface([]item{{"x", "new"}, {"y", "y"}}), "license expired"), "findings aren't planned")
+	require.NotEqual(t, id, save(intoInterface([]item{{"x", "newer"}, {"y", "y"}})), "changed plans have another ID")
+}
@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Operation is a change about to be made to a Vault path.
+type Operation struct {
+	// Path is the Vault path being changed, e.g. "sys/audit/file".
+	Path string
+	// Delete is true if the path is deleted rather than written.
+	Delete bool
+	// Sudo is true if the path is root-protected.
+	Sudo bool
+}
+
+// WriteOperation describes writing to a path.
+func WriteOperation(path string, sudo bool) Operation {
+	return Operation{Path: strings.Trim(path, "/"), Sudo: sudo}
+}
+
+// DeleteOperation describes deleting a path.
+func DeleteOperation(path string, sudo bool) Operation {
+	return Operation{Path: strings.Trim(path, "/"), Delete: true, Sudo: sudo}
+}
+
+// Authorized reports whether the provided capabilities on the operation's
+// path allow performing it.
+func (o Operation) Authorized(capabilities []string) bool {
+	has := make(map[string]bool, len(capabilities))
+	for _, c := range capabilities {
+		has[c] = true
+	}
+
+	switch {
+	case has["root"]:
+		return true
+	case has["deny"]:
+		return false
+	case o.Sudo && !has["sudo"]:
+		return false
+	case o.Delete:
+		return has["delete"]
+	default:
+		return has["create"] || has["update"]
+	}
+}
+
+func (o Operation) String() string {
+	verb := "write"
+	if o.Delete {
+		verb = "delete"
+	}
+	if o.Sudo {
+		verb += "+sudo"
+	}
+	return verb + " " + o.Path
+}
+
+var preflight bool
+
+// SetPreflight enables checking the capabilities of the token against every
+// planned operation before it is performed.
+func SetPreflight(enabled bool) {
+	preflight = enabled
+}
+
+// Preflight reports, for each of the planned operations of a top-level
+// configuration, whether the token is authorized to perform it, and returns
+// false if any of them would fail.
+//
+// It always returns true without logging in to Vault unless pre-flight checks
+// have been enabled.
+func Preflight(ctx context.Context, name string, ops []Operation) (bool, error) {
+	if !preflight || len(ops) == 0 {
+		return true, nil
+	}
+
+	client, err := ClientFromEnv(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	authorized := true
+	for _, op := range ops {
+		capabilities, err := client.Sys().CapabilitiesSelf(op.Path)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to look up token capabilities on %s", op.Path)
+		}
+
+		fields := logrus.Fields{
+			"name":         name,
+			"operation":    op.String(),
+			"capabilities": strings.Join(capabilities, ","),
+		}
+		if op.Authorized(capabilities) {
+			logrus.WithFields(fields).Info("[Preflight]\tauthorized")
+			continue
+		}
+
+		authorized = false
+		logrus.WithFields(fields).Warn("[Preflight]\tnot authorized; operation will fail")
+	}
+
+	return authorized, nil
+}
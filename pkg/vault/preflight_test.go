@@ -0,0 +1,42 @@
+package vault
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationAuthorized(t *testing.T) {
+	table := []struct {
+		description  string
+		op           Operation
+		capabilities []string
+		expected     bool
+	}{
+		{"root allows everything", DeleteOperation("sys/audit/file", true), []string{"root"}, true},
+		{"deny refuses everything", WriteOperation("sys/policy/x", false), []string{"deny", "update"}, false},
+		{"write allowed by create", WriteOperation("sys/policy/x", false), []string{"create"}, true},
+		{"write allowed by update", WriteOperation("sys/policy/x", false), []string{"update"}, true},
+		{"write refused by read", WriteOperation("sys/policy/x", false), []string{"read"}, false},
+		{"delete requires delete", DeleteOperation("sys/policy/x", false), []string{"update"}, false},
+		{"sudo paths require sudo", WriteOperation("sys/audit/file", true), []string{"update"}, false},
+		{"sudo paths with sudo", WriteOperation("sys/audit/file", true), []string{"update", "sudo"}, true},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.op.Authorized(tt.capabilities))
+		})
+	}
+}
+
+func TestPreflightDisabledSkipsLogin(t *testing.T) {
+	os.Unsetenv("VAULT_ADDR")
+	SetPreflight(false)
+
+	authorized, err := Preflight(context.Background(), "vault_policies", []Operation{WriteOperation("sys/policy/x", false)})
+	require.NoError(t, err)
+	require.True(t, authorized)
+}
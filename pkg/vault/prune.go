@@ -0,0 +1,42 @@
+package vault
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// pruning is true if DiffItems deletes the items that aren't declared.
+	pruning = true
+	// protectedPaths holds the patterns of the items DiffItems never deletes.
+	protectedPaths []string
+)
+
+// SetPrune sets whether the existing items that aren't declared are deleted,
+// which is the default.
+func SetPrune(enabled bool) {
+	pruning = enabled
+}
+
+// SetProtectedPaths prevents the items whose key matches one of the patterns
+// from ever being deleted, even when pruning. Patterns are globs where "*"
+// matches any sequence of characters, e.g. "sys/*".
+func SetProtectedPaths(patterns []string) {
+	protectedPaths = patterns
+}
+
+// prunedItems filters out the items that must not be deleted.
+func prunedItems(toBeDeleted []Item) []Item {
+	pruned := make([]Item, 0, len(toBeDeleted))
+	for _, i := range toBeDeleted {
+		if !pruning {
+			logrus.WithField("key", i.Key()).Info("keeping entry that isn't declared since pruning is disabled")
+			continue
+		}
+		if len(protectedPaths) > 0 && PathAllowed(protectedPaths, i.Key()) {
+			logrus.WithField("key", i.Key()).Warn("refusing to delete protected entry that isn't declared")
+			continue
+		}
+		pruned = append(pruned, i)
+	}
+	return pruned
+}
@@ -0,0 +1,27 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffItemsWithoutPruning(t *testing.T) {
+	defer SetPrune(true)
+	SetPrune(false)
+
+	toBeWritten, toBeDeleted := DiffItems(
+		[]Item{item{Name: "a", Data: "new"}},
+		[]Item{item{Name: "a", Data: "old"}, item{Name: "b"}},
+	)
+	require.Equal(t, []Item{item{Name: "a", Data: "new"}}, toBeWritten)
+	require.Equal(t, []Item{}, toBeDeleted)
+}
+
+func TestDiffItemsKeepsProtectedItems(t *testing.T) {
+	defer SetProtectedPaths(nil)
+	SetProtectedPaths([]string{"prod-*"})
+
+	_, toBeDeleted := DiffItems(nil, []Item{item{Name: "prod-db"}, item{Name: "dev-db"}})
+	require.Equal(t, []Item{item{Name: "dev-db"}}, toBeDeleted)
+}
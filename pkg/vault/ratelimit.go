@@ -0,0 +1,36 @@
+package vault
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// limiter is shared by every client, which would otherwise each be limited on
+// their own. A nil limiter doesn't limit the requests.
+var limiter *rate.Limiter
+
+// SetRateLimit limits the requests sent to Vault to the provided number per
+// second, so that large reconciliations don't exceed the rate limit quotas of
+// the Vault instance. Requests aren't limited by default or if it's 0.
+func SetRateLimit(requestsPerSecond float64) {
+	if requestsPerSecond <= 0 {
+		limiter = nil
+		return
+	}
+	limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
+}
+
+// rateLimitTransport waits for the limiter before sending each request, giving
+// up once the context of the request is done.
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,67 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSetRateLimit(t *testing.T) {
+	defer SetRateLimit(0)
+
+	SetRateLimit(10)
+	require.NotNil(t, limiter)
+	require.Equal(t, rate.Limit(10), limiter.Limit())
+
+	SetRateLimit(0)
+	require.Nil(t, limiter)
+}
+
+func TestRateLimitTransportWaits(t *testing.T) {
+	sent := 0
+	transport := &rateLimitTransport{
+		next: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			sent++
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}),
+		limiter: rate.NewLimiter(20, 1),
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodGet, "http://vault/v1/sys/mounts", nil)
+		require.NoError(t, err)
+		_, err = transport.RoundTrip(req)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, sent)
+	require.True(t, time.Since(start) >= 90*time.Millisecond)
+}
+
+func TestRateLimitTransportCancelled(t *testing.T) {
+	transport := &rateLimitTransport{
+		next: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			t.Fatal("cancelled request was sent")
+			return nil, nil
+		}),
+		limiter: rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	transport.limiter.Allow()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequest(http.MethodGet, "http://vault/v1/sys/mounts", nil)
+	require.NoError(t, err)
+	_, err = transport.RoundTrip(req.WithContext(ctx))
+	require.Error(t, err)
+}
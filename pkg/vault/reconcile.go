@@ -1,22 +1,38 @@
 package vault
 
 import (
+	"context"
 	"fmt"
 	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // Item represents a remote value stored in a Vault instance.
+//
+// Equals must only compare fields that can be declared in configuration.
+// Server-assigned identity fields (accessors, UUIDs, IDs, timestamps) never
+// appear in configuration and would cause a permanent diff, so they must be
+// left out when building items from the state of a Vault instance.
 type Item interface {
 	Key() string
 	Equals(interface{}) bool
 }
 
-// DiffItems is a pure function that determines what changes need to be made to
-// a Vault instance in order to reach the desired state.
+// DiffItems determines what changes need to be made to a Vault instance in
+// order to reach the desired state.
+//
+// Items are only deleted as allowed by SetPrune and SetProtectedPaths.
 func DiffItems(desired, existing []Item) (toBeWritten, toBeDeleted []Item) {
+	toBeWritten, toBeDeleted = diffItems(desired, existing)
+	return toBeWritten, prunedItems(toBeDeleted)
+}
+
+func diffItems(desired, existing []Item) (toBeWritten, toBeDeleted []Item) {
 	toBeWritten = make([]Item, 0)
 	toBeDeleted = make([]Item, 0)
 
@@ -39,6 +55,142 @@ func DiffItems(desired, existing []Item) (toBeWritten, toBeDeleted []Item) {
 	return
 }
 
+// Changes describes the items of a top-level to reconcile with Reconcile.
+type Changes struct {
+	// Name is the name of the top-level, e.g. "vault_policies".
+	Name string
+	// Package names the top-level in dry-run logs, e.g. "policy".
+	Package string
+
+	Desired, Existing []Item
+
+	// Operations lists the requests made to Vault to write, or delete, an
+	// item.
+	Operations func(i Item, delete bool) []Operation
+	// Skip, if set, reports the changes that are never made, such as
+	// deleting builtin items.
+	Skip func(i Item, delete bool) bool
+}
+
+// Reconcile determines the items of a top-level to write and delete.
+//
+// The desired and existing items are diffed first. Changes to paths outside of
+// the path filter are left out, as are the deletions that pruning doesn't
+// allow and the changes that Skip reports. Then the differences are warned
+// about, existing items waiting to be adopted are left out, and every change
+// is held back during the cooldown of the top-level. The remaining changes are
+// explained, and checked against the plan and the capabilities of the token.
+//
+// In dry-run mode, the changes are only logged and none are returned. The
+// cooldown of the top-level is recorded otherwise, if any change is returned.
+func Reconcile(ctx context.Context, c Changes, dryRun bool) (toBeWritten, toBeDeleted []Item, err error) {
+	// left records why the explained item is left out by a stage, if any
+	var left leftOut
+	written, deleted := diffItems(c.Desired, c.Existing)
+	toBeWritten = managedItems(written, false, c.Operations)
+	left.note(written, toBeWritten, "it changes paths outside of the path filter")
+	managed := managedItems(deleted, true, c.Operations)
+	left.note(deleted, managed, "it deletes paths outside of the path filter")
+	toBeDeleted = prunedItems(managed)
+	if pruning {
+		left.note(managed, toBeDeleted, "the path is protected")
+	} else {
+		left.note(managed, toBeDeleted, "pruning is disabled")
+	}
+	if c.Skip != nil {
+		written, deleted = toBeWritten, toBeDeleted
+		toBeWritten = skipped(written, false, c.Skip)
+		toBeDeleted = skipped(deleted, true, c.Skip)
+		left.note(written, toBeWritten, "the top-level never makes this change")
+		left.note(deleted, toBeDeleted, "the top-level never makes this change")
+	}
+
+	policy, err := FieldPolicyFor(c.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	WarnDrift(policy, c.Desired, c.Existing)
+
+	written = toBeWritten
+	toBeWritten, err = FilterAdoptable(c.Name, written, c.Existing, dryRun)
+	if err != nil {
+		return nil, nil, err
+	}
+	left.note(written, toBeWritten, "it already exists and waits to be adopted")
+
+	// Changes held back by a cooldown aren't part of the plan.
+	if len(toBeWritten)+len(toBeDeleted) > 0 {
+		cooldown, err := cooldownFor(c.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cooldown > 0 {
+			heldBack(c.Name, c.Package, cooldown, dryRun)
+			changes := append(append([]Item{}, toBeWritten...), toBeDeleted...)
+			left.note(changes, nil, fmt.Sprintf("changes are held back by cooldown for %v", cooldown))
+			toBeWritten, toBeDeleted = []Item{}, []Item{}
+		}
+	}
+	Explain(c.Name, c.Desired, c.Existing, left)
+	if err := PlanChanges(c.Name, toBeWritten, toBeDeleted, c.Existing); err != nil {
+		return nil, nil, err
+	}
+
+	// Check that the token is allowed to make every planned change.
+	ops := make([]Operation, 0, len(toBeWritten)+len(toBeDeleted))
+	for _, w := range toBeWritten {
+		ops = append(ops, c.Operations(w, false)...)
+	}
+	for _, d := range toBeDeleted {
+		ops = append(ops, c.Operations(d, true)...)
+	}
+	authorized, err := Preflight(ctx, c.Name, ops)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !authorized && !dryRun {
+		return nil, nil, errors.Errorf("token is not authorized to apply %s configuration", c.Name)
+	}
+
+	if dryRun {
+		for _, w := range toBeWritten {
+			logrus.Infof("[Dry Run]\tpackage=%s\tentry to be written='%v'", c.Package, w)
+			LogFieldChanges(c.Package, w, c.Existing)
+		}
+		for _, d := range toBeDeleted {
+			logrus.Infof("[Dry Run]\tpackage=%s\tentry to be deleted='%v'", c.Package, d)
+		}
+		return nil, nil, nil
+	}
+
+	if len(toBeWritten)+len(toBeDeleted) > 0 {
+		if err := recordCooldown(c.Name); err != nil {
+			return nil, nil, err
+		}
+	}
+	return toBeWritten, toBeDeleted, nil
+}
+
+// heldBack reports the changes to a top-level held back by its cooldown.
+func heldBack(name, pkg string, cooldown time.Duration, dryRun bool) {
+	MarkDrift()
+	if dryRun {
+		logrus.Infof("[Dry Run]\tpackage=%s\tchanges held back by cooldown for '%v'", pkg, cooldown)
+		return
+	}
+	logrus.WithFields(logrus.Fields{"name": name, "remaining": cooldown}).Warn("skipping changes during cooldown")
+}
+
+func skipped(items []Item, delete bool, skip func(Item, bool) bool) []Item {
+	filtered := make([]Item, 0, len(items))
+	for _, i := range items {
+		if !skip(i, delete) {
+			filtered = append(filtered, i)
+		}
+	}
+	return filtered
+}
+
 func in(y Item, xs []Item) bool {
 	for _, x := range xs {
 		if y.Equals(x) {
@@ -59,29 +211,91 @@ func keyIn(y Item, xs []Item) bool {
 
 // OptionsEqual compares two sets of options mappings.
 func OptionsEqual(xopts, yopts map[string]interface{}) bool {
-	if len(xopts) != len(yopts) {
-		return false
+	return len(OptionsDiff(xopts, yopts)) == 0
+}
+
+// OptionsDiff returns the sorted keys whose values differ between two sets of
+// options mappings, including keys only present in one of them.
+func OptionsDiff(xopts, yopts map[string]interface{}) []string {
+	keys := make(map[string]struct{}, len(xopts)+len(yopts))
+	for k := range xopts {
+		keys[k] = struct{}{}
+	}
+	for k := range yopts {
+		keys[k] = struct{}{}
 	}
 
-	for k, v := range yopts {
-		xv, ok := xopts[k]
-		if !ok {
-			return false
+	diff := make([]string, 0)
+	for k := range keys {
+		xv, xok := xopts[k]
+		yv, yok := yopts[k]
+		if !xok || !yok {
+			diff = append(diff, k)
+			continue
 		}
 
-		if strings.HasSuffix(k, "ttl") || strings.HasSuffix(k, "period") {
-			if !ttlEqual(fmt.Sprintf("%v", v), fmt.Sprintf("%v", xv)) {
-				return false
+		if isDurationKey(k) {
+			if !ttlEqual(fmt.Sprintf("%v", yv), fmt.Sprintf("%v", xv)) {
+				diff = append(diff, k)
 			}
 			continue
 		}
 
-		if fmt.Sprintf("%v", v) != fmt.Sprintf("%v", xv) {
-			return false
+		if fmt.Sprintf("%v", yv) != fmt.Sprintf("%v", xv) {
+			diff = append(diff, k)
+		}
+	}
+	sort.Strings(diff)
+
+	return diff
+}
+
+// durationSuffixes are the suffixes of the keys holding durations, which may
+// be declared with different units than the ones returned by Vault.
+var durationSuffixes = []string{"ttl", "period", "interval", "_time", "threshold"}
+
+func isDurationKey(k string) bool {
+	for _, suffix := range durationSuffixes {
+		if strings.HasSuffix(k, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatDurations returns a copy of options where the durations returned by
+// Vault as a number of seconds are formatted the way they're declared, e.g.
+// "768h" instead of 2764800, so that exported options can be applied again
+// without changes.
+func FormatDurations(options map[string]interface{}) map[string]interface{} {
+	if options == nil {
+		return nil
+	}
+
+	formatted := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		formatted[k] = v
+		if !isDurationKey(k) {
+			continue
+		}
+		if seconds, err := strconv.ParseInt(fmt.Sprintf("%v", v), 10, 64); err == nil {
+			formatted[k] = formatSeconds(seconds)
 		}
 	}
+	return formatted
+}
 
-	return true
+// formatSeconds formats a duration in the largest of hours, minutes or
+// seconds that it is a whole number of.
+func formatSeconds(seconds int64) string {
+	switch {
+	case seconds != 0 && seconds%3600 == 0:
+		return fmt.Sprintf("%dh", seconds/3600)
+	case seconds != 0 && seconds%60 == 0:
+		return fmt.Sprintf("%dm", seconds/60)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
 }
 
 func ttlEqual(x, y string) bool {
@@ -105,34 +319,37 @@ func EqualPathNames(x, y string) bool {
 }
 
 // DataInSecret compare given data with data stored in the vault secret
-func DataInSecret(data map[string]interface{}, path string, client *api.Client) bool {
+func DataInSecret(data map[string]interface{}, path string, client *api.Client) (bool, error) {
 	// read desired secret
 	secret, err := client.Logical().Read(path)
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to get vault secret")
+		return false, errors.Wrapf(err, "failed to get vault secret %s", path)
 	}
 	if secret == nil {
-		return false
+		return false, nil
 	}
 	for k, v := range data {
 		if strings.HasSuffix(k, "ttl") || strings.HasSuffix(k, "period") {
 			dur, err := time.ParseDuration(v.(string))
 			if err != nil {
-				logrus.WithError(err).WithField("option", k).Fatal("failed to parse duration from data")
+				return false, errors.Wrapf(err, "failed to parse duration of option %s from data", k)
 			}
 			v = int64(dur.Seconds())
 		}
 		if fmt.Sprintf("%v", secret.Data[k]) == fmt.Sprintf("%v", v) {
 			continue
 		}
-		return false
+		return false, nil
 	}
-	return true
+	return true, nil
 }
 
 // ParseDuration parses a string duration from Vault.
 // Defaults to seconds if no unit is found at the end of the string.
 func ParseDuration(duration string) (time.Duration, error) {
+	if duration == "" {
+		return 0, errors.New("empty duration")
+	}
 	lastChar := string([]rune(duration)[len(duration)-1])
 	if strings.ContainsAny(lastChar, "1234567890") {
 		duration += "s"
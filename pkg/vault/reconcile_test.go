@@ -1,18 +1,21 @@
 package vault
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 type item struct {
-	name string
-	data string
+	Name string
+	Data string
 }
 
 func (i item) Key() string {
-	return i.name
+	return i.Name
 }
 
 func (i item) Equals(iface interface{}) bool {
@@ -21,7 +24,7 @@ func (i item) Equals(iface interface{}) bool {
 		return false
 	}
 
-	return i.name == iitem.name && i.data == iitem.data
+	return i.Name == iitem.Name && i.Data == iitem.Data
 }
 
 func TestDiffItems(t *testing.T) {
@@ -144,6 +147,24 @@ func TestOptionsEqual(t *testing.T) {
 			y:           map[string]interface{}{"x_ttl": "1m"},
 			expected:    true,
 		},
+		{
+			description: "interval keys in seconds and numbers are equal",
+			x:           map[string]interface{}{"block_interval": "5m"},
+			y:           map[string]interface{}{"block_interval": 300},
+			expected:    true,
+		},
+		{
+			description: "time and threshold keys with and without minutes are equal",
+			x:           map[string]interface{}{"server_stabilization_time": "90s", "dead_server_last_contact_threshold": "24h"},
+			y:           map[string]interface{}{"server_stabilization_time": "1m30s", "dead_server_last_contact_threshold": "24h0m0s"},
+			expected:    true,
+		},
+		{
+			description: "empty duration is not equal to a duration",
+			x:           map[string]interface{}{"x_ttl": ""},
+			y:           map[string]interface{}{"x_ttl": "1h"},
+			expected:    false,
+		},
 	}
 
 	for _, tt := range table {
@@ -152,3 +173,118 @@ func TestOptionsEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcile(t *testing.T) {
+	desired := []Item{item{"a", "1"}, item{"b", "2"}}
+	existing := []Item{item{"b", "1"}, item{"builtin", "1"}, item{"c", "1"}}
+	changes := Changes{
+		Name:     "test_items",
+		Package:  "test",
+		Desired:  desired,
+		Existing: existing,
+		Operations: func(i Item, delete bool) []Operation {
+			if delete {
+				return []Operation{DeleteOperation(i.Key(), false)}
+			}
+			return []Operation{WriteOperation(i.Key(), false)}
+		},
+		Skip: func(i Item, delete bool) bool {
+			return delete && i.Key() == "builtin"
+		},
+	}
+
+	table := []struct {
+		description string
+		dryRun      bool
+		cooldown    time.Duration
+		toBeWritten []Item
+		toBeDeleted []Item
+		recorded    []string
+	}{
+		{"changes are returned", false, 0, []Item{item{"a", "1"}, item{"b", "2"}}, []Item{item{"c", "1"}}, []string{"test_items"}},
+		{"dry-run returns no changes", true, 0, nil, nil, nil},
+		{"changes are held back during cooldown", false, time.Minute, []Item{}, []Item{}, nil},
+	}
+
+	defer SetCooldowns(nil)
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			cooldowns := &fakeCooldowns{remaining: tt.cooldown}
+			SetCooldowns(cooldowns)
+			toBeWritten, toBeDeleted, err := Reconcile(context.Background(), changes, tt.dryRun)
+			require.NoError(t, err)
+			require.Equal(t, tt.toBeWritten, toBeWritten)
+			require.Equal(t, tt.toBeDeleted, toBeDeleted)
+			require.Equal(t, tt.recorded, cooldowns.recorded)
+		})
+	}
+}
+
+// fakeCooldowns holds back every top-level for the same time.
+type fakeCooldowns struct {
+	remaining time.Duration
+	recorded  []string
+}
+
+func (c *fakeCooldowns) Remaining(string) (time.Duration, error) {
+	return c.remaining, nil
+}
+
+func (c *fakeCooldowns) Record(name string) error {
+	c.recorded = append(c.recorded, name)
+	return nil
+}
+
+func TestCooldownIsCheckedOncePerRun(t *testing.T) {
+	cooldowns := &fakeCooldowns{}
+	SetCooldowns(cooldowns)
+	defer SetCooldowns(nil)
+
+	r, err := cooldownFor("vault_policies")
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), r)
+
+	// Changes made by a top-level don't hold back its later ones.
+	require.NoError(t, recordCooldown("vault_policies"))
+	cooldowns.remaining = time.Minute
+	r, err = cooldownFor("vault_policies")
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), r)
+
+	r, err = cooldownFor("vault_audit_backends")
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, r)
+}
+
+func TestFormatDurations(t *testing.T) {
+	formatted := FormatDurations(map[string]interface{}{
+		"token_ttl":              json.Number("2764800"),
+		"token_max_ttl":          json.Number("5400"),
+		"secret_id_ttl":          json.Number("90"),
+		"token_period":           json.Number("0"),
+		"token_num_uses":         json.Number("3600"),
+		"token_policies":         []interface{}{"app"},
+		"token_explicit_max_ttl": "24h",
+	})
+	require.Equal(t, map[string]interface{}{
+		"token_ttl":              "768h",
+		"token_max_ttl":          "90m",
+		"secret_id_ttl":          "90s",
+		"token_period":           "0s",
+		"token_num_uses":         json.Number("3600"),
+		"token_policies":         []interface{}{"app"},
+		"token_explicit_max_ttl": "24h",
+	}, formatted)
+
+	// Formatted durations compare equal to the ones returned by Vault.
+	require.True(t, OptionsEqual(formatted, map[string]interface{}{
+		"token_ttl":              json.Number("2764800"),
+		"token_max_ttl":          json.Number("5400"),
+		"secret_id_ttl":          json.Number("90"),
+		"token_period":           json.Number("0"),
+		"token_num_uses":         json.Number("3600"),
+		"token_policies":         []interface{}{"app"},
+		"token_explicit_max_ttl": "24h",
+	}))
+	require.Nil(t, FormatDurations(nil))
+}
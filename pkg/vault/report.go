@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// report is the machine-readable description of the changes of a run.
+type report struct {
+	DryRun bool `json:"dry_run"`
+	// PlanID identifies the applied plan or, without one, the plan made of
+	// the changes.
+	PlanID    string           `json:"plan_id"`
+	TopLevels []toplevelReport `json:"toplevels"`
+}
+
+// toplevelReport describes the changes of a top-level in an instance and
+// namespace.
+type toplevelReport struct {
+	Name      string         `json:"name"`
+	Instance  string         `json:"instance,omitempty"`
+	Namespace string         `json:"namespace,omitempty"`
+	Create    []reportedItem `json:"create"`
+	Update    []reportedItem `json:"update"`
+	Delete    []reportedItem `json:"delete"`
+	// Actions are performed besides writing and deleting items.
+	Actions []reportedAction `json:"actions,omitempty"`
+	// Findings describe how the instance doesn't meet expectations that
+	// aren't applied, such as those of checks.
+	Findings []string `json:"findings,omitempty"`
+}
+
+type reportedItem struct {
+	Key    string   `json:"key"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+type reportedAction struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// ReportFindings records the findings of a top-level in the current instance
+// and namespace, to be reported by WriteReport.
+func ReportFindings(name string, findings []string) {
+	planM.Lock()
+	defer planM.Unlock()
+
+	if !recording || len(findings) == 0 {
+		return
+	}
+	key := ScopeKey(name)
+	r := record(key)
+	r.Findings = append(r.Findings, findings...)
+	recorded[key] = r
+}
+
+// WriteReport writes the changes recorded since RecordChanges as a JSON
+// document, listing the items created, updated and deleted by each top-level
+// in the order they were applied, along with their actions and findings.
+func WriteReport(w io.Writer, dryRun bool) error {
+	planM.Lock()
+	defer planM.Unlock()
+
+	r := report{DryRun: dryRun, PlanID: planID, TopLevels: make([]toplevelReport, 0, len(recordedOrder))}
+	if plan == nil {
+		id, err := identify(recordedPlan())
+		if err != nil {
+			return err
+		}
+		r.PlanID = id
+	}
+	for _, key := range recordedOrder {
+		changes := recorded[key]
+		var instance string
+		if i := strings.Index(key, ":"); i >= 0 {
+			instance, key = key[:i], key[i+1:]
+		}
+		t := toplevelReport{
+			Name:     path.Base(key),
+			Instance: instance,
+			Create:   make([]reportedItem, 0),
+			Update:   make([]reportedItem, 0),
+			Delete:   make([]reportedItem, 0, len(changes.Delete)),
+		}
+		if ns := path.Dir(key); ns != "." {
+			t.Namespace = ns
+		}
+		for _, c := range changes.Write {
+			if c.Update {
+				t.Update = append(t.Update, reportedItem{Key: c.Key, Fields: c.Fields})
+			} else {
+				t.Create = append(t.Create, reportedItem{Key: c.Key})
+			}
+		}
+		for _, c := range changes.Delete {
+			t.Delete = append(t.Delete, reportedItem{Key: c.Key})
+		}
+		for _, a := range changes.Actions {
+			t.Actions = append(t.Actions, reportedAction{Name: a.Name, Key: a.Key})
+		}
+		t.Findings = changes.Findings
+		r.TopLevels = append(r.TopLevels, t)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return errors.Wrap(err, "failed to write report")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReport(t *testing.T) {
+	defer func() { recording = false }()
+
+	RecordChanges()
+	existing := intoInterface([]item{{"x", "old"}, {"z", "z"}})
+	require.NoError(t, PlanChanges("test", intoInterface([]item{{"x", "new"}, {"y", "y"}}), intoInterface([]item{{"z", "z"}}), existing))
+	require.NoError(t, PlanChanges("unchanged", nil, nil, existing))
+	SetNamespace("team-a")
+	require.NoError(t, PlanChanges("test", intoInterface([]item{{"y", "y"}}), nil, nil))
+	SetInstance("dr")
+	require.NoError(t, PlanChanges("test", nil, intoInterface([]item{{"z", "z"}}), existing))
+	SetNamespace("")
+	SetInstance("")
+	require.NoError(t, PlanActions("checked", []Action{{Name: "rotate", Key: "creds/a"}}))
+	ReportFindings("checked", []string{"license expired"})
+	ReportFindings("clean", nil)
+
+	id, err := identify(recordedPlan())
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteReport(&b, true))
+	require.JSONEq(t, `{
+  "dry_run": true,
+  "plan_id": "`+id+`",
+  "toplevels": [
+    {"name": "test", "create": [{"key": "y"}], "update": [{"key": "x"}], "delete": [{"key": "z"}]},
+    {"name": "test", "namespace": "team-a", "create": [{"key": "y"}], "update": [], "delete": []},
+    {"name": "test", "instance": "dr", "namespace": "team-a", "create": [], "update": [], "delete": [{"key": "z"}]},
+    {"name": "checked", "create": [], "update": [], "delete": [], "actions": [{"name": "rotate", "key": "creds/a"}], "findings": ["license expired"]}
+  ]
+}`, b.String())
+}
@@ -0,0 +1,134 @@
+package vault
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRetryBackoff caps the wait between two attempts of a request.
+const maxRetryBackoff = 30 * time.Second
+
+var (
+	// maxAttempts is the number of times a request failing with a transient
+	// error is sent before giving up.
+	maxAttempts = 3
+	// retryBackoff is the wait before the second attempt of a request, doubled
+	// before each next one.
+	retryBackoff = time.Second
+)
+
+// SetRetry sets the number of times requests failing with a transient error,
+// such as a connection reset or a 503 of a sealed or overloaded Vault
+// instance, are sent before giving up, and the wait before retrying them for
+// the first time, doubled after every attempt. Requests are sent up to 3 times
+// by default, after waiting 1s then 2s.
+func SetRetry(attempts int, backoff time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	maxAttempts, retryBackoff = attempts, backoff
+}
+
+// retryTransport retries requests failing with a transient error using an
+// exponential backoff, giving up once the context of the request is done.
+type retryTransport struct {
+	next     http.RoundTripper
+	attempts int
+	backoff  time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The body is read by each attempt.
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	backoff := t.backoff
+	for attempt := 1; ; attempt++ {
+		if body != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.attempts || !transient(resp, err) {
+			return resp, err
+		}
+
+		wait := backoff
+		if resp != nil {
+			if after := retryAfter(resp); after > wait {
+				wait = after
+			}
+			resp.Body.Close()
+		}
+		logrus.WithFields(logrus.Fields{
+			"path":    req.URL.Path,
+			"attempt": attempt,
+			"wait":    wait,
+		}).Warn("retrying request failing with a transient error")
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// transient reports whether a request failed with an error that may not occur
+// again when retrying it.
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return connectionReset(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// connectionReset reports whether the connection to Vault was closed while
+// sending a request.
+func connectionReset(err error) bool {
+	for {
+		switch e := err.(type) {
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		default:
+			return err == syscall.ECONNRESET || err == io.EOF || err == io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// retryAfter returns the wait requested by the Retry-After header of a
+// response, in seconds, as sent by Vault when a rate limit quota is exceeded.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	after := time.Duration(seconds) * time.Second
+	if after > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return after
+}
@@ -0,0 +1,115 @@
+package vault
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryTransport(t *testing.T) {
+	table := []struct {
+		description string
+		statuses    []int
+		attempts    int
+		expected    int
+		sent        int
+	}{
+		{
+			description: "successful request isn't retried",
+			statuses:    []int{http.StatusOK},
+			attempts:    3,
+			expected:    http.StatusOK,
+			sent:        1,
+		},
+		{
+			description: "transient error is retried",
+			statuses:    []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent},
+			attempts:    3,
+			expected:    http.StatusNoContent,
+			sent:        3,
+		},
+		{
+			description: "last attempt is returned",
+			statuses:    []int{http.StatusBadGateway, http.StatusInternalServerError, http.StatusOK},
+			attempts:    2,
+			expected:    http.StatusInternalServerError,
+			sent:        2,
+		},
+		{
+			description: "other error isn't retried",
+			statuses:    []int{http.StatusForbidden, http.StatusOK},
+			attempts:    3,
+			expected:    http.StatusForbidden,
+			sent:        1,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			var bodies []string
+			transport := &retryTransport{
+				next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					b, err := ioutil.ReadAll(req.Body)
+					require.NoError(t, err)
+					bodies = append(bodies, string(b))
+					return &http.Response{
+						StatusCode: tt.statuses[len(bodies)-1],
+						Body:       ioutil.NopCloser(strings.NewReader("")),
+						Header:     http.Header{},
+					}, nil
+				}),
+				attempts: tt.attempts,
+				backoff:  time.Millisecond,
+			}
+
+			req, err := http.NewRequest(http.MethodPut, "http://vault/v1/sys/policies/acl/app", strings.NewReader(`{"policy":""}`))
+			require.NoError(t, err)
+			resp, err := transport.RoundTrip(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, resp.StatusCode)
+			require.Len(t, bodies, tt.sent)
+			for _, b := range bodies {
+				require.Equal(t, `{"policy":""}`, b)
+			}
+		})
+	}
+}
+
+func TestRetryTransportCancelled(t *testing.T) {
+	sent := 0
+	transport := &retryTransport{
+		next: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			sent++
+			return nil, &net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}
+		}),
+		attempts: 3,
+		backoff:  time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequest(http.MethodGet, "http://vault/v1/sys/mounts", nil)
+	require.NoError(t, err)
+	_, err = transport.RoundTrip(req.WithContext(ctx))
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, 1, sent)
+}
+
+func TestConnectionReset(t *testing.T) {
+	require.True(t, connectionReset(&net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}))
+	require.False(t, connectionReset(&net.OpError{Op: "dial", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}))
+}
+
+func TestRetryAfter(t *testing.T) {
+	require.Equal(t, 5*time.Second, retryAfter(&http.Response{Header: http.Header{"Retry-After": {"5"}}}))
+	require.Equal(t, maxRetryBackoff, retryAfter(&http.Response{Header: http.Header{"Retry-After": {"3600"}}}))
+	require.Equal(t, time.Duration(0), retryAfter(&http.Response{Header: http.Header{}}))
+}
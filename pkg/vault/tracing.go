@@ -0,0 +1,54 @@
+package vault
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/app-sre/vault-manager/pkg/tracing"
+)
+
+// tracingTransport records a span for every request sent to Vault, a child of
+// the span of the context of the client, e.g. the span of a top-level.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := operation(req)
+	ctx, span := tracing.Start(req.Context(), "vault."+op, tracing.KindClient)
+	if span == nil {
+		return t.next.RoundTrip(req)
+	}
+	span.SetAttribute("vault.operation", op)
+	span.SetAttribute("vault.path", strings.TrimPrefix(req.URL.Path, "/v1/"))
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Host)
+	if ns := req.Header.Get("X-Vault-Namespace"); ns != "" {
+		span.SetAttribute("vault.namespace", ns)
+	}
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if resp != nil {
+		span.SetAttribute("http.response.status_code", resp.StatusCode)
+	}
+	span.End(err)
+	return resp, err
+}
+
+// operation returns the Vault operation of a request: read, list, write or
+// delete.
+func operation(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet:
+		if req.URL.Query().Get("list") == "true" {
+			return "list"
+		}
+		return "read"
+	case "LIST":
+		return "list"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return "write"
+	}
+}
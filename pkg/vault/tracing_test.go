@@ -0,0 +1,28 @@
+package vault
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperation(t *testing.T) {
+	table := []struct {
+		method, url string
+		operation   string
+	}{
+		{http.MethodGet, "/v1/sys/policies/acl/app", "read"},
+		{http.MethodGet, "/v1/sys/policies/acl?list=true", "list"},
+		{"LIST", "/v1/auth/approle/role", "list"},
+		{http.MethodPut, "/v1/sys/policies/acl/app", "write"},
+		{http.MethodPost, "/v1/auth/approle/login", "write"},
+		{http.MethodDelete, "/v1/sys/policies/acl/app", "delete"},
+	}
+
+	for _, tt := range table {
+		req, err := http.NewRequest(tt.method, "http://vault:8200"+tt.url, nil)
+		require.NoError(t, err)
+		require.Equal(t, tt.operation, operation(req), "%s %s", tt.method, tt.url)
+	}
+}
@@ -0,0 +1,32 @@
+package vault
+
+import (
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Version returns the version string reported by the Vault instance, e.g.
+// "1.0.1" or "1.0.1+prem.hsm".
+func Version(client *api.Client) (string, error) {
+	health, err := client.Sys().Health()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the version of the Vault instance")
+	}
+	return health.Version, nil
+}
+
+// IsEnterprise reports whether a version string belongs to a Vault Enterprise
+// build.
+func IsEnterprise(version string) bool {
+	return strings.Contains(version, "+ent") ||
+		strings.Contains(version, "+prem") ||
+		strings.Contains(version, "+pro")
+}
+
+// IsHSM reports whether a version string belongs to a Vault Enterprise build
+// with HSM support.
+func IsHSM(version string) bool {
+	return IsEnterprise(version) && strings.HasSuffix(version, ".hsm")
+}
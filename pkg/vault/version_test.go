@@ -0,0 +1,27 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionEditions(t *testing.T) {
+	table := []struct {
+		version    string
+		enterprise bool
+		hsm        bool
+	}{
+		{"1.0.1", false, false},
+		{"1.0.1+ent", true, false},
+		{"1.0.1+prem.hsm", true, true},
+		{"1.0.1+pro", true, false},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.version, func(t *testing.T) {
+			require.Equal(t, tt.enterprise, IsEnterprise(tt.version))
+			require.Equal(t, tt.hsm, IsHSM(tt.version))
+		})
+	}
+}
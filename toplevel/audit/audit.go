@@ -3,7 +3,13 @@
 package audit
 
 import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
 	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 
@@ -12,13 +18,19 @@ import (
 )
 
 type entry struct {
-	Path        string            `yaml:"_path"`
-	Type        string            `yaml:"type"`
-	Description string            `yaml:"description"`
-	Options     map[string]string `yaml:"options"`
+	Path        string            `yaml:"_path" validate:"required"`
+	Type        string            `yaml:"type" validate:"required"`
+	Description string            `yaml:"description,omitempty"`
+	Options     map[string]string `yaml:"options,omitempty"`
+	// Filter is an expression selecting the requests and responses logged by
+	// the device, supported by Vault Enterprise 1.15 and later.
+	Filter string `yaml:"filter,omitempty"`
 }
 
-var _ vault.Item = entry{}
+// filterOption is the option that Vault stores audit device filters in.
+const filterOption = "filter"
+
+var _ vault.FieldDiffer = entry{}
 
 func (e entry) Key() string {
 	return e.Path
@@ -30,10 +42,49 @@ func (e entry) Equals(i interface{}) bool {
 		return false
 	}
 
+	// a policy that can't be read is reported by Apply before comparing entries
+	policy, _ := vault.FieldPolicyFor("vault_audit_backends")
 	return vault.EqualPathNames(e.Path, entry.Path) &&
-		e.Type == entry.Type &&
-		e.Description == entry.Description &&
-		vault.OptionsEqual(e.ambiguousOptions(), entry.ambiguousOptions())
+		!policy.Significant(e.Differences(entry))
+}
+
+// Differences returns the names of the fields that differ from another entry.
+func (e entry) Differences(i interface{}) []string {
+	entry, ok := i.(entry)
+	if !ok {
+		return nil
+	}
+
+	var fields []string
+	if e.Type != entry.Type {
+		fields = append(fields, "type")
+	}
+	if e.Description != entry.Description {
+		fields = append(fields, "description")
+	}
+	if e.Filter != entry.Filter {
+		fields = append(fields, "filter")
+	}
+	for _, k := range vault.OptionsDiff(e.ambiguousOptions(), entry.ambiguousOptions()) {
+		fields = append(fields, "options."+k)
+	}
+
+	return fields
+}
+
+func (e entry) FieldValue(field string) interface{} {
+	switch field {
+	case "type":
+		return e.Type
+	case "description":
+		return e.Description
+	case "filter":
+		return e.Filter
+	}
+	if v, ok := e.Options[strings.TrimPrefix(field, "options.")]; ok {
+		return v
+	}
+	return nil
 }
 
 func (e entry) ambiguousOptions() map[string]interface{} {
@@ -44,82 +95,185 @@ func (e entry) ambiguousOptions() map[string]interface{} {
 	return opts
 }
 
-func (e entry) enable(client *api.Client) {
+// options returns the options the device is enabled with, including its
+// filter, which the vendored API client has no field for.
+func (e entry) options() map[string]string {
+	if e.Filter == "" {
+		return e.Options
+	}
+
+	opts := make(map[string]string, len(e.Options)+1)
+	for k, v := range e.Options {
+		opts[k] = v
+	}
+	opts[filterOption] = e.Filter
+	return opts
+}
+
+func (e entry) enable(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_audit_backends", Key: e.Path, Operation: "enable"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
 	if err := client.Sys().EnableAuditWithOptions(e.Path, &api.EnableAuditOptions{
 		Type:        e.Type,
 		Description: e.Description,
-		Options:     e.Options,
+		Options:     e.options(),
 	}); err != nil {
-		logrus.WithField("path", e.Path).Fatal("failed to enable audit device")
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to enable audit device %s", e.Path)
 	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
 	logrus.WithField("path", e.Path).Info("audit successfully enabled")
+	return nil
 }
 
-func (e entry) disable(client *api.Client) {
+func (e entry) disable(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_audit_backends", Key: e.Path, Operation: "disable"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
 	if err := client.Sys().DisableAudit(e.Path); err != nil {
-		logrus.WithField("path", e.Path).Fatal("failed to disable audit")
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to disable audit %s", e.Path)
 	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
 	logrus.WithField("path", e.Path).Info("audit successfully disabled")
+	return nil
+}
+
+// entryFromAudit builds an entry out of an Audit Device listed by Vault.
+//
+// Only fields that can be declared in configuration are copied; server-only
+// fields such as the accessor are deliberately left out so that they never
+// take part in Equals. The filter is moved out of the options it's returned
+// in.
+func entryFromAudit(audit *api.Audit) entry {
+	e := entry{
+		Path:        audit.Path,
+		Type:        audit.Type,
+		Description: audit.Description,
+		Options:     audit.Options,
+	}
+
+	if filter, ok := audit.Options[filterOption]; ok {
+		e.Filter = filter
+		e.Options = make(map[string]string, len(audit.Options))
+		for k, v := range audit.Options {
+			if k != filterOption {
+				e.Options[k] = v
+			}
+		}
+	}
+
+	return e
 }
 
 type config struct{}
 
 var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+var _ toplevel.Exporter = config{}
 
 func init() {
 	toplevel.RegisterConfiguration("vault_audit_backends", config{})
 }
 
+// Validate checks the Audit Devices configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
 // Apply ensures that an instance of Vault's Audit Devices are configured
 // exactly as provided.
-//
-// This function exits the program if an error occurs.
-func (c config) Apply(entriesBytes []byte, dryRun bool) {
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
 	var entries []entry
 	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
-		logrus.WithError(err).Fatal("failed to decode Audit Devices configuration")
+		return errors.Wrap(err, "failed to decode Audit Devices configuration")
 	}
 
-	// Get the existing enabled Audits Devices.
-	enabledAudits, err := vault.ClientFromEnv().Sys().ListAudit()
+	existingAudits, err := existingEntries(ctx)
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to list Audit Devices from Vault instance")
-	}
-
-	// Build a list of all the existing entries.
-	existingAudits := make([]entry, 0)
-	if enabledAudits != nil {
-		for _, audit := range enabledAudits {
-			existingAudits = append(existingAudits, entry{
-				Path:        audit.Path,
-				Type:        audit.Type,
-				Description: audit.Description,
-				Options:     audit.Options,
-			})
-		}
+		return err
 	}
 
 	// Diff the local configuration with the Vault instance.
-	toBeWritten, toBeDeleted := vault.DiffItems(asItems(entries), asItems(existingAudits))
+	toBeWritten, toBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:       "vault_audit_backends",
+		Package:    "audit",
+		Desired:    asItems(entries),
+		Existing:   asItems(existingAudits),
+		Operations: operations,
+	}, dryRun)
+	if err != nil {
+		return err
+	}
 
-	if dryRun == true {
-		for _, w := range toBeWritten {
-			logrus.Infof("[Dry Run]\tpackage=audit\tentry to be written='%v'", w)
-		}
-		for _, d := range toBeDeleted {
-			logrus.Infof("[Dry Run]\tpackage=audit\tentry to be deleted='%v'", d)
+	// Write any missing Audit Devices to the Vault instance.
+	for _, e := range toBeWritten {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
 		}
-	} else {
-		// Write any missing Audit Devices to the Vault instance.
-		for _, e := range toBeWritten {
-			e.(entry).enable(vault.ClientFromEnv())
+		if err := e.(entry).enable(client); err != nil {
+			return err
 		}
+	}
 
-		// Delete any Audit Devices from the Vault instance.
-		for _, e := range toBeDeleted {
-			e.(entry).disable(vault.ClientFromEnv())
+	// Delete any Audit Devices from the Vault instance.
+	for _, e := range toBeDeleted {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
 		}
+		if err := e.(entry).disable(client); err != nil {
+			return err
+		}
+	}
+
+	// Optionally verify that the sinks of the managed Audit Devices are alive.
+	if healthCheckEnabled() {
+		checkSinks(entries, dryRun)
+	}
+
+	return nil
+}
+
+// Export returns the Audit Devices enabled on an instance of Vault.
+func (c config) Export(ctx context.Context) (interface{}, error) {
+	existingAudits, err := existingEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(existingAudits, func(i, j int) bool { return existingAudits[i].Path < existingAudits[j].Path })
+	return existingAudits, nil
+}
+
+// existingEntries lists the Audit Devices enabled on an instance of Vault.
+func existingEntries(ctx context.Context) ([]entry, error) {
+	// Get the existing enabled Audits Devices.
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enabledAudits, err := client.Sys().ListAudit()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list Audit Devices from Vault instance")
+	}
+
+	// Build a list of all the existing entries.
+	existingAudits := make([]entry, 0)
+	for _, audit := range enabledAudits {
+		existingAudits = append(existingAudits, entryFromAudit(audit))
+	}
+	return existingAudits, nil
+}
+
+// operations lists the requests made to Vault to enable, or disable, an Audit
+// Device.
+func operations(e vault.Item, delete bool) []vault.Operation {
+	if delete {
+		return []vault.Operation{vault.DeleteOperation(path.Join("sys/audit", e.Key()), true)}
 	}
+	return []vault.Operation{vault.WriteOperation(path.Join("sys/audit", e.Key()), true)}
 }
 
 func asItems(xs []entry) (items []vault.Item) {
@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryOmitsServerOnlyFields(t *testing.T) {
+	typ := reflect.TypeOf(entry{})
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.ToLower(typ.Field(i).Tag.Get("yaml"))
+		require.NotContains(t, []string{"accessor", "uuid"}, name, "entry must not carry server-assigned field %s", name)
+	}
+}
+
+func TestEntryFromAuditEqualsConfig(t *testing.T) {
+	configured := entry{
+		Path:        "file/",
+		Type:        "file",
+		Description: "file audit device",
+		Options:     map[string]string{"file_path": "/var/log/vault/vault_audit.log"},
+	}
+
+	listed := entryFromAudit(&api.Audit{
+		Path:        "file/",
+		Type:        "file",
+		Description: "file audit device",
+		Options:     map[string]string{"file_path": "/var/log/vault/vault_audit.log"},
+		Local:       true,
+	})
+
+	require.True(t, configured.Equals(listed))
+	require.True(t, listed.Equals(configured))
+}
+
+func TestEntryFromAuditMovesFilterOutOfOptions(t *testing.T) {
+	configured := entry{
+		Path:    "file/",
+		Type:    "file",
+		Options: map[string]string{"file_path": "/var/log/vault/vault_audit.log"},
+		Filter:  `mount_type == "kv"`,
+	}
+
+	listed := entryFromAudit(&api.Audit{
+		Path:    "file/",
+		Type:    "file",
+		Options: configured.options(),
+	})
+
+	require.Equal(t, configured, listed)
+	require.True(t, configured.Equals(listed))
+
+	configured.Filter = `mount_type == "pki"`
+	require.Equal(t, []string{"filter"}, configured.Differences(listed))
+}
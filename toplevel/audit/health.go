@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// probeTimeout bounds how long a single sink probe may take.
+const probeTimeout = 5 * time.Second
+
+// writable is the mode checked by access(2) for a directory to be writable.
+const writable = 0x2
+
+// errProbeSkipped is returned by a probe when the sink cannot be checked from
+// where vault-manager is running.
+var errProbeSkipped = errors.New("sink cannot be checked from this host")
+
+// healthCheckEnabled reports whether the opt-in sink health check has been
+// requested through the AUDIT_HEALTH_CHECK environment variable.
+func healthCheckEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("AUDIT_HEALTH_CHECK"))
+	return err == nil && enabled
+}
+
+// checkSinks performs a best-effort liveness check against the sinks of the
+// provided Audit Devices and reports every device that appears unhealthy.
+//
+// Vault does not surface failing sinks through ListAudit, so this only tells
+// whether the sink is reachable from vault-manager, not from Vault itself.
+//
+// In dry-run mode, the checks leave no trace: file sinks are only checked for
+// permissions, without writing to their directory.
+func checkSinks(entries []entry, dryRun bool) {
+	for _, e := range entries {
+		var err error
+		switch e.Type {
+		case "socket":
+			err = probeSocket(e.Options)
+		case "file":
+			err = probeFile(e.Options, dryRun)
+		default:
+			continue
+		}
+
+		switch err {
+		case nil:
+			logrus.WithField("path", e.Path).Debug("audit sink is healthy")
+		case errProbeSkipped:
+			logrus.WithField("path", e.Path).Debug("skipping audit sink health check")
+		default:
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"path": e.Path,
+				"type": e.Type,
+			}).Warn("audit sink appears to be unhealthy")
+		}
+	}
+}
+
+// probeSocket attempts a connection to the address of a socket Audit Device.
+//
+// Connectionless socket types always succeed, so they are not checked.
+func probeSocket(options map[string]string) error {
+	socketType := options["socket_type"]
+	if socketType == "" {
+		socketType = "tcp"
+	}
+	if socketType != "tcp" && socketType != "unix" {
+		return errProbeSkipped
+	}
+
+	address := options["address"]
+	if address == "" {
+		address = "127.0.0.1:9090"
+	}
+
+	conn, err := net.DialTimeout(socketType, address, probeTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeFile checks that the directory of a file Audit Device exists and is
+// writable, by writing a probe file to it unless in dry-run mode.
+//
+// The directory is only visible when vault-manager shares a filesystem with
+// Vault; if it cannot be found the check is skipped.
+func probeFile(options map[string]string, dryRun bool) error {
+	path := options["file_path"]
+	if path == "" {
+		path = options["path"]
+	}
+	if path == "" || path == "stdout" || path == "discard" {
+		return errProbeSkipped
+	}
+
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return errProbeSkipped
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("parent of file_path is not a directory")
+	}
+	if dryRun {
+		return syscall.Access(dir, writable)
+	}
+
+	f, err := ioutil.TempFile(dir, ".vault-manager-probe")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write([]byte{0}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeSocket(t *testing.T) {
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer up.Close()
+
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	downAddress := down.Addr().String()
+	require.NoError(t, down.Close())
+
+	table := []struct {
+		description string
+		options     map[string]string
+		healthy     bool
+		skipped     bool
+	}{
+		{"listener up is healthy", map[string]string{"address": up.Addr().String()}, true, false},
+		{"listener down is unhealthy", map[string]string{"address": downAddress, "socket_type": "tcp"}, false, false},
+		{"udp is skipped", map[string]string{"address": downAddress, "socket_type": "udp"}, false, true},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			err := probeSocket(tt.options)
+			switch {
+			case tt.skipped:
+				require.Equal(t, errProbeSkipped, err)
+			case tt.healthy:
+				require.NoError(t, err)
+			default:
+				require.Error(t, err)
+				require.NotEqual(t, errProbeSkipped, err)
+			}
+		})
+	}
+}
+
+func TestProbeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0600))
+
+	table := []struct {
+		description string
+		filePath    string
+		dryRun      bool
+		healthy     bool
+		skipped     bool
+	}{
+		{"writable directory is healthy", filepath.Join(dir, "audit.log"), false, true, false},
+		{"writable directory is healthy in dry-run", filepath.Join(dir, "audit.log"), true, true, false},
+		{"missing directory is skipped", filepath.Join(dir, "missing", "audit.log"), false, false, true},
+		{"stdout is skipped", "stdout", false, false, true},
+		{"parent that isn't a directory is unhealthy", filepath.Join(file, "audit.log"), false, false, false},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			err := probeFile(map[string]string{"file_path": tt.filePath}, tt.dryRun)
+			switch {
+			case tt.skipped:
+				require.Equal(t, errProbeSkipped, err)
+			case tt.healthy:
+				require.NoError(t, err)
+			default:
+				require.Error(t, err)
+				require.NotEqual(t, errProbeSkipped, err)
+			}
+		})
+	}
+}
+
+func TestProbeFileInDryRunWritesNothing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, probeFile(map[string]string{"file_path": filepath.Join(dir, "audit.log")}, true))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
@@ -3,11 +3,13 @@
 package auth
 
 import (
-	"log"
+	"context"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 
@@ -16,11 +18,11 @@ import (
 )
 
 type entry struct {
-	Path           string                            `yaml:"_path"`
-	Type           string                            `yaml:"type"`
-	Description    string                            `yaml:"description"`
-	Settings       map[string]map[string]interface{} `yaml:"settings"`
-	PolicyMappings []PolicyMapping                   `yaml:"policy_mappings"`
+	Path           string                            `yaml:"_path" validate:"required"`
+	Type           string                            `yaml:"type" validate:"required"`
+	Description    string                            `yaml:"description,omitempty"`
+	Settings       map[string]map[string]interface{} `yaml:"settings,omitempty"`
+	PolicyMappings []PolicyMapping                   `yaml:"policy_mappings,omitempty"`
 }
 
 type PolicyMapping struct {
@@ -28,7 +30,7 @@ type PolicyMapping struct {
 	Policies   []map[string]interface{} `yaml:"policies"`
 }
 
-var _ vault.Item = entry{}
+var _ vault.FieldDiffer = entry{}
 
 func (e entry) Key() string {
 	return e.Path
@@ -44,146 +46,277 @@ func (e entry) Equals(i interface{}) bool {
 		e.Type == entry.Type
 }
 
-func (e entry) enable(client *api.Client) {
+// Differences returns the names of the fields that differ from another entry.
+func (e entry) Differences(i interface{}) []string {
+	entry, ok := i.(entry)
+	if !ok || e.Type == entry.Type {
+		return nil
+	}
+	return []string{"type"}
+}
+
+func (e entry) FieldValue(field string) interface{} {
+	return e.Type
+}
+
+func (e entry) enable(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_auth_backends", Key: e.Path, Operation: "enable"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
 	if err := client.Sys().EnableAuthWithOptions(e.Path, &api.EnableAuthOptions{
 		Type:        e.Type,
 		Description: e.Description,
 	}); err != nil {
-		logrus.WithError(err).WithField("path", e.Path).Fatal("failed to enable auth backend")
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to enable auth backend %s", e.Path)
 	}
+	vault.ForgetAuthAccessors()
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
 	logrus.WithFields(logrus.Fields{
 		"path": e.Path,
 		"type": e.Type,
 	}).Info("successfully enabled auth backend")
+	return nil
 }
 
-func (e entry) disable(client *api.Client) {
+func (e entry) disable(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_auth_backends", Key: e.Path, Operation: "disable"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
 	if err := client.Sys().DisableAuth(e.Path); err != nil {
-		logrus.WithError(err).WithField("path", e.Path).Fatal("failed to disable auth backend")
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to disable auth backend %s", e.Path)
 	}
+	vault.ForgetAuthAccessors()
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
 	logrus.WithField("path", e.Path).Info("successfully disabled auth backend")
+	return nil
 }
 
 type config struct{}
 
 var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+var _ toplevel.Exporter = config{}
 
 func init() {
 	toplevel.RegisterConfiguration("vault_auth_backends", config{})
 }
 
+// Validate checks the authentication backend configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
 // Apply ensures that an instance of Vault's authentication backends are
 // configured exactly as provided.
-//
-// This function exits the program if an error occurs.
-func (c config) Apply(entriesBytes []byte, dryRun bool) {
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
 	// Unmarshal the list of configured auth backends.
 	var entries []entry
 	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
-		logrus.WithError(err).Fatal("failed to decode authentication backend configuration")
+		return errors.Wrap(err, "failed to decode authentication backend configuration")
 	}
 
-	// Get the existing enabled auth backends.
-	existingAuthMounts, err := vault.ClientFromEnv().Sys().ListAuth()
+	existingBackends, err := existingEntries(ctx)
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to list authentication backends from Vault instance")
+		return err
 	}
 
-	// Build a list of all the existing entries.
-	existingBackends := make([]entry, 0)
-	if existingAuthMounts != nil {
-		for path, backend := range existingAuthMounts {
-			existingBackends = append(existingBackends, entry{
-				Path:        path,
-				Type:        backend.Type,
-				Description: backend.Description,
-			})
-		}
+	toBeWritten, toBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:       "vault_auth_backends",
+		Package:    "auth",
+		Desired:    asItems(entries),
+		Existing:   asItems(existingBackends),
+		Operations: operations,
+		Skip: func(e vault.Item, delete bool) bool {
+			// the token auth method is never disabled
+			return delete && strings.HasPrefix(e.Key(), "token/")
+		},
+	}, dryRun)
+	if err != nil {
+		return err
 	}
 
-	toBeWritten, toBeDeleted := vault.DiffItems(asItems(entries), asItems(existingBackends))
+	if err := enableAuth(ctx, toBeWritten); err != nil {
+		return err
+	}
 
-	enableAuth(toBeWritten, dryRun)
+	// The settings and policy mappings of the auth mounts are written where
+	// they differ from the configuration.
+	actions, err := mountActions(ctx, entries)
+	if err != nil {
+		return err
+	}
+	if err := vault.Act(ctx, "vault_auth_backends", "auth", actions, dryRun); err != nil {
+		return err
+	}
 
-	configureAuthMounts(entries, dryRun)
+	if err := disableAuth(ctx, toBeDeleted); err != nil {
+		return err
+	}
 
-	disableAuth(toBeDeleted, dryRun)
+	return nil
+}
 
-	// apply policy mappings
-	for _, e := range entries {
-		if e.PolicyMappings != nil {
-			for _, policyMapping := range e.PolicyMappings {
-				var policies []string
-				for _, policy := range policyMapping.Policies {
-					policies = append(policies, policy["name"].(string))
-				}
-				path := filepath.Join("/auth", e.Path, "map/teams", policyMapping.GithubTeam["team"].(string))
-				data := map[string]interface{}{"key": policyMapping.GithubTeam["team"], "value": strings.Join(policies, ",")}
-				writeMapping(path, data, dryRun)
-			}
+// Export returns the authentication backends enabled on an instance of Vault,
+// except for the token one. Their settings and policy mappings aren't exported.
+func (c config) Export(ctx context.Context) (interface{}, error) {
+	existingBackends, err := existingEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exported := make([]entry, 0, len(existingBackends))
+	for _, e := range existingBackends {
+		if !strings.HasPrefix(e.Path, "token/") {
+			exported = append(exported, e)
 		}
 	}
+	sort.Slice(exported, func(i, j int) bool { return exported[i].Path < exported[j].Path })
+	return exported, nil
+}
+
+// existingEntries lists the authentication backends enabled on an instance of
+// Vault.
+func existingEntries(ctx context.Context) ([]entry, error) {
+	// Get the existing enabled auth backends.
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existingAuthMounts, err := client.Sys().ListAuth()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list authentication backends from Vault instance")
+	}
+
+	// Build a list of all the existing entries.
+	existingBackends := make([]entry, 0)
+	for path, backend := range existingAuthMounts {
+		existingBackends = append(existingBackends, entry{
+			Path:        path,
+			Type:        backend.Type,
+			Description: backend.Description,
+		})
+	}
+	return existingBackends, nil
 }
 
-func enableAuth(toBeWritten []vault.Item, dryRun bool) {
+func enableAuth(ctx context.Context, toBeWritten []vault.Item) error {
 	// TODO(riuvshin): implement auth tuning
 	for _, e := range toBeWritten {
-		if dryRun == true {
-			logrus.Infof("[Dry Run]\tpackage=auth\tauth to be enabled='%v'", e.(entry))
-		} else {
-			e.(entry).enable(vault.ClientFromEnv())
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := e.(entry).enable(client); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func configureAuthMounts(entries []entry, dryRun bool) {
-	// configure auth mounts
+// mountActions lists the settings and policy mappings of the auth mounts that
+// differ from their configuration.
+func mountActions(ctx context.Context, entries []entry) ([]vault.Action, error) {
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]vault.Action, 0)
 	for _, e := range entries {
-		if e.Settings != nil {
-			for name, cfg := range e.Settings {
-				path := filepath.Join("auth", e.Path, name)
-				if !vault.DataInSecret(cfg, path, vault.ClientFromEnv()) {
-					if dryRun == true {
-						logrus.Infof("[Dry Run]\tpackage=auth\tauth config to be written path='%v' config='%v'", path, e.Settings)
-					} else {
-						_, err := vault.ClientFromEnv().Logical().Write(path, cfg)
-						if err != nil {
-							log.Fatal(err)
-						}
-						logrus.WithField("path", path).WithField("type", e.Type).Info("auth mount successfully configured")
-					}
-				}
+		e := e
+		names := make([]string, 0, len(e.Settings))
+		for name := range e.Settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			path := filepath.Join("auth", e.Path, name)
+			cfg := e.Settings[name]
+			configured, err := vault.DataInSecret(cfg, path, client)
+			if err != nil {
+				return nil, err
+			}
+			if !configured {
+				actions = append(actions, vault.Action{
+					Name:       "configure",
+					Key:        path,
+					Data:       cfg,
+					Operations: []vault.Operation{vault.WriteOperation(path, false)},
+					Perform:    func(client *api.Client) error { return e.configure(client, path, cfg) },
+				})
 			}
 		}
+
+		for _, policyMapping := range e.PolicyMappings {
+			var policies []string
+			for _, policy := range policyMapping.Policies {
+				policies = append(policies, policy["name"].(string))
+			}
+			path := filepath.Join("auth", e.Path, "map/teams", policyMapping.GithubTeam["team"].(string))
+			data := map[string]interface{}{"key": policyMapping.GithubTeam["team"], "value": strings.Join(policies, ",")}
+			written, err := vault.DataInSecret(data, path, client)
+			if err != nil {
+				return nil, err
+			}
+			if !written {
+				actions = append(actions, vault.Action{
+					Name:       "write policy mapping",
+					Key:        path,
+					Data:       data,
+					Operations: []vault.Operation{vault.WriteOperation(path, false)},
+					Perform:    func(client *api.Client) error { return writeMapping(client, path, data) },
+				})
+			}
+		}
+	}
+	return actions, nil
+}
+
+func (e entry) configure(client *api.Client, path string, cfg map[string]interface{}) error {
+	event := toplevel.Event{Name: "vault_auth_backends", Key: path, Operation: "configure"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(path, cfg); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to configure auth mount %s", path)
 	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", path).WithField("type", e.Type).Info("auth mount successfully configured")
+	return nil
 }
 
-func disableAuth(toBeDeleted []vault.Item, dryRun bool) {
+func disableAuth(ctx context.Context, toBeDeleted []vault.Item) error {
 	for _, e := range toBeDeleted {
-		ent := e.(entry)
-		if strings.HasPrefix(ent.Path, "token/") {
-			continue
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
 		}
-		if dryRun == true {
-			logrus.Infof("[Dry Run]\tpackage=auth\tauth to be disabled='%v'", ent.Path)
-		} else {
-			ent.disable(vault.ClientFromEnv())
+		if err := e.(entry).disable(client); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func writeMapping(path string, data map[string]interface{}, dryRun bool) {
-	if !vault.DataInSecret(data, path, vault.ClientFromEnv()) {
-		if dryRun == true {
-			logrus.Infof("[Dry Run]\tpackage=auth\tpolicies mapping to be written path='%v' policies='%v'", path, data["value"])
-		} else {
-			_, err := vault.ClientFromEnv().Logical().Write(path, data)
-			if err != nil {
-				logrus.Fatal(err)
-			}
-			logrus.WithField("path", path).WithField("policies", data["value"]).Info("policy mapping is successfully written")
-		}
+func writeMapping(client *api.Client, path string, data map[string]interface{}) error {
+	event := toplevel.Event{Name: "vault_auth_backends", Key: path, Operation: "write"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(path, data); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to write policy mapping %s", path)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", path).WithField("policies", data["value"]).Info("policy mapping is successfully written")
+	return nil
+}
+
+// operations lists the requests made to Vault to enable, or disable, an auth
+// mount.
+func operations(e vault.Item, delete bool) []vault.Operation {
+	if delete {
+		return []vault.Operation{vault.DeleteOperation(filepath.Join("sys/auth", e.Key()), true)}
 	}
+	return []vault.Operation{vault.WriteOperation(filepath.Join("sys/auth", e.Key()), true)}
 }
 
 func asItems(xs []entry) (items []vault.Item) {
@@ -0,0 +1,133 @@
+// Package aws implements the application of a declarative configuration
+// for Vault AWS secrets engines.
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConfig lists the settings of the secrets engine that Vault never
+// returns.
+var sensitiveConfig = []string{"secret_key"}
+
+// policyDocumentKey is the setting of a role holding an IAM policy document.
+const policyDocumentKey = "policy_document"
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	// Config holds the settings written to <path>/config/<name>, e.g. the
+	// root and lease settings.
+	Config map[string]map[string]interface{} `yaml:"config"`
+	Roles  []role                            `yaml:"roles"`
+}
+
+type role struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_aws", config{})
+}
+
+// Validate checks the aws configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the settings and roles of AWS secrets engines are
+// configured exactly as provided.
+//
+// Roles of a declared secrets engine that are missing from the configuration
+// are deleted; secrets engines that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode aws configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		desiredSettings, existingSettings, err := endpoint.Settings(client, e.Path, e.Config, sensitiveConfig)
+		if err != nil {
+			return err
+		}
+		desired = append(desired, desiredSettings...)
+		existing = append(existing, existingSettings...)
+
+		for _, r := range e.Roles {
+			role, err := withPolicyDocument(endpoint.Entry{Path: path.Join(e.Path, "roles", r.Name), Data: r.Options})
+			if err != nil {
+				return err
+			}
+			desired = append(desired, role)
+		}
+		existingRoles, err := endpoint.ReadAll(client, path.Join(e.Path, "roles"))
+		if err != nil {
+			return err
+		}
+		for _, r := range existingRoles {
+			role, err := withPolicyDocument(r)
+			if err != nil {
+				return err
+			}
+			existing = append(existing, role)
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_aws", desired, existing, dryRun)
+}
+
+// withPolicyDocument normalizes the policy document of a role so that it can
+// be compared regardless of its formatting. The document may be declared
+// either as a JSON string or as a mapping.
+func withPolicyDocument(e endpoint.Entry) (endpoint.Entry, error) {
+	document, ok := e.Data[policyDocumentKey]
+	if !ok {
+		return e, nil
+	}
+
+	if s, isString := document.(string); isString {
+		if s == "" {
+			return e, nil
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+			return e, errors.Wrapf(err, "failed to decode policy document of %s", e.Path)
+		}
+		document = decoded
+	}
+
+	b, err := json.Marshal(endpoint.Normalize(document))
+	if err != nil {
+		return e, errors.Wrapf(err, "failed to encode policy document of %s", e.Path)
+	}
+
+	data := make(map[string]interface{}, len(e.Data))
+	for k, v := range e.Data {
+		data[k] = v
+	}
+	data[policyDocumentKey] = string(b)
+	e.Data = data
+	return e, nil
+}
@@ -0,0 +1,41 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+func TestPolicyDocumentsAreComparedRegardlessOfFormatting(t *testing.T) {
+	configured, err := withPolicyDocument(endpoint.Entry{
+		Path: "aws/roles/s3",
+		Data: map[string]interface{}{
+			"credential_type": "iam_user",
+			"policy_document": map[interface{}]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []interface{}{map[interface{}]interface{}{
+					"Effect":   "Allow",
+					"Action":   "s3:*",
+					"Resource": "*",
+				}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	listed, err := withPolicyDocument(endpoint.Entry{
+		Path: "aws/roles/s3",
+		Data: map[string]interface{}{
+			"credential_type": "iam_user",
+			"policy_document": `{
+  "Statement": [{"Resource": "*", "Action": "s3:*", "Effect": "Allow"}],
+  "Version": "2012-10-17"
+}`,
+		},
+	})
+	require.NoError(t, err)
+
+	require.Empty(t, configured.Differences(listed))
+}
@@ -0,0 +1,100 @@
+// Package azure implements the application of a declarative configuration
+// for Vault Azure secrets engines.
+package azure
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConfig lists the settings of the secrets engine that Vault never
+// returns.
+var sensitiveConfig = []string{"client_secret"}
+
+// encodedSettings lists the settings of a role that Vault expects as JSON
+// strings.
+var encodedSettings = []string{"azure_roles", "azure_groups"}
+
+type entry struct {
+	Path   string                 `yaml:"_path" validate:"required"`
+	Config map[string]interface{} `yaml:"config"`
+	Roles  []role                 `yaml:"roles"`
+}
+
+type role struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_azure", config{})
+}
+
+// Validate checks the azure configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config and roles of Azure secrets engines are
+// configured exactly as provided.
+//
+// Roles of a declared secrets engine that are missing from the configuration
+// are deleted; secrets engines that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode azure configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		if e.Config != nil {
+			configPath := path.Join(e.Path, "config")
+			desired = append(desired, endpoint.Entry{Path: configPath, Data: e.Config, Sensitive: sensitiveConfig})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingConfig, ok, err := endpoint.Read(client, configPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingConfig)
+			}
+		}
+
+		for _, r := range e.Roles {
+			role, err := endpoint.EncodeJSON(endpoint.Entry{Path: path.Join(e.Path, "roles", r.Name), Data: r.Options}, encodedSettings...)
+			if err != nil {
+				return err
+			}
+			desired = append(desired, role)
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingRoles, err := endpoint.ReadAll(client, path.Join(e.Path, "roles"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingRoles...)
+	}
+
+	return endpoint.Apply(ctx, "vault_azure", desired, existing, dryRun)
+}
@@ -0,0 +1,148 @@
+// Package cert implements the application of a declarative configuration
+// for Vault TLS certificate auth methods and their trusted certificates.
+package cert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// certificateKey is the setting of trusted certificates holding their PEM
+// encoding.
+const certificateKey = "certificate"
+
+type entry struct {
+	Path   string                 `yaml:"_path" validate:"required"`
+	Config map[string]interface{} `yaml:"config"`
+	Certs  []cert                 `yaml:"certs"`
+}
+
+// cert is a trusted CA or client certificate, along with the settings of the
+// tokens issued to the clients it authenticates.
+type cert struct {
+	Name        string                 `yaml:"name" validate:"required"`
+	Certificate string                 `yaml:"certificate"`
+	Options     map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_cert_auth", config{})
+}
+
+// Validate checks the cert auth configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config and trusted certificates of TLS certificate
+// auth methods are configured exactly as provided.
+//
+// Certificates are compared by fingerprint, so that their PEM encoding may be
+// formatted differently than the one returned by Vault. Certificates of a
+// declared auth method that are missing from the configuration are deleted;
+// auth methods that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode cert auth configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		mount := path.Join("auth", e.Path)
+
+		if e.Config != nil {
+			configPath := path.Join(mount, "config")
+			desired = append(desired, endpoint.Entry{Path: configPath, Data: e.Config})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingConfig, ok, err := endpoint.Read(client, configPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingConfig)
+			}
+		}
+
+		declared := make(map[string]string, len(e.Certs))
+		for _, crt := range e.Certs {
+			data := make(map[string]interface{}, len(crt.Options)+1)
+			for k, v := range crt.Options {
+				data[k] = v
+			}
+			data[certificateKey] = crt.Certificate
+
+			p := path.Join(mount, "certs", crt.Name)
+			declared[p] = crt.Certificate
+			desired = append(desired, endpoint.Entry{Path: p, Data: data})
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingCerts, err := endpoint.ReadAll(client, path.Join(mount, "certs"))
+		if err != nil {
+			return err
+		}
+		for _, crt := range existingCerts {
+			existing = append(existing, withDeclaredCertificate(crt, declared[crt.Path]))
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_cert_auth", desired, existing, dryRun)
+}
+
+// withDeclaredCertificate replaces the certificate returned by Vault with the
+// declared one if they have the same fingerprints.
+func withDeclaredCertificate(e endpoint.Entry, declared string) endpoint.Entry {
+	returned, _ := e.Data[certificateKey].(string)
+	if declared == "" || fingerprints(returned) == "" || fingerprints(returned) != fingerprints(declared) {
+		return e
+	}
+
+	data := make(map[string]interface{}, len(e.Data))
+	for k, v := range e.Data {
+		data[k] = v
+	}
+	data[certificateKey] = declared
+
+	e.Data = data
+	return e
+}
+
+// fingerprints returns the SHA-256 fingerprints of the certificates of a PEM
+// bundle, or "" if it contains none.
+func fingerprints(bundle string) string {
+	sums := make([]string, 0)
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		sum := sha256.Sum256(block.Bytes)
+		sums = append(sums, hex.EncodeToString(sum[:]))
+	}
+	return strings.Join(sums, ",")
+}
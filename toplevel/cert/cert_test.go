@@ -0,0 +1,44 @@
+package cert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+const certificate = `-----BEGIN CERTIFICATE-----
+MIIBhTCCASugAwIBAgIQIRi6zePL6mKjOipn+dNuaTAKBggqhkjOPQQDAjASMRAw
+DgYDVQQKEwdBY21lIENvMB4XDTE3MTAyMDE5NDMwNloXDTE4MTAyMDE5NDMwNlow
+EjEQMA4GA1UEChMHQWNtZSBDbzBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABD0d
+7VNhbWvZLWPuj/RtHFjvtJBEwOkhbN/BnnE8rnZR8+sbwnc/KhCk3FhnpHZnQz7B
+5aETbbIgmuvewdjvSBSjYzBhMA4GA1UdDwEB/wQEAwICpDATBgNVHSUEDDAKBggr
+BgEFBQcDATAPBgNVHRMBAf8EBTADAQH/MCkGA1UdEQQiMCCCDmxvY2FsaG9zdDo1
+NDUzgg4xMjcuMC4wLjE6NTQ1MzAKBggqhkjOPQQDAgNIADBFAiEA2zpJEPQyz6/l
+Wf86aX6PepsntZv2GYlA5UpabfT2EZICICpJ5h/iI+i341gBmLiAFQOyTDT+/wQc
+6MF9+Yw1Yy0t
+-----END CERTIFICATE-----
+`
+
+func TestCertificatesAreComparedByFingerprint(t *testing.T) {
+	// the same certificate, with Windows line endings and a leading blank line
+	declared := "\r\n" + strings.Replace(strings.TrimSpace(certificate), "\n", "\r\n", -1)
+	returned := endpoint.Entry{
+		Path: "auth/cert/certs/web",
+		Data: map[string]interface{}{certificateKey: certificate, "token_ttl": 3600},
+	}
+
+	desired := endpoint.Entry{
+		Path: "auth/cert/certs/web",
+		Data: map[string]interface{}{certificateKey: declared, "token_ttl": "1h"},
+	}
+	require.Empty(t, desired.Differences(withDeclaredCertificate(returned, declared)))
+
+	other := endpoint.Entry{
+		Path: "auth/cert/certs/web",
+		Data: map[string]interface{}{certificateKey: "not a certificate"},
+	}
+	require.Equal(t, []string{certificateKey}, other.Differences(withDeclaredCertificate(returned, "not a certificate")))
+}
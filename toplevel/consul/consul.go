@@ -0,0 +1,85 @@
+// Package consul implements the application of a declarative configuration
+// for Vault Consul secrets engines.
+package consul
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConfig lists the settings of the secrets engine that Vault never
+// returns.
+var sensitiveConfig = []string{"token", "client_key"}
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	// Config holds the settings written to <path>/config/<name>, e.g. the
+	// access settings.
+	Config map[string]map[string]interface{} `yaml:"config"`
+	Roles  []role                            `yaml:"roles"`
+}
+
+type role struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_consul", config{})
+}
+
+// Validate checks the consul configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the settings and roles of Consul secrets engines are
+// configured exactly as provided.
+//
+// Roles of a declared secrets engine that are missing from the configuration
+// are deleted; secrets engines that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode consul configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		desiredSettings, existingSettings, err := endpoint.Settings(client, e.Path, e.Config, sensitiveConfig)
+		if err != nil {
+			return err
+		}
+		desired = append(desired, desiredSettings...)
+		existing = append(existing, existingSettings...)
+
+		for _, r := range e.Roles {
+			desired = append(desired, endpoint.Entry{Path: path.Join(e.Path, "roles", r.Name), Data: r.Options})
+		}
+		existingRoles, err := endpoint.ReadAll(client, path.Join(e.Path, "roles"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingRoles...)
+	}
+
+	return endpoint.Apply(ctx, "vault_consul", desired, existing, dryRun)
+}
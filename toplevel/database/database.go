@@ -0,0 +1,179 @@
+// Package database implements the application of a declarative configuration
+// for Vault database secrets engines.
+package database
+
+import (
+	"context"
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConnection lists the settings of a connection that Vault never
+// returns.
+var sensitiveConnection = []string{"password", "private_key", "verify_connection"}
+
+type entry struct {
+	Path        string       `yaml:"_path" validate:"required"`
+	Connections []object     `yaml:"connections"`
+	Roles       []object     `yaml:"roles"`
+	StaticRoles []staticRole `yaml:"static_roles"`
+}
+
+// object is a connection or role of the secrets engine.
+type object struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// staticRole is a role managing the credentials of an existing database user.
+type staticRole struct {
+	object `yaml:",inline"`
+	// RotateOnChange rotates the credentials as soon as the rotation settings
+	// of an existing role change, rather than at the end of the former period.
+	RotateOnChange bool `yaml:"rotate_on_change"`
+}
+
+// rotationSettings lists the settings of a static role that trigger a rotation
+// of its credentials when RotateOnChange is set.
+var rotationSettings = []string{"rotation_period", "rotation_statements"}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_database", config{})
+}
+
+// Validate checks the database configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the connections, roles and static roles of database
+// secrets engines are configured exactly as provided.
+//
+// Connections and roles of a declared secrets engine that are missing from the
+// configuration are deleted; secrets engines that aren't declared are left
+// untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode database configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	toBeRotated := make([]string, 0)
+	for _, e := range entries {
+		for _, conn := range e.Connections {
+			desired = append(desired, endpoint.Entry{
+				Path:      path.Join(e.Path, "config", conn.Name),
+				Data:      conn.Options,
+				Sensitive: sensitiveConnection,
+			})
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingConfigs, err := endpoint.ReadAll(client, path.Join(e.Path, "config"))
+		if err != nil {
+			return err
+		}
+		for _, conn := range existingConfigs {
+			existing = append(existing, flattenConnection(conn))
+		}
+
+		for _, r := range e.Roles {
+			desired = append(desired, endpoint.Entry{Path: path.Join(e.Path, "roles", r.Name), Data: r.Options})
+		}
+		existingRoles, err := endpoint.ReadAll(client, path.Join(e.Path, "roles"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingRoles...)
+
+		existingStaticRoles, err := endpoint.ReadAll(client, path.Join(e.Path, "static-roles"))
+		if err != nil {
+			return err
+		}
+		for _, r := range e.StaticRoles {
+			role := endpoint.Entry{Path: path.Join(e.Path, "static-roles", r.Name), Data: r.Options}
+			desired = append(desired, role)
+			if r.RotateOnChange && rotationChanged(role, existingStaticRoles) {
+				toBeRotated = append(toBeRotated, path.Join(e.Path, "rotate-role", r.Name))
+			}
+		}
+		existing = append(existing, existingStaticRoles...)
+	}
+
+	if err := endpoint.Apply(ctx, "vault_database", desired, existing, dryRun); err != nil {
+		return err
+	}
+
+	actions := make([]vault.Action, 0, len(toBeRotated))
+	for _, p := range toBeRotated {
+		p := p
+		actions = append(actions, vault.Action{
+			Name:       "rotate",
+			Key:        p,
+			Operations: []vault.Operation{vault.WriteOperation(p, false)},
+			Perform:    func(client *api.Client) error { return rotate(client, p) },
+		})
+	}
+	return vault.Act(ctx, "vault_database", "database", actions, dryRun)
+}
+
+// rotationChanged reports whether the rotation settings of an existing static
+// role differ from the configured ones.
+func rotationChanged(role endpoint.Entry, existing []endpoint.Entry) bool {
+	for _, e := range existing {
+		if !vault.EqualPathNames(e.Path, role.Path) {
+			continue
+		}
+		for _, field := range role.Differences(e) {
+			for _, s := range rotationSettings {
+				if field == s {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func rotate(client *api.Client, p string) error {
+	event := toplevel.Event{Name: "vault_database", Key: p, Operation: "rotate"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(p, nil); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to rotate static role credentials %s", p)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", p).Info("successfully rotated static role credentials")
+	return nil
+}
+
+// flattenConnection moves the plugin-specific settings that Vault returns
+// under connection_details next to the other settings, where they are written.
+func flattenConnection(e endpoint.Entry) endpoint.Entry {
+	details, _ := e.Data["connection_details"].(map[string]interface{})
+	for k, v := range details {
+		if _, ok := e.Data[k]; !ok {
+			e.Data[k] = v
+		}
+	}
+	delete(e.Data, "connection_details")
+	return e
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+func TestFlattenedConnectionEqualsConfig(t *testing.T) {
+	configured := endpoint.Entry{
+		Path: "database/config/postgres",
+		Data: map[string]interface{}{
+			"plugin_name":    "postgresql-database-plugin",
+			"connection_url": "postgresql://{{username}}:{{password}}@db:5432/postgres",
+			"username":       "vault",
+			"password":       "secret",
+			"allowed_roles":  []interface{}{"readonly"},
+		},
+		Sensitive: sensitiveConnection,
+	}
+
+	listed := flattenConnection(endpoint.Entry{
+		Path: "database/config/postgres",
+		Data: map[string]interface{}{
+			"plugin_name": "postgresql-database-plugin",
+			"connection_details": map[string]interface{}{
+				"connection_url": "postgresql://{{username}}:{{password}}@db:5432/postgres",
+				"username":       "vault",
+			},
+			"allowed_roles": []interface{}{"readonly"},
+		},
+	})
+
+	require.Empty(t, configured.Differences(listed))
+}
+
+func TestRotationChanged(t *testing.T) {
+	existing := []endpoint.Entry{{
+		Path: "database/static-roles/app",
+		Data: map[string]interface{}{
+			"db_name":         "postgres",
+			"username":        "app",
+			"rotation_period": json.Number("86400"),
+		},
+	}}
+
+	unchanged := endpoint.Entry{Path: "database/static-roles/app", Data: map[string]interface{}{"username": "app", "rotation_period": "24h"}}
+	require.False(t, rotationChanged(unchanged, existing))
+
+	otherSetting := endpoint.Entry{Path: "database/static-roles/app", Data: map[string]interface{}{"db_name": "mysql", "rotation_period": "24h"}}
+	require.False(t, rotationChanged(otherSetting, existing))
+
+	period := endpoint.Entry{Path: "database/static-roles/app", Data: map[string]interface{}{"rotation_period": "12h"}}
+	require.True(t, rotationChanged(period, existing))
+
+	created := endpoint.Entry{Path: "database/static-roles/new", Data: map[string]interface{}{"rotation_period": "12h"}}
+	require.False(t, rotationChanged(created, existing))
+}
@@ -0,0 +1,535 @@
+// Package endpoint implements the reconciliation of configuration that is
+// stored as data at Vault API paths, such as the config and roles of auth
+// methods and secrets engines.
+//
+// Top-levels built on this package decode their configuration into entries,
+// read the matching existing entries from Vault and leave the diffing and
+// applying to Apply.
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+)
+
+// redacted replaces the values of sensitive keys when an entry is logged.
+const redacted = "<redacted>"
+
+// Entry is a piece of configuration written as data to a single path.
+//
+// Only the keys declared in the data of the desired entry are compared, as
+// Vault returns every setting of an endpoint, including defaults.
+type Entry struct {
+	// Path is where the data is written, e.g. "auth/kubernetes/role/app".
+	Path string
+	// Data is the payload written to the path. String values may reference
+	// secrets stored in the environment or in files, which are resolved when
+	// the entry is applied.
+	Data map[string]interface{}
+	// Sensitive lists the keys of Data that Vault never returns, such as
+	// passwords. They are written but neither compared nor logged.
+	Sensitive []string
+	// Compared, if set, restricts the comparison to these keys of Data, for
+	// keys that Vault returns transformed or not at all.
+	Compared []string
+	// Sudo is true if the path is root-protected.
+	Sudo bool
+	// ID, if set, identifies the entry instead of its path, for entries whose
+	// identity includes some of their data. An entry deleted from a path that
+	// another entry is written to is deleted first.
+	ID string
+	// Ordered is true if the entries after it depend on it, so that it's
+	// never written at the same time as the entries sharing its parent path.
+	Ordered bool
+
+	// name is the top-level that the entry belongs to.
+	name string
+}
+
+var _ vault.FieldDiffer = Entry{}
+var _ vault.Digester = Entry{}
+var _ vault.Barrier = Entry{}
+
+// Key returns the ID of the entry, or its path if it has none.
+func (e Entry) Key() string {
+	if e.ID != "" {
+		return e.ID
+	}
+	return e.Path
+}
+
+// Barrier reports whether the entry is written on its own.
+func (e Entry) Barrier() bool {
+	return e.Ordered
+}
+
+// Equals reports whether the declared data of the entry is stored in
+// another entry.
+func (e Entry) Equals(i interface{}) bool {
+	entry, ok := i.(Entry)
+	if !ok {
+		return false
+	}
+
+	// a policy that can't be read is reported by Apply before comparing entries
+	policy, _ := vault.FieldPolicyFor(e.name)
+	return vault.EqualPathNames(e.Key(), entry.Key()) &&
+		!policy.Significant(e.Differences(entry))
+}
+
+// Differences returns the declared keys whose values differ from another
+// entry.
+func (e Entry) Differences(i interface{}) []string {
+	entry, ok := i.(Entry)
+	if !ok {
+		return nil
+	}
+
+	desired := make(map[string]interface{}, len(e.Data))
+	existing := make(map[string]interface{}, len(e.Data))
+	for k, v := range e.Data {
+		if e.sensitive(k) || !e.compared(k) {
+			continue
+		}
+		desired[k] = comparable(v)
+		if ev, ok := entry.Data[k]; ok {
+			existing[k] = comparable(ev)
+		}
+	}
+
+	return vault.OptionsDiff(desired, existing)
+}
+
+// FieldValue returns the value of a key of Data, redacted if it's sensitive.
+func (e Entry) FieldValue(key string) interface{} {
+	if e.sensitive(key) {
+		return vault.Redacted
+	}
+	return e.Data[key]
+}
+
+// DigestFields returns the path and the compared keys of the data of the
+// entry, leaving out the sensitive ones, which include resolved references.
+func (e Entry) DigestFields() map[string]interface{} {
+	data := make(map[string]interface{}, len(e.Data))
+	for k, v := range e.Data {
+		if !e.sensitive(k) && e.compared(k) {
+			data[k] = Normalize(v)
+		}
+	}
+	return map[string]interface{}{"path": e.Path, "data": data}
+}
+
+func (e Entry) sensitive(key string) bool {
+	for _, k := range e.Sensitive {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Entry) compared(key string) bool {
+	if e.Compared == nil {
+		return true
+	}
+	for _, k := range e.Compared {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the entry with the values of its sensitive keys redacted.
+func (e Entry) String() string {
+	keys := make([]string, 0, len(e.Data))
+	for k := range e.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := e.Data[k]
+		if e.sensitive(k) {
+			v = redacted
+		}
+		fields = append(fields, fmt.Sprintf("%s:%v", k, comparable(v)))
+	}
+
+	return fmt.Sprintf("{%s map[%s]}", e.Path, strings.Join(fields, " "))
+}
+
+// comparable turns lists and mappings into their JSON encoding, so that values
+// decoded from YAML and from Vault responses format identically.
+//
+// Empty lists and mappings are equal to missing ones, which Vault returns as
+// null.
+func comparable(v interface{}) interface{} {
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Invalid:
+		return ""
+	case reflect.Slice, reflect.Map:
+		if rv.Len() == 0 {
+			return ""
+		}
+		b, err := json.Marshal(Normalize(v))
+		if err != nil {
+			return v
+		}
+		return string(b)
+	default:
+		return v
+	}
+}
+
+// Normalize converts the mappings decoded from YAML into mappings with string
+// keys, which can be encoded as JSON when written to Vault.
+func Normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			m[fmt.Sprintf("%v", k)] = Normalize(x)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			m[k] = Normalize(x)
+		}
+		return m
+	case []interface{}:
+		xs := make([]interface{}, 0, len(v))
+		for _, x := range v {
+			xs = append(xs, Normalize(x))
+		}
+		return xs
+	default:
+		return v
+	}
+}
+
+// EncodeJSON returns a copy of the entry with the values of the provided keys
+// encoded as JSON strings, for settings that Vault expects encoded but that are
+// declared as lists or mappings. Vault returns them decoded, which compares
+// equal to their encoding.
+func EncodeJSON(e Entry, keys ...string) (Entry, error) {
+	data := make(map[string]interface{}, len(e.Data))
+	for k, v := range e.Data {
+		data[k] = v
+	}
+
+	for _, k := range keys {
+		v, ok := data[k]
+		if _, isString := v.(string); !ok || isString {
+			continue
+		}
+		b, err := json.Marshal(Normalize(v))
+		if err != nil {
+			return Entry{}, errors.Wrapf(err, "failed to encode %s of %s as JSON", k, e.Path)
+		}
+		data[k] = string(b)
+	}
+
+	e.Data = data
+	return e, nil
+}
+
+// List returns the keys listed under a path, or nothing if the path doesn't
+// exist.
+func List(client *api.Client, p string) ([]string, error) {
+	secret, err := client.Logical().List(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list entries under %s from Vault instance", p)
+	}
+
+	var keys []string
+	if secret == nil || secret.Data == nil {
+		return keys, nil
+	}
+	list, _ := secret.Data["keys"].([]interface{})
+	for _, k := range list {
+		keys = append(keys, fmt.Sprintf("%v", k))
+	}
+
+	return keys, nil
+}
+
+// Read returns the existing entry stored at a path and whether it exists.
+func Read(client *api.Client, p string) (Entry, bool, error) {
+	secret, err := client.Logical().Read(p)
+	if err != nil {
+		return Entry{}, false, errors.Wrapf(err, "failed to read entry %s from Vault instance", p)
+	}
+	if secret == nil || secret.Data == nil {
+		return Entry{}, false, nil
+	}
+
+	return Entry{Path: p, Data: secret.Data}, true, nil
+}
+
+// ReadAll returns the existing entries stored under a path.
+func ReadAll(client *api.Client, dir string) ([]Entry, error) {
+	keys, err := List(client, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0)
+	for _, k := range keys {
+		if strings.HasSuffix(k, "/") {
+			continue
+		}
+		e, ok, err := Read(client, path.Join(dir, k))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+// Settings returns the entries of the settings of a mount that are written to
+// <mount>/config/<name>, along with the existing ones.
+func Settings(client *api.Client, mount string, settings map[string]map[string]interface{}, sensitive []string) (desired, existing []Entry, err error) {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	desired = make([]Entry, 0, len(names))
+	existing = make([]Entry, 0, len(names))
+	for _, name := range names {
+		p := path.Join(mount, "config", name)
+		desired = append(desired, Entry{Path: p, Data: settings[name], Sensitive: sensitive})
+		e, ok, err := Read(client, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			existing = append(existing, e)
+		}
+	}
+
+	return desired, existing, nil
+}
+
+// referencePattern matches references to values stored outside of the
+// configuration, e.g. "${env:DB_PASSWORD}" or "${file:/secrets/token}".
+var referencePattern = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// ResolveReferences replaces the references contained in the string values of
+// the data, including the ones nested in lists and mappings, with the values
+// they point to, and returns the keys holding them.
+//
+// Resolved values are secrets and are treated as sensitive.
+func ResolveReferences(data map[string]interface{}) (referenced []string, err error) {
+	for k, v := range data {
+		resolved, ok, err := resolveValue(v)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		data[k] = resolved
+		referenced = append(referenced, k)
+	}
+	sort.Strings(referenced)
+
+	return referenced, nil
+}
+
+// resolveValue returns a value with the references it contains resolved, and
+// whether it contained any.
+func resolveValue(v interface{}) (interface{}, bool, error) {
+	switch v := v.(type) {
+	case string:
+		if !referencePattern.MatchString(v) {
+			return v, false, nil
+		}
+
+		var resolveErr error
+		resolved := referencePattern.ReplaceAllStringFunc(v, func(ref string) string {
+			m := referencePattern.FindStringSubmatch(ref)
+			value, err := resolveReference(m[1], m[2])
+			if err != nil && resolveErr == nil {
+				resolveErr = errors.Wrapf(err, "failed to resolve %s", ref)
+			}
+			return value
+		})
+		return resolved, true, resolveErr
+	case map[string]interface{}:
+		referenced, err := ResolveReferences(v)
+		return v, len(referenced) > 0, err
+	case []interface{}:
+		found := false
+		for i, x := range v {
+			resolved, ok, err := resolveValue(x)
+			if err != nil {
+				return nil, false, err
+			}
+			v[i] = resolved
+			found = found || ok
+		}
+		return v, found, nil
+	default:
+		return v, false, nil
+	}
+}
+
+func resolveReference(kind, name string) (string, error) {
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("environment variable %s is unset", name)
+		}
+		return value, nil
+	default:
+		b, err := ioutil.ReadFile(name)
+		return strings.TrimRight(string(b), "\n"), err
+	}
+}
+
+// Apply ensures that the desired entries of a top-level are stored in Vault,
+// and deletes the existing entries that aren't desired.
+//
+// Existing entries must only contain the entries managed by the top-level;
+// anything left out of them is never deleted.
+func Apply(ctx context.Context, name string, desired, existing []Entry, dryRun bool) error {
+	for i := range desired {
+		desired[i].name = name
+		desired[i].Data, _ = Normalize(desired[i].Data).(map[string]interface{})
+
+		referenced, err := ResolveReferences(desired[i].Data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve referenced values of %s", desired[i].Path)
+		}
+		desired[i].Sensitive = append(append([]string{}, desired[i].Sensitive...), referenced...)
+	}
+	for i := range existing {
+		existing[i].name = name
+	}
+
+	toBeWritten, toBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:       name,
+		Package:    name,
+		Desired:    asItems(desired),
+		Existing:   asItems(existing),
+		Operations: operations,
+	}, dryRun)
+	if err != nil {
+		return err
+	}
+
+	deleteEntry := func(e vault.Item) error {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		return e.(Entry).delete(client)
+	}
+
+	// Deleting an entry after writing another one to its path would undo the
+	// write.
+	replaced, toBeDeleted := replacedEntries(toBeDeleted, toBeWritten)
+	if err := vault.ForEach(replaced, deleteEntry); err != nil {
+		return err
+	}
+
+	if err := vault.ForEach(toBeWritten, func(e vault.Item) error {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		return e.(Entry).write(client)
+	}); err != nil {
+		return err
+	}
+
+	return vault.ForEach(toBeDeleted, deleteEntry)
+}
+
+// replacedEntries splits the entries to be deleted between the ones whose path
+// is also written to and the others.
+func replacedEntries(toBeDeleted, toBeWritten []vault.Item) (replaced, others []vault.Item) {
+	written := make(map[string]bool, len(toBeWritten))
+	for _, w := range toBeWritten {
+		written[strings.Trim(w.(Entry).Path, "/")] = true
+	}
+
+	replaced = make([]vault.Item, 0)
+	others = make([]vault.Item, 0, len(toBeDeleted))
+	for _, d := range toBeDeleted {
+		if written[strings.Trim(d.(Entry).Path, "/")] {
+			replaced = append(replaced, d)
+		} else {
+			others = append(others, d)
+		}
+	}
+	return replaced, others
+}
+
+func (e Entry) write(client *api.Client) error {
+	event := toplevel.Event{Name: e.name, Key: e.Path, Operation: "write"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(e.Path, e.Data); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to write entry %s to Vault instance", e.Path)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", e.Path).Info("successfully wrote entry to Vault instance")
+	return nil
+}
+
+func (e Entry) delete(client *api.Client) error {
+	event := toplevel.Event{Name: e.name, Key: e.Path, Operation: "delete"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Delete(e.Path); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to delete entry %s from Vault instance", e.Path)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", e.Path).Info("successfully deleted entry from Vault instance")
+	return nil
+}
+
+// operations lists the requests made to Vault to write, or delete, an entry.
+func operations(e vault.Item, delete bool) []vault.Operation {
+	ent := e.(Entry)
+	if delete {
+		return []vault.Operation{vault.DeleteOperation(ent.Path, ent.Sudo)}
+	}
+	return []vault.Operation{vault.WriteOperation(ent.Path, ent.Sudo)}
+}
+
+func asItems(xs []Entry) (items []vault.Item) {
+	items = make([]vault.Item, 0)
+	for _, x := range xs {
+		items = append(items, x)
+	}
+
+	return
+}
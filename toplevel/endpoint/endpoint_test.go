@@ -0,0 +1,189 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryDifferences(t *testing.T) {
+	table := []struct {
+		description string
+		desired     Entry
+		existing    Entry
+		differences []string
+	}{
+		{
+			description: "undeclared keys returned by Vault are ignored",
+			desired:     Entry{Path: "auth/kubernetes/config", Data: map[string]interface{}{"kubernetes_host": "https://k8s"}},
+			existing:    Entry{Path: "auth/kubernetes/config", Data: map[string]interface{}{"kubernetes_host": "https://k8s", "issuer": ""}},
+			differences: []string{},
+		},
+		{
+			description: "declared keys missing from Vault differ",
+			desired:     Entry{Path: "auth/kubernetes/config", Data: map[string]interface{}{"issuer": "kubernetes/serviceaccount"}},
+			existing:    Entry{Path: "auth/kubernetes/config", Data: map[string]interface{}{}},
+			differences: []string{"issuer"},
+		},
+		{
+			description: "sensitive keys are never compared",
+			desired:     Entry{Path: "auth/kubernetes/config", Data: map[string]interface{}{"token_reviewer_jwt": "jwt"}, Sensitive: []string{"token_reviewer_jwt"}},
+			existing:    Entry{Path: "auth/kubernetes/config", Data: map[string]interface{}{}},
+			differences: []string{},
+		},
+		{
+			description: "lists decoded from YAML equal lists returned by Vault",
+			desired:     Entry{Path: "auth/kubernetes/role/app", Data: map[string]interface{}{"bound_service_account_names": []interface{}{"app"}}},
+			existing:    Entry{Path: "auth/kubernetes/role/app", Data: map[string]interface{}{"bound_service_account_names": []interface{}{"app"}}},
+			differences: []string{},
+		},
+		{
+			description: "mappings decoded from YAML equal mappings returned by Vault",
+			desired:     Entry{Path: "auth/jwt/role/app", Data: map[string]interface{}{"bound_claims": map[interface{}]interface{}{"b": "2", "a": "1"}}},
+			existing:    Entry{Path: "auth/jwt/role/app", Data: map[string]interface{}{"bound_claims": map[string]interface{}{"a": "1", "b": "2"}}},
+			differences: []string{},
+		},
+		{
+			description: "durations are compared with the ones returned in seconds",
+			desired:     Entry{Path: "auth/kubernetes/role/app", Data: map[string]interface{}{"token_ttl": "1h"}},
+			existing:    Entry{Path: "auth/kubernetes/role/app", Data: map[string]interface{}{"token_ttl": json.Number("3600")}},
+			differences: []string{},
+		},
+		{
+			description: "typed lists equal lists returned by Vault",
+			desired:     Entry{Path: "auth/ldap/groups/admins", Data: map[string]interface{}{"policies": []string{"admin"}}},
+			existing:    Entry{Path: "auth/ldap/groups/admins", Data: map[string]interface{}{"policies": []interface{}{"admin"}}},
+			differences: []string{},
+		},
+		{
+			description: "empty lists equal null values returned by Vault",
+			desired:     Entry{Path: "identity/entity/name/app", Data: map[string]interface{}{"policies": []string{}}},
+			existing:    Entry{Path: "identity/entity/name/app", Data: map[string]interface{}{"policies": nil}},
+			differences: []string{},
+		},
+		{
+			description: "only compared keys are compared when listed",
+			desired:     Entry{Path: "sys/config/group/app", Data: map[string]interface{}{"a": "1", "b": "2"}, Compared: []string{"a"}},
+			existing:    Entry{Path: "sys/config/group/app", Data: map[string]interface{}{"a": "1", "b": "3"}},
+			differences: []string{},
+		},
+		{
+			description: "changed values differ",
+			desired:     Entry{Path: "auth/kubernetes/role/app", Data: map[string]interface{}{"token_policies": []interface{}{"a", "b"}}},
+			existing:    Entry{Path: "auth/kubernetes/role/app", Data: map[string]interface{}{"token_policies": []interface{}{"a"}}},
+			differences: []string{"token_policies"},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			require.Equal(t, tt.differences, tt.desired.Differences(tt.existing))
+			require.Equal(t, len(tt.differences) == 0, tt.desired.Equals(tt.existing))
+		})
+	}
+}
+
+func TestReplacedEntriesAreDeletedFirst(t *testing.T) {
+	replacedQuota := Entry{Path: "sys/quotas/rate-limit/login", ID: "sys/quotas/rate-limit/login@auth/approle/login"}
+	otherQuota := Entry{Path: "sys/quotas/rate-limit/other"}
+	newQuota := Entry{Path: "sys/quotas/rate-limit/login/", ID: "sys/quotas/rate-limit/login@auth/userpass/login"}
+
+	require.False(t, newQuota.Equals(replacedQuota))
+	replaced, others := replacedEntries(asItems([]Entry{replacedQuota, otherQuota}), asItems([]Entry{newQuota}))
+	require.Equal(t, asItems([]Entry{replacedQuota}), replaced)
+	require.Equal(t, asItems([]Entry{otherQuota}), others)
+}
+
+func TestEntryStringRedactsSensitiveKeys(t *testing.T) {
+	e := Entry{
+		Path:      "auth/kubernetes/config",
+		Data:      map[string]interface{}{"kubernetes_host": "https://k8s", "token_reviewer_jwt": "jwt"},
+		Sensitive: []string{"token_reviewer_jwt"},
+	}
+
+	require.Equal(t, "{auth/kubernetes/config map[kubernetes_host:https://k8s token_reviewer_jwt:<redacted>]}", e.String())
+}
+
+func TestEntryDigestFieldsLeaveOutSensitiveKeys(t *testing.T) {
+	e := Entry{
+		Path:      "auth/ldap/config",
+		Data:      map[string]interface{}{"url": "ldaps://ldap", "bindpass": "secret", "token": "${env:TOKEN}"},
+		Sensitive: []string{"bindpass", "token"},
+	}
+	require.Equal(t, map[string]interface{}{
+		"path": "auth/ldap/config",
+		"data": map[string]interface{}{"url": "ldaps://ldap"},
+	}, e.DigestFields())
+}
+
+func TestResolveReferences(t *testing.T) {
+	os.Setenv("ENDPOINT_TEST_PASSWORD", "hunter2")
+	defer os.Unsetenv("ENDPOINT_TEST_PASSWORD")
+
+	f, err := ioutil.TempFile("", "endpoint-test")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("token\n")
+	require.Nil(t, err)
+	f.Close()
+
+	data := map[string]interface{}{
+		"username":       "vault",
+		"password":       "${env:ENDPOINT_TEST_PASSWORD}",
+		"connection_url": "postgres://{{username}}:{{password}}@db:5432",
+		"token":          "Bearer ${file:" + f.Name() + "}",
+	}
+
+	referenced, err := ResolveReferences(data)
+	require.Nil(t, err)
+	require.Equal(t, []string{"password", "token"}, referenced)
+	require.Equal(t, "hunter2", data["password"])
+	require.Equal(t, "Bearer token", data["token"])
+	require.Equal(t, "postgres://{{username}}:{{password}}@db:5432", data["connection_url"])
+}
+
+func TestResolveReferencesInNestedValues(t *testing.T) {
+	os.Setenv("ENDPOINT_TEST_SECRET_KEY", "hunter2")
+	defer os.Unsetenv("ENDPOINT_TEST_SECRET_KEY")
+
+	data := map[string]interface{}{
+		"credentials": map[string]interface{}{"access_key": "AKIA", "secret_key": "${env:ENDPOINT_TEST_SECRET_KEY}"},
+		"headers":     []interface{}{"X-Token: ${env:ENDPOINT_TEST_SECRET_KEY}"},
+		"regions":     []interface{}{"us-east-1"},
+	}
+
+	referenced, err := ResolveReferences(data)
+	require.Nil(t, err)
+	require.Equal(t, []string{"credentials", "headers"}, referenced)
+	require.Equal(t, "hunter2", data["credentials"].(map[string]interface{})["secret_key"])
+	require.Equal(t, []interface{}{"X-Token: hunter2"}, data["headers"])
+}
+
+func TestResolveReferencesFailsOnUnsetVariables(t *testing.T) {
+	_, err := ResolveReferences(map[string]interface{}{"password": "${env:ENDPOINT_TEST_UNSET}"})
+	require.NotNil(t, err)
+}
+
+func TestEncodeJSONEqualsDecodedValuesReturnedByVault(t *testing.T) {
+	configured, err := EncodeJSON(Entry{
+		Path: "rabbitmq/roles/app",
+		Data: map[string]interface{}{
+			"tags":   "management",
+			"vhosts": map[interface{}]interface{}{"/": map[interface{}]interface{}{"configure": ".*", "write": ".*", "read": ".*"}},
+		},
+	}, "vhosts", "vhost_topics")
+	require.NoError(t, err)
+	require.Equal(t, `{"/":{"configure":".*","read":".*","write":".*"}}`, configured.Data["vhosts"])
+
+	listed := Entry{
+		Path: "rabbitmq/roles/app",
+		Data: map[string]interface{}{
+			"tags":   "management",
+			"vhosts": map[string]interface{}{"/": map[string]interface{}{"read": ".*", "write": ".*", "configure": ".*"}},
+		},
+	}
+	require.Empty(t, configured.Differences(listed))
+}
@@ -0,0 +1,116 @@
+package toplevel
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+)
+
+// EventType identifies the kind of progress being reported by an Event.
+type EventType string
+
+const (
+	// ItemStarted is emitted before an item is written to or deleted from Vault.
+	ItemStarted EventType = "item_started"
+	// ItemSucceeded is emitted once an item has been written or deleted.
+	ItemSucceeded EventType = "item_succeeded"
+	// ItemFailed is emitted when writing or deleting an item failed.
+	ItemFailed EventType = "item_failed"
+	// BlockComplete is emitted once a top-level configuration has been applied.
+	BlockComplete EventType = "block_complete"
+)
+
+// Event describes progress made while applying a top-level configuration.
+type Event struct {
+	Type      EventType
+	Name      string
+	Key       string
+	Operation string
+	Err       error
+	// PlanID identifies the applied plan, if any.
+	PlanID string
+}
+
+// WithType returns a copy of the event with the provided type.
+func (e Event) WithType(t EventType) Event {
+	e.Type = t
+	return e
+}
+
+// WithError returns a copy of the event reporting the provided failure.
+func (e Event) WithError(err error) Event {
+	e.Type = ItemFailed
+	e.Err = err
+	return e
+}
+
+// EventSink receives progress events as they happen.
+type EventSink interface {
+	Emit(Event)
+}
+
+// EventFunc adapts a function into an EventSink.
+type EventFunc func(Event)
+
+// Emit calls f(e).
+func (f EventFunc) Emit(e Event) {
+	f(e)
+}
+
+// eventQueueSize is the number of events buffered for a slow EventSink before
+// new events start being dropped.
+const eventQueueSize = 1024
+
+var (
+	events  chan Event
+	eventsM sync.RWMutex
+)
+
+// SetEventSink registers an EventSink receiving the progress of every
+// configuration being applied.
+//
+// Events are delivered asynchronously from a bounded queue and are dropped
+// when the sink can't keep up, so a slow sink never blocks the reconcile.
+// Without a registered sink, events are logged at the debug level.
+func SetEventSink(s EventSink) {
+	eventsM.Lock()
+	defer eventsM.Unlock()
+
+	if events != nil {
+		close(events)
+	}
+
+	queue := make(chan Event, eventQueueSize)
+	go func() {
+		for e := range queue {
+			s.Emit(e)
+		}
+	}()
+	events = queue
+}
+
+// Emit reports progress to the registered EventSink, along with the ID of the
+// applied plan.
+func Emit(e Event) {
+	e.PlanID = vault.AppliedPlanID()
+
+	eventsM.RLock()
+	defer eventsM.RUnlock()
+
+	if events == nil {
+		logrus.WithFields(logrus.Fields{
+			"event":     e.Type,
+			"name":      e.Name,
+			"key":       e.Key,
+			"operation": e.Operation,
+		}).Debug("progress")
+		return
+	}
+
+	select {
+	case events <- e:
+	default:
+	}
+}
@@ -0,0 +1,35 @@
+package toplevel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmitNeverBlocks(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	received := make(chan Event, 1)
+	SetEventSink(EventFunc(func(e Event) {
+		received <- e
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < eventQueueSize*2; i++ {
+			Emit(Event{Type: ItemStarted, Name: "vault_policies", Key: "x"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Emit blocked on a slow sink")
+	}
+
+	require.Equal(t, Event{Type: ItemStarted, Name: "vault_policies", Key: "x"}, <-received)
+}
@@ -0,0 +1,174 @@
+// Package gcp implements the application of a declarative configuration
+// for Vault Google Cloud secrets engines.
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConfig lists the settings of the secrets engine that Vault never
+// returns.
+var sensitiveConfig = []string{"credentials"}
+
+// bindingsKey is the setting of rolesets and static accounts holding their
+// IAM bindings.
+const bindingsKey = "bindings"
+
+type entry struct {
+	Path           string                 `yaml:"_path" validate:"required"`
+	Config         map[string]interface{} `yaml:"config"`
+	Rolesets       []account              `yaml:"rolesets"`
+	StaticAccounts []account              `yaml:"static_accounts"`
+}
+
+// account is a roleset or a static account, whose IAM bindings are declared
+// separately from its other settings.
+type account struct {
+	Name     string                 `yaml:"name" validate:"required"`
+	Bindings []binding              `yaml:"bindings"`
+	Options  map[string]interface{} `yaml:"options"`
+}
+
+// binding grants IAM roles on a GCP resource.
+type binding struct {
+	Resource string   `yaml:"resource"`
+	Roles    []string `yaml:"roles"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_gcp", config{})
+}
+
+// Validate checks the gcp configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config, rolesets and static accounts of GCP secrets
+// engines are configured exactly as provided.
+//
+// Rolesets and static accounts of a declared secrets engine that are missing
+// from the configuration are deleted; secrets engines that aren't declared are
+// left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode gcp configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		if e.Config != nil {
+			configPath := path.Join(e.Path, "config")
+			desired = append(desired, endpoint.Entry{Path: configPath, Data: e.Config, Sensitive: sensitiveConfig})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingConfig, ok, err := endpoint.Read(client, configPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingConfig)
+			}
+		}
+
+		for _, kind := range []struct {
+			dir      string
+			accounts []account
+		}{{"roleset", e.Rolesets}, {"static-account", e.StaticAccounts}} {
+			for _, a := range kind.accounts {
+				desired = append(desired, a.entry(path.Join(e.Path, kind.dir, a.Name)))
+			}
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingAccounts, err := endpoint.ReadAll(client, path.Join(e.Path, kind.dir))
+			if err != nil {
+				return err
+			}
+			for _, a := range existingAccounts {
+				existing = append(existing, withEncodedBindings(a))
+			}
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_gcp", desired, existing, dryRun)
+}
+
+func (a account) entry(p string) endpoint.Entry {
+	data := make(map[string]interface{}, len(a.Options)+1)
+	for k, v := range a.Options {
+		data[k] = v
+	}
+
+	bindings := make(map[string][]string, len(a.Bindings))
+	for _, b := range a.Bindings {
+		bindings[b.Resource] = append(bindings[b.Resource], b.Roles...)
+	}
+	data[bindingsKey] = encodeBindings(bindings)
+
+	return endpoint.Entry{Path: p, Data: data}
+}
+
+// withEncodedBindings encodes the bindings returned by Vault, as a mapping of
+// resources to roles, the same way as the configured ones.
+func withEncodedBindings(e endpoint.Entry) endpoint.Entry {
+	returned, ok := e.Data[bindingsKey].(map[string]interface{})
+	if !ok {
+		return e
+	}
+
+	bindings := make(map[string][]string, len(returned))
+	for resource, roles := range returned {
+		roles, _ := roles.([]interface{})
+		for _, r := range roles {
+			bindings[resource] = append(bindings[resource], fmt.Sprintf("%v", r))
+		}
+	}
+	e.Data[bindingsKey] = encodeBindings(bindings)
+	return e
+}
+
+// encodeBindings encodes bindings in the HCL format expected by Vault, with
+// resources and roles sorted so that equal bindings are encoded identically.
+func encodeBindings(bindings map[string][]string) string {
+	resources := make([]string, 0, len(bindings))
+	for resource := range bindings {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	var b strings.Builder
+	for _, resource := range resources {
+		roles := append([]string{}, bindings[resource]...)
+		sort.Strings(roles)
+		quoted := make([]string, 0, len(roles))
+		for _, r := range roles {
+			quoted = append(quoted, strconv.Quote(r))
+		}
+		fmt.Fprintf(&b, "resource %s {\n  roles = [%s]\n}\n", strconv.Quote(resource), strings.Join(quoted, ", "))
+	}
+	return b.String()
+}
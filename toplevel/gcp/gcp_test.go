@@ -0,0 +1,42 @@
+package gcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+func TestBindingsAreEncodedAsHCL(t *testing.T) {
+	a := account{
+		Name: "viewer",
+		Bindings: []binding{
+			{Resource: "//cloudresourcemanager.googleapis.com/projects/b", Roles: []string{"roles/viewer"}},
+			{Resource: "//cloudresourcemanager.googleapis.com/projects/a", Roles: []string{"roles/viewer", "roles/browser"}},
+		},
+		Options: map[string]interface{}{"project": "a", "secret_type": "access_token"},
+	}
+
+	e := a.entry("gcp/roleset/viewer")
+	require.Equal(t, `resource "//cloudresourcemanager.googleapis.com/projects/a" {
+  roles = ["roles/browser", "roles/viewer"]
+}
+resource "//cloudresourcemanager.googleapis.com/projects/b" {
+  roles = ["roles/viewer"]
+}
+`, e.Data["bindings"])
+
+	listed := withEncodedBindings(endpoint.Entry{
+		Path: "gcp/roleset/viewer",
+		Data: map[string]interface{}{
+			"project":     "a",
+			"secret_type": "access_token",
+			"bindings": map[string]interface{}{
+				"//cloudresourcemanager.googleapis.com/projects/b": []interface{}{"roles/viewer"},
+				"//cloudresourcemanager.googleapis.com/projects/a": []interface{}{"roles/viewer", "roles/browser"},
+			},
+		},
+	})
+	require.Empty(t, e.Differences(listed))
+}
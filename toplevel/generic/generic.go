@@ -0,0 +1,82 @@
+// Package generic implements the application of a declarative configuration
+// for arbitrary Vault API paths that no other top-level manages.
+package generic
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+type entry struct {
+	Path    string                 `yaml:"path" validate:"required"`
+	Payload map[string]interface{} `yaml:"payload"`
+	// Compare lists the keys of the payload compared with the data read from
+	// the path; every key is compared if it's empty.
+	Compare []string `yaml:"compare"`
+	// Sensitive lists the keys of the payload that are written but neither
+	// compared nor logged.
+	Sensitive []string `yaml:"sensitive"`
+	Sudo      bool     `yaml:"sudo"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_generic", config{})
+}
+
+// Validate checks the generic configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that payloads are written to the declared paths whenever the
+// data read from them differs.
+//
+// The paths aren't known to belong to a collection that can be listed, so
+// entries missing from the configuration are never deleted.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode generic configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0, len(entries))
+	existing := make([]endpoint.Entry, 0, len(entries))
+	for _, e := range entries {
+		var compared []string
+		if len(e.Compare) > 0 {
+			compared = e.Compare
+		}
+		desired = append(desired, endpoint.Entry{
+			Path:      e.Path,
+			Data:      e.Payload,
+			Sensitive: e.Sensitive,
+			Compared:  compared,
+			Sudo:      e.Sudo,
+		})
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingEntry, ok, err := endpoint.Read(client, e.Path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			existing = append(existing, existingEntry)
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_generic", desired, existing, dryRun)
+}
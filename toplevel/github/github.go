@@ -0,0 +1,112 @@
+// Package github implements the application of a declarative configuration
+// for Vault GitHub auth methods and their team and user policy mappings.
+package github
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+type entry struct {
+	Path   string                 `yaml:"_path" validate:"required"`
+	Config map[string]interface{} `yaml:"config"`
+	Teams  []mapping              `yaml:"teams"`
+	Users  []mapping              `yaml:"users"`
+}
+
+// mapping assigns policies to a GitHub team or user.
+type mapping struct {
+	Name     string   `yaml:"name" validate:"required"`
+	Policies []string `yaml:"policies"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_github_auth", config{})
+}
+
+// Validate checks the github auth configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config and policy mappings of GitHub auth methods are
+// configured exactly as provided.
+//
+// Team and user mappings of a declared auth method that are missing from the
+// configuration are deleted; auth methods that aren't declared are left
+// untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode github auth configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		mount := path.Join("auth", e.Path)
+
+		if e.Config != nil {
+			configPath := path.Join(mount, "config")
+			desired = append(desired, endpoint.Entry{Path: configPath, Data: e.Config})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingConfig, ok, err := endpoint.Read(client, configPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingConfig)
+			}
+		}
+
+		desired = append(desired, mappingEntries(path.Join(mount, "map/teams"), e.Teams)...)
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingTeams, err := endpoint.ReadAll(client, path.Join(mount, "map/teams"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingTeams...)
+
+		desired = append(desired, mappingEntries(path.Join(mount, "map/users"), e.Users)...)
+		existingUsers, err := endpoint.ReadAll(client, path.Join(mount, "map/users"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingUsers...)
+	}
+
+	return endpoint.Apply(ctx, "vault_github_auth", desired, existing, dryRun)
+}
+
+// mappingEntries returns the entries written under dir for the mappings, which
+// Vault stores as a comma-separated list of policies.
+func mappingEntries(dir string, mappings []mapping) []endpoint.Entry {
+	entries := make([]endpoint.Entry, 0, len(mappings))
+	for _, m := range mappings {
+		entries = append(entries, endpoint.Entry{
+			Path: path.Join(dir, m.Name),
+			Data: map[string]interface{}{"value": strings.Join(m.Policies, ",")},
+		})
+	}
+	return entries
+}
@@ -0,0 +1,402 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+)
+
+// aliasKind describes the aliases of one kind of identity object.
+type aliasKind struct {
+	// name is the name of the top-level managing the aliases.
+	name string
+	// dir is where the aliases are managed, e.g. "identity/entity-alias".
+	dir string
+	// canonicalDir is where the objects the aliases belong to are managed.
+	canonicalDir string
+}
+
+// alias links an identity object to a name known by an auth method, such as
+// the subject of an OIDC token.
+//
+// Aliases are declared with the path of the auth method and the name of the
+// object they belong to, which are resolved into the mount accessor and
+// canonical ID that Vault stores.
+type alias struct {
+	Name      string `yaml:"name" validate:"required"`
+	Mount     string `yaml:"mount" validate:"required"`
+	Canonical string `yaml:"canonical"`
+
+	kind          aliasKind
+	mountAccessor string
+	canonicalID   string
+	// id is assigned by Vault and only known for existing aliases.
+	id string
+}
+
+func (a alias) Key() string {
+	return path.Join(strings.Trim(a.Mount, "/"), a.Name)
+}
+
+func (a alias) Equals(i interface{}) bool {
+	alias, ok := i.(alias)
+	if !ok {
+		return false
+	}
+
+	return a.Key() == alias.Key() &&
+		a.mountAccessor == alias.mountAccessor &&
+		a.canonicalID == alias.canonicalID
+}
+
+func (a alias) String() string {
+	return fmt.Sprintf("{%s %s %s}", a.Name, a.Mount, a.Canonical)
+}
+
+func (a alias) data() map[string]interface{} {
+	return map[string]interface{}{
+		"name":           a.Name,
+		"mount_accessor": a.mountAccessor,
+		"canonical_id":   a.canonicalID,
+	}
+}
+
+func (a alias) write(client *api.Client, existing []alias) error {
+	p := a.kind.dir
+	if e, ok := findAlias(existing, a.Key()); ok {
+		p = path.Join(a.kind.dir, "id", e.id)
+	}
+
+	event := toplevel.Event{Name: a.kind.name, Key: a.Key(), Operation: "write"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(p, a.data()); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to write alias %s to Vault instance", a.Key())
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("alias", a.Key()).Info("successfully wrote alias to Vault instance")
+	return nil
+}
+
+func (a alias) delete(client *api.Client) error {
+	event := toplevel.Event{Name: a.kind.name, Key: a.Key(), Operation: "delete"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Delete(path.Join(a.kind.dir, "id", a.id)); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to delete alias %s from Vault instance", a.Key())
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("alias", a.Key()).Info("successfully deleted alias from Vault instance")
+	return nil
+}
+
+type aliasesConfig struct {
+	kind aliasKind
+}
+
+var _ toplevel.Configuration = aliasesConfig{}
+var _ toplevel.Validator = aliasesConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_identity_entity_aliases", aliasesConfig{aliasKind{
+		name:         "vault_identity_entity_aliases",
+		dir:          "identity/entity-alias",
+		canonicalDir: entityPath,
+	}})
+	toplevel.RegisterConfiguration("vault_identity_group_aliases", aliasesConfig{aliasKind{
+		name:         "vault_identity_group_aliases",
+		dir:          "identity/group-alias",
+		canonicalDir: groupPath,
+	}})
+}
+
+// Validate checks the identity aliases configuration without contacting Vault,
+// including that aliases don't collide unless a strategy resolves them.
+func (c aliasesConfig) Validate(entriesBytes []byte) error {
+	var aliases []alias
+	if err := toplevel.ValidateEntries(entriesBytes, &aliases); err != nil {
+		return err
+	}
+	strategy, err := conflictStrategy()
+	if err != nil {
+		return err
+	}
+	_, err = withoutConflicts(aliases, strategy)
+	return err
+}
+
+// Apply ensures that the aliases of the identity objects written by
+// vault-manager are configured exactly as provided.
+func (c aliasesConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var aliases []alias
+	if err := yaml.Unmarshal(entriesBytes, &aliases); err != nil {
+		return errors.Wrap(err, "failed to decode identity aliases configuration")
+	}
+	strategy, err := conflictStrategy()
+	if err != nil {
+		return err
+	}
+	aliases, err = withoutConflicts(aliases, strategy)
+	if err != nil {
+		return err
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	accessors, err := vault.AuthAccessors(client)
+	if err != nil {
+		return err
+	}
+	canonicalIDs, canonicalNames, err := managedIDs(client, c.kind.canonicalDir)
+	if err != nil {
+		return err
+	}
+
+	for i, a := range aliases {
+		mountAccessor, ok := accessors[strings.Trim(a.Mount, "/")]
+		if !ok {
+			return errors.Errorf("failed to find auth method %s of alias %s", a.Mount, a.Name)
+		}
+		aliases[i].kind = c.kind
+		aliases[i].mountAccessor = mountAccessor
+		// objects that don't exist yet are only known in dry-run mode
+		aliases[i].canonicalID = canonicalIDs[a.Canonical]
+	}
+
+	listedAliases, err := listAliases(client, c.kind)
+	if err != nil {
+		return err
+	}
+
+	existingAliases := make([]alias, 0)
+	for _, a := range listedAliases {
+		// only the aliases of objects written by vault-manager are managed
+		if _, ok := canonicalNames[a.canonicalID]; !ok {
+			continue
+		}
+		a.Canonical = canonicalNames[a.canonicalID]
+		existingAliases = append(existingAliases, a)
+	}
+	existingAliases = withMounts(existingAliases, aliases, accessors)
+
+	toBeWritten, toBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:     c.kind.name,
+		Package:  "identity",
+		Desired:  asAliasItems(aliases),
+		Existing: asAliasItems(existingAliases),
+		Operations: func(a vault.Item, delete bool) []vault.Operation {
+			return aliasOperations(c.kind, a, delete, existingAliases)
+		},
+	}, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range toBeWritten {
+		if a.(alias).canonicalID == "" {
+			return errors.Errorf("failed to find identity object %s of alias", a.(alias).Canonical)
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := a.(alias).write(client, existingAliases); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range toBeDeleted {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := a.(alias).delete(client); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Strategies resolving aliases declared for several identity objects, set
+// through ALIAS_CONFLICTS.
+const (
+	// conflictsFail reports the conflicting aliases as errors.
+	conflictsFail = "fail"
+	// conflictsFirstWins keeps the first alias declared, with a warning.
+	conflictsFirstWins = "first-wins"
+	// conflictsLastWins keeps the last alias declared, with a warning.
+	conflictsLastWins = "last-wins"
+)
+
+// conflictStrategy returns the strategy resolving conflicting aliases, which
+// fails unless set.
+func conflictStrategy() (string, error) {
+	switch s := os.Getenv("ALIAS_CONFLICTS"); s {
+	case "":
+		return conflictsFail, nil
+	case conflictsFail, conflictsFirstWins, conflictsLastWins:
+		return s, nil
+	default:
+		return "", errors.Errorf("unknown alias conflict strategy %s, expected %s, %s or %s", s, conflictsFail, conflictsFirstWins, conflictsLastWins)
+	}
+}
+
+// withoutConflicts resolves the aliases declared with the same auth method and
+// name for different identity objects, which Vault forbids, so that they are
+// detected before any change is made. Aliases declared twice for the same
+// object are kept once.
+func withoutConflicts(aliases []alias, strategy string) ([]alias, error) {
+	kept := make([]alias, 0, len(aliases))
+	index := make(map[string]int, len(aliases))
+	conflicts := make([]string, 0)
+	for _, a := range aliases {
+		i, ok := index[a.Key()]
+		if !ok {
+			index[a.Key()] = len(kept)
+			kept = append(kept, a)
+			continue
+		}
+		if kept[i].Canonical == a.Canonical {
+			continue
+		}
+
+		conflict := fmt.Sprintf("alias %s is declared for both %s and %s", a.Key(), kept[i].Canonical, a.Canonical)
+		switch strategy {
+		case conflictsFirstWins:
+			logrus.WithField("alias", a.Key()).WithField("kept", kept[i].Canonical).Warn(conflict)
+		case conflictsLastWins:
+			logrus.WithField("alias", a.Key()).WithField("kept", a.Canonical).Warn(conflict)
+			kept[i] = a
+		default:
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, errors.New(strings.Join(conflicts, "; "))
+	}
+	return kept, nil
+}
+
+// withMounts sets the mounts of the existing aliases from their accessors. An
+// alias bound to an accessor that is no longer enabled, e.g. as the auth method
+// was enabled again or the configuration comes from another environment, takes
+// the mount of the desired alias with the same name and object, so that it is
+// repointed to the current accessor rather than recreated.
+func withMounts(existing, desired []alias, accessors map[string]string) []alias {
+	mounts := make(map[string]string, len(accessors))
+	for p, a := range accessors {
+		mounts[a] = p
+	}
+
+	keys := make(map[string]bool, len(existing))
+	for i, e := range existing {
+		if m, ok := mounts[e.mountAccessor]; ok {
+			existing[i].Mount = m
+			keys[existing[i].Key()] = true
+		}
+	}
+	for i, e := range existing {
+		if _, ok := mounts[e.mountAccessor]; ok {
+			continue
+		}
+		for _, d := range desired {
+			if d.Name == e.Name && d.Canonical == e.Canonical && !keys[d.Key()] {
+				existing[i].Mount = d.Mount
+				keys[d.Key()] = true
+				break
+			}
+		}
+	}
+	return existing
+}
+
+// managedIDs returns the IDs of the objects under dir written by vault-manager
+// by name, and their names by ID.
+func managedIDs(client *api.Client, dir string) (ids, names map[string]string, err error) {
+	objects, err := readManaged(client, namePath(dir, ""))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids = make(map[string]string)
+	names = make(map[string]string)
+	for _, e := range objects {
+		id, _ := e.Data["id"].(string)
+		name, _ := e.Data["name"].(string)
+		ids[name] = id
+		names[id] = name
+	}
+	return
+}
+
+// listAliases returns the existing aliases of a kind.
+func listAliases(client *api.Client, kind aliasKind) ([]alias, error) {
+	secret, err := client.Logical().List(path.Join(kind.dir, "id"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list aliases under %s from Vault instance", kind.dir)
+	}
+
+	aliases := make([]alias, 0)
+	if secret == nil || secret.Data == nil {
+		return aliases, nil
+	}
+	keyInfo, _ := secret.Data["key_info"].(map[string]interface{})
+	for id, info := range keyInfo {
+		info, _ := info.(map[string]interface{})
+		name, _ := info["name"].(string)
+		mountAccessor, _ := info["mount_accessor"].(string)
+		canonicalID, _ := info["canonical_id"].(string)
+		aliases = append(aliases, alias{
+			Name:          name,
+			kind:          kind,
+			mountAccessor: mountAccessor,
+			canonicalID:   canonicalID,
+			id:            id,
+		})
+	}
+	return aliases, nil
+}
+
+func findAlias(aliases []alias, key string) (alias, bool) {
+	for _, a := range aliases {
+		if a.Key() == key {
+			return a, true
+		}
+	}
+	return alias{}, false
+}
+
+// aliasOperations lists the requests made to Vault to write, or delete, an alias.
+func aliasOperations(kind aliasKind, a vault.Item, delete bool, existing []alias) []vault.Operation {
+	if delete {
+		return []vault.Operation{vault.DeleteOperation(path.Join(kind.dir, "id", a.(alias).id), false)}
+	}
+	p := kind.dir
+	if e, ok := findAlias(existing, a.Key()); ok {
+		p = path.Join(kind.dir, "id", e.id)
+	}
+	return []vault.Operation{vault.WriteOperation(p, false)}
+}
+
+func asAliasItems(xs []alias) (items []vault.Item) {
+	items = make([]vault.Item, 0)
+	for _, x := range xs {
+		items = append(items, x)
+	}
+
+	return
+}
@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// entityPath is where identity entities are managed.
+const entityPath = "identity/entity"
+
+type entity struct {
+	Name     string            `yaml:"name" validate:"required"`
+	Policies []string          `yaml:"policies"`
+	Metadata map[string]string `yaml:"metadata"`
+	Disabled bool              `yaml:"disabled"`
+}
+
+type entitiesConfig struct{}
+
+var _ toplevel.Configuration = entitiesConfig{}
+var _ toplevel.Validator = entitiesConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_identity_entities", entitiesConfig{})
+}
+
+// Validate checks the identity entities configuration without contacting Vault.
+func (c entitiesConfig) Validate(entriesBytes []byte) error {
+	var entities []entity
+	return toplevel.ValidateEntries(entriesBytes, &entities)
+}
+
+// Apply ensures that the identity entities written by vault-manager are
+// configured exactly as provided.
+func (c entitiesConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entities []entity
+	if err := yaml.Unmarshal(entriesBytes, &entities); err != nil {
+		return errors.Wrap(err, "failed to decode identity entities configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0, len(entities))
+	for _, e := range entities {
+		desired = append(desired, endpoint.Entry{
+			Path: namePath(entityPath, e.Name),
+			Data: map[string]interface{}{
+				"policies": append([]string{}, e.Policies...),
+				"metadata": tagged(e.Metadata),
+				"disabled": e.Disabled,
+			},
+		})
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := readManaged(client, namePath(entityPath, ""))
+	if err != nil {
+		return err
+	}
+
+	return endpoint.Apply(ctx, "vault_identity_entities", desired, existing, dryRun)
+}
@@ -0,0 +1,134 @@
+package identity
+
+import (
+	"context"
+	"sort"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// groupPath is where identity groups are managed.
+const groupPath = "identity/group"
+
+type group struct {
+	Name     string            `yaml:"name" validate:"required"`
+	Type     string            `yaml:"type"`
+	Policies []string          `yaml:"policies"`
+	Members  []string          `yaml:"member_entities"`
+	Metadata map[string]string `yaml:"metadata"`
+}
+
+type groupsConfig struct{}
+
+var _ toplevel.Configuration = groupsConfig{}
+var _ toplevel.Validator = groupsConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_identity_groups", groupsConfig{})
+}
+
+// Validate checks the identity groups configuration without contacting Vault.
+func (c groupsConfig) Validate(entriesBytes []byte) error {
+	var groups []group
+	return toplevel.ValidateEntries(entriesBytes, &groups)
+}
+
+// Apply ensures that the identity groups written by vault-manager are
+// configured exactly as provided.
+//
+// The member entities of internal groups are declared by name and resolved to
+// their IDs; external groups get their members from their aliases.
+func (c groupsConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var groups []group
+	if err := yaml.Unmarshal(entriesBytes, &groups); err != nil {
+		return errors.Wrap(err, "failed to decode identity groups configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	desired := make([]endpoint.Entry, 0, len(groups))
+	for _, g := range groups {
+		if g.Type == "" {
+			g.Type = "internal"
+		}
+		data := map[string]interface{}{
+			"type":     g.Type,
+			"policies": append([]string{}, g.Policies...),
+			"metadata": tagged(g.Metadata),
+		}
+		if g.Type == "internal" {
+			ids, err := entityIDs(client, g.Members, dryRun)
+			if err != nil {
+				return err
+			}
+			data["member_entity_ids"] = ids
+		}
+		desired = append(desired, endpoint.Entry{Path: namePath(groupPath, g.Name), Data: data})
+	}
+
+	existing, err := readManaged(client, namePath(groupPath, ""))
+	if err != nil {
+		return err
+	}
+	for _, e := range existing {
+		if ids, ok := e.Data["member_entity_ids"].([]interface{}); ok {
+			e.Data["member_entity_ids"] = sortedStrings(ids)
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_identity_groups", desired, existing, dryRun)
+}
+
+// entityIDs resolves the names of entities into their sorted IDs.
+//
+// Entities that don't exist yet are only expected in dry-run mode, where they
+// are left out.
+func entityIDs(client *api.Client, names []string, dryRun bool) ([]string, error) {
+	return objectIDs(client, entityPath, "member entity of group", names, dryRun)
+}
+
+// objectIDs resolves the names of the objects under dir into their sorted IDs.
+//
+// Objects that don't exist yet are only expected in dry-run mode, where they
+// are left out.
+func objectIDs(client *api.Client, dir, kind string, names []string, dryRun bool) ([]string, error) {
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		e, ok, err := endpoint.Read(client, namePath(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if !dryRun {
+				return nil, errors.Errorf("failed to find %s %s", kind, name)
+			}
+			logrus.WithField("name", name).Warnf("%s does not exist yet", kind)
+			continue
+		}
+		id, _ := e.Data["id"].(string)
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func sortedStrings(xs []interface{}) []string {
+	s := make([]string, 0, len(xs))
+	for _, x := range xs {
+		if str, ok := x.(string); ok {
+			s = append(s, str)
+		}
+	}
+	sort.Strings(s)
+	return s
+}
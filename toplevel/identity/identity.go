@@ -0,0 +1,62 @@
+// Package identity implements the application of a declarative configuration
+// for the objects of Vault's identity secrets engine.
+//
+// The identity store also holds objects created by Vault itself, like the
+// entities created on login, so only the objects that vault-manager has
+// written, which are tagged in their metadata, are ever deleted.
+package identity
+
+import (
+	"path"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+const (
+	// managedKey is the metadata key tagging the objects written by
+	// vault-manager.
+	managedKey = "managed_by"
+	// managedValue is the value of managedKey.
+	managedValue = "vault-manager"
+)
+
+// tagged returns a copy of the metadata tagged as managed by vault-manager.
+func tagged(metadata map[string]string) map[string]string {
+	m := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		m[k] = v
+	}
+	m[managedKey] = managedValue
+	return m
+}
+
+// managed reports whether an existing object has been written by
+// vault-manager.
+func managed(e endpoint.Entry) bool {
+	metadata, _ := e.Data["metadata"].(map[string]interface{})
+	return metadata[managedKey] == managedValue
+}
+
+// readManaged returns the objects listed by name under dir that have been
+// written by vault-manager.
+func readManaged(client *api.Client, dir string) ([]endpoint.Entry, error) {
+	existingObjects, err := endpoint.ReadAll(client, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]endpoint.Entry, 0)
+	for _, e := range existingObjects {
+		if managed(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// namePath returns the path of an object addressed by name.
+func namePath(dir, name string) string {
+	return path.Join(dir, "name", name)
+}
@@ -0,0 +1,74 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+func TestTaggedObjectsAreManaged(t *testing.T) {
+	metadata := map[string]string{"team": "app-sre"}
+
+	tags := tagged(metadata)
+	require.Equal(t, map[string]string{"team": "app-sre"}, metadata, "tagging must not modify the configured metadata")
+
+	existing := make(map[string]interface{}, len(tags))
+	for k, v := range tags {
+		existing[k] = v
+	}
+	require.True(t, managed(endpoint.Entry{Data: map[string]interface{}{"metadata": existing}}))
+}
+
+func TestObjectsCreatedByVaultAreNotManaged(t *testing.T) {
+	require.False(t, managed(endpoint.Entry{Data: map[string]interface{}{"metadata": nil}}))
+	require.False(t, managed(endpoint.Entry{Data: map[string]interface{}{"metadata": map[string]interface{}{"team": "app-sre"}}}))
+}
+
+func TestAliasEqualsIgnoresServerAssignedID(t *testing.T) {
+	configured := alias{Name: "jane@example.com", Mount: "oidc/", Canonical: "jane", mountAccessor: "auth_oidc_1234", canonicalID: "5678"}
+	listed := alias{Name: "jane@example.com", Mount: "oidc", Canonical: "jane", mountAccessor: "auth_oidc_1234", canonicalID: "5678", id: "9abc"}
+
+	require.Equal(t, "oidc/jane@example.com", configured.Key())
+	require.True(t, configured.Equals(listed))
+
+	listed.canonicalID = "def0"
+	require.False(t, configured.Equals(listed))
+}
+
+func TestWithoutConflicts(t *testing.T) {
+	aliases := []alias{
+		{Name: "jane@example.com", Mount: "oidc/", Canonical: "jane"},
+		{Name: "jane@example.com", Mount: "oidc", Canonical: "jane"},
+		{Name: "jane@example.com", Mount: "oidc/", Canonical: "janet"},
+		{Name: "john@example.com", Mount: "oidc/", Canonical: "john"},
+	}
+
+	_, err := withoutConflicts(aliases, conflictsFail)
+	require.EqualError(t, err, "alias oidc/jane@example.com is declared for both jane and janet")
+
+	kept, err := withoutConflicts(aliases, conflictsFirstWins)
+	require.NoError(t, err)
+	require.Equal(t, []alias{aliases[0], aliases[3]}, kept)
+
+	kept, err = withoutConflicts(aliases, conflictsLastWins)
+	require.NoError(t, err)
+	require.Equal(t, []alias{aliases[2], aliases[3]}, kept)
+}
+
+func TestStaleAccessorIsRepointed(t *testing.T) {
+	kind := aliasKind{name: "vault_identity_group_aliases", dir: "identity/group-alias", canonicalDir: groupPath}
+	desired := []alias{{Name: "sre", Mount: "oidc/", Canonical: "sre", kind: kind, mountAccessor: "auth_oidc_new", canonicalID: "5678"}}
+	existing := withMounts([]alias{
+		{Name: "sre", Canonical: "sre", kind: kind, mountAccessor: "auth_oidc_old", canonicalID: "5678", id: "9abc"},
+	}, desired, map[string]string{"oidc": "auth_oidc_new"})
+
+	toBeWritten, toBeDeleted := vault.DiffItems(asAliasItems(desired), asAliasItems(existing))
+	require.Len(t, toBeWritten, 1)
+	require.Empty(t, toBeDeleted)
+	require.Equal(t, []vault.Operation{vault.WriteOperation("identity/group-alias/id/9abc", false)},
+		aliasOperations(kind, toBeWritten[0], false, existing))
+	require.Equal(t, "auth_oidc_new", toBeWritten[0].(alias).data()["mount_accessor"])
+}
@@ -0,0 +1,203 @@
+package identity
+
+import (
+	"context"
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// oidcPath is where the objects of Vault's OIDC provider and identity tokens
+// are managed.
+const oidcPath = "identity/oidc"
+
+// builtinOIDC lists the names of the OIDC objects that Vault creates itself,
+// which are never deleted.
+var builtinOIDC = []string{"default", "allow_all"}
+
+// oidcKind describes one kind of object of Vault's OIDC provider or identity
+// tokens.
+type oidcKind struct {
+	// name is the name of the top-level managing the objects.
+	name string
+	// dir is where the objects are managed, e.g. "identity/oidc/client".
+	dir string
+	// sensitive lists the settings returned by Vault that are neither
+	// compared nor logged, such as client secrets.
+	sensitive []string
+}
+
+// oidcObject is a provider, client or scope of Vault's OIDC provider, or a
+// signing key or role of identity tokens.
+type oidcObject struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// assignment allows entities and groups, declared by name, to authenticate
+// with OIDC clients.
+type assignment struct {
+	Name     string   `yaml:"name" validate:"required"`
+	Entities []string `yaml:"entities"`
+	Groups   []string `yaml:"groups"`
+}
+
+type oidcConfig struct {
+	kind oidcKind
+}
+
+var _ toplevel.Configuration = oidcConfig{}
+var _ toplevel.Validator = oidcConfig{}
+
+type assignmentsConfig struct {
+	kind oidcKind
+}
+
+var _ toplevel.Configuration = assignmentsConfig{}
+var _ toplevel.Validator = assignmentsConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_identity_oidc_keys", oidcConfig{oidcKind{
+		name: "vault_identity_oidc_keys",
+		dir:  path.Join(oidcPath, "key"),
+	}})
+	toplevel.RegisterConfiguration("vault_identity_oidc_roles", oidcConfig{oidcKind{
+		name: "vault_identity_oidc_roles",
+		dir:  path.Join(oidcPath, "role"),
+	}})
+	toplevel.RegisterConfiguration("vault_identity_oidc_assignments", assignmentsConfig{oidcKind{
+		name: "vault_identity_oidc_assignments",
+		dir:  path.Join(oidcPath, "assignment"),
+	}})
+	toplevel.RegisterConfiguration("vault_identity_oidc_scopes", oidcConfig{oidcKind{
+		name: "vault_identity_oidc_scopes",
+		dir:  path.Join(oidcPath, "scope"),
+	}})
+	toplevel.RegisterConfiguration("vault_identity_oidc_clients", oidcConfig{oidcKind{
+		name:      "vault_identity_oidc_clients",
+		dir:       path.Join(oidcPath, "client"),
+		sensitive: []string{"client_secret"},
+	}})
+	toplevel.RegisterConfiguration("vault_identity_oidc_providers", oidcConfig{oidcKind{
+		name: "vault_identity_oidc_providers",
+		dir:  path.Join(oidcPath, "provider"),
+	}})
+}
+
+// Validate checks the identity oidc configuration without contacting Vault.
+func (c oidcConfig) Validate(entriesBytes []byte) error {
+	var objects []oidcObject
+	return toplevel.ValidateEntries(entriesBytes, &objects)
+}
+
+// Apply ensures that the objects of a kind of Vault's OIDC provider or identity
+// tokens are configured exactly as provided, besides the ones created by Vault.
+func (c oidcConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var objects []oidcObject
+	if err := yaml.Unmarshal(entriesBytes, &objects); err != nil {
+		return errors.Wrap(err, "failed to decode identity oidc configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0, len(objects))
+	for _, o := range objects {
+		desired = append(desired, endpoint.Entry{Path: path.Join(c.kind.dir, o.Name), Data: o.Options, Sensitive: c.kind.sensitive})
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := readOIDC(client, c.kind)
+	if err != nil {
+		return err
+	}
+
+	return endpoint.Apply(ctx, c.kind.name, desired, existing, dryRun)
+}
+
+// Validate checks the identity oidc assignments configuration without contacting Vault.
+func (c assignmentsConfig) Validate(entriesBytes []byte) error {
+	var assignments []assignment
+	return toplevel.ValidateEntries(entriesBytes, &assignments)
+}
+
+// Apply ensures that the assignments of Vault's OIDC provider are configured
+// exactly as provided, besides the ones created by Vault.
+func (c assignmentsConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var assignments []assignment
+	if err := yaml.Unmarshal(entriesBytes, &assignments); err != nil {
+		return errors.Wrap(err, "failed to decode identity oidc assignments configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	desired := make([]endpoint.Entry, 0, len(assignments))
+	for _, a := range assignments {
+		entityIDs, err := objectIDs(client, entityPath, "entity of oidc assignment", a.Entities, dryRun)
+		if err != nil {
+			return err
+		}
+		groupIDs, err := objectIDs(client, groupPath, "group of oidc assignment", a.Groups, dryRun)
+		if err != nil {
+			return err
+		}
+		desired = append(desired, endpoint.Entry{
+			Path: path.Join(c.kind.dir, a.Name),
+			Data: map[string]interface{}{
+				"entity_ids": entityIDs,
+				"group_ids":  groupIDs,
+			},
+		})
+	}
+
+	existing, err := readOIDC(client, c.kind)
+	if err != nil {
+		return err
+	}
+	for _, e := range existing {
+		for _, k := range []string{"entity_ids", "group_ids"} {
+			if ids, ok := e.Data[k].([]interface{}); ok {
+				e.Data[k] = sortedStrings(ids)
+			}
+		}
+	}
+
+	return endpoint.Apply(ctx, c.kind.name, desired, existing, dryRun)
+}
+
+// readOIDC returns the existing objects of a kind, besides the ones created by
+// Vault, with their sensitive settings redacted from logs.
+func readOIDC(client *api.Client, kind oidcKind) ([]endpoint.Entry, error) {
+	existingObjects, err := endpoint.ReadAll(client, kind.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range existingObjects {
+		if isBuiltinOIDC(path.Base(e.Path)) {
+			continue
+		}
+		e.Sensitive = kind.sensitive
+		existing = append(existing, e)
+	}
+	return existing, nil
+}
+
+func isBuiltinOIDC(name string) bool {
+	for _, n := range builtinOIDC {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
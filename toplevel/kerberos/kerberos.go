@@ -0,0 +1,116 @@
+// Package kerberos implements the application of a declarative configuration
+// for Vault Kerberos auth methods and their group policy mappings.
+package kerberos
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+var (
+	// sensitiveConfig lists the settings of the auth method that Vault never
+	// returns.
+	sensitiveConfig = []string{"keytab"}
+	// sensitiveLDAPConfig lists the settings of the LDAP server looking up
+	// groups that Vault never returns.
+	sensitiveLDAPConfig = []string{"bindpass"}
+)
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	// Config holds the base64 encoded keytab, usually a referenced secret, and
+	// the service account.
+	Config map[string]interface{} `yaml:"config"`
+	// LDAPConfig holds the settings of the LDAP server looking up the groups
+	// of users.
+	LDAPConfig map[string]interface{} `yaml:"ldap_config"`
+	Groups     []group                `yaml:"groups"`
+}
+
+type group struct {
+	Name     string   `yaml:"name" validate:"required"`
+	Policies []string `yaml:"policies"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_kerberos_auth", config{})
+}
+
+// Validate checks the kerberos auth configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config and group policy mappings of Kerberos auth
+// methods are configured exactly as provided.
+//
+// Groups of a declared auth method that are missing from the configuration
+// are deleted; auth methods that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode kerberos auth configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		mount := path.Join("auth", e.Path)
+
+		for _, settings := range []struct {
+			path      string
+			data      map[string]interface{}
+			sensitive []string
+		}{
+			{path.Join(mount, "config"), e.Config, sensitiveConfig},
+			{path.Join(mount, "config/ldap"), e.LDAPConfig, sensitiveLDAPConfig},
+		} {
+			if settings.data == nil {
+				continue
+			}
+			desired = append(desired, endpoint.Entry{Path: settings.path, Data: settings.data, Sensitive: settings.sensitive})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingSettings, ok, err := endpoint.Read(client, settings.path)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingSettings)
+			}
+		}
+
+		for _, g := range e.Groups {
+			desired = append(desired, endpoint.Entry{
+				Path: path.Join(mount, "groups", g.Name),
+				Data: map[string]interface{}{"policies": append([]string{}, g.Policies...)},
+			})
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingGroups, err := endpoint.ReadAll(client, path.Join(mount, "groups"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingGroups...)
+	}
+
+	return endpoint.Apply(ctx, "vault_kerberos_auth", desired, existing, dryRun)
+}
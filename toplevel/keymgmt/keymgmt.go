@@ -0,0 +1,162 @@
+// Package keymgmt implements the application of a declarative configuration
+// for Vault Enterprise Key Management secrets engines.
+package keymgmt
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveKMS lists the settings of KMS providers that Vault never returns.
+var sensitiveKMS = []string{"credentials"}
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	Keys []key  `yaml:"keys"`
+	KMS  []kms  `yaml:"kms"`
+}
+
+type key struct {
+	Name string `yaml:"name" validate:"required"`
+	Type string `yaml:"type"`
+	// Options are the other settings of the key, e.g. deletion_allowed and
+	// min_enabled_version.
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// kms is a cloud KMS provider the keys of the secrets engine are distributed
+// to.
+type kms struct {
+	Name string `yaml:"name" validate:"required"`
+	// Options are the settings of the provider, e.g. provider, key_collection
+	// and credentials.
+	Options map[string]interface{} `yaml:"options"`
+	Keys    []distribution         `yaml:"keys"`
+}
+
+// distribution distributes a key of the secrets engine to a KMS provider.
+type distribution struct {
+	Name string `yaml:"name" validate:"required"`
+	// Options are the settings of the distributed key, e.g. purpose and
+	// protection.
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_keymgmt", config{})
+}
+
+// Validate checks the keymgmt configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the keys, KMS providers and key distributions of Key
+// Management secrets engines are configured as provided.
+//
+// Keys and their distributions are never deleted, as this would destroy the
+// key material, and the type of existing keys is never changed. KMS providers
+// of a declared secrets engine that are missing from the configuration are
+// deleted. Vault instances that aren't Enterprise are skipped with a warning.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode keymgmt configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return err
+	}
+	if !vault.IsEnterprise(version) {
+		logrus.WithField("version", version).Warn("skipping keymgmt configuration on a Vault instance that isn't Enterprise")
+		return nil
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		for _, k := range e.Keys {
+			keyPath := path.Join(e.Path, "key", k.Name)
+			data := make(map[string]interface{}, len(k.Options)+1)
+			for name, v := range k.Options {
+				data[name] = v
+			}
+
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingKeys, ok, err := endpoint.Read(client, keyPath)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				data["type"] = k.Type
+			} else {
+				if existingType, _ := existingKeys.Data["type"].(string); k.Type != "" && k.Type != existingType {
+					logrus.WithFields(logrus.Fields{
+						"path":     keyPath,
+						"type":     k.Type,
+						"existing": existingType,
+					}).Warn("type of existing keymgmt key differs from configuration but can't be changed")
+				}
+				existing = append(existing, existingKeys)
+			}
+			desired = append(desired, endpoint.Entry{Path: keyPath, Data: data})
+		}
+
+		kmsPath := path.Join(e.Path, "kms")
+		for _, p := range e.KMS {
+			desired = append(desired, endpoint.Entry{Path: path.Join(kmsPath, p.Name), Data: p.Options, Sensitive: sensitiveKMS})
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingKMS, err := endpoint.ReadAll(client, kmsPath)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingKMS...)
+
+		// Keys are distributed once both they and their provider exist.
+		for _, p := range e.KMS {
+			for _, d := range p.Keys {
+				distributionPath := path.Join(kmsPath, p.Name, "key", d.Name)
+				desired = append(desired, endpoint.Entry{Path: distributionPath, Data: d.Options})
+				client, err := vault.ClientFromEnv(ctx)
+				if err != nil {
+					return err
+				}
+				existingDistribution, ok, err := endpoint.Read(client, distributionPath)
+				if err != nil {
+					return err
+				}
+				if ok {
+					existing = append(existing, existingDistribution)
+				}
+			}
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_keymgmt", desired, existing, dryRun)
+}
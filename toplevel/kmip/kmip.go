@@ -0,0 +1,137 @@
+// Package kmip implements the application of a declarative configuration
+// for Vault Enterprise KMIP secrets engines.
+package kmip
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	// Config holds the settings of the KMIP server, written to <path>/config.
+	Config map[string]interface{} `yaml:"config"`
+	Scopes []scope                `yaml:"scopes"`
+}
+
+// scope isolates the managed objects of the KMIP clients of its roles.
+type scope struct {
+	Name  string `yaml:"name" validate:"required"`
+	Roles []role `yaml:"roles"`
+}
+
+type role struct {
+	Name string `yaml:"name" validate:"required"`
+	// Options are the KMIP operations allowed to the role, e.g.
+	// operation_all, along with the settings of its certificates.
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_kmip", config{})
+}
+
+// Validate checks the kmip configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config, scopes and roles of KMIP secrets engines are
+// configured exactly as provided.
+//
+// Scopes and roles of a declared secrets engine that are missing from the
+// configuration are deleted, although Vault refuses to delete scopes that
+// still hold managed objects. Vault instances that aren't Enterprise are
+// skipped with a warning.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode kmip configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return err
+	}
+	if !vault.IsEnterprise(version) {
+		logrus.WithField("version", version).Warn("skipping kmip configuration on a Vault instance that isn't Enterprise")
+		return nil
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		if e.Config != nil {
+			configPath := path.Join(e.Path, "config")
+			desired = append(desired, endpoint.Entry{Path: configPath, Data: e.Config})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingConfig, ok, err := endpoint.Read(client, configPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingConfig)
+			}
+		}
+
+		// Scopes have no settings, and are created before their roles.
+		scopesPath := path.Join(e.Path, "scope")
+		for _, s := range e.Scopes {
+			desired = append(desired, endpoint.Entry{Path: path.Join(scopesPath, s.Name), Data: map[string]interface{}{}})
+		}
+		for _, s := range e.Scopes {
+			for _, r := range s.Roles {
+				desired = append(desired, endpoint.Entry{Path: path.Join(scopesPath, s.Name, "role", r.Name), Data: r.Options})
+			}
+		}
+
+		// Roles are deleted before their scopes.
+		existingScopes := make([]endpoint.Entry, 0)
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		keys, err := endpoint.List(client, scopesPath)
+		if err != nil {
+			return err
+		}
+		for _, name := range keys {
+			p := path.Join(scopesPath, strings.TrimSuffix(name, "/"))
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingRoles, err := endpoint.ReadAll(client, path.Join(p, "role"))
+			if err != nil {
+				return err
+			}
+			existing = append(existing, existingRoles...)
+			existingScopes = append(existingScopes, endpoint.Entry{Path: p, Data: map[string]interface{}{}})
+		}
+		existing = append(existing, existingScopes...)
+	}
+
+	return endpoint.Apply(ctx, "vault_kmip", desired, existing, dryRun)
+}
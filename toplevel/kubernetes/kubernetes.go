@@ -0,0 +1,94 @@
+// Package kubernetes implements the application of a declarative configuration
+// for Vault Kubernetes auth methods and their roles.
+package kubernetes
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConfig lists the settings of the auth method that Vault never
+// returns.
+var sensitiveConfig = []string{"token_reviewer_jwt"}
+
+type entry struct {
+	Path   string                 `yaml:"_path" validate:"required"`
+	Config map[string]interface{} `yaml:"config"`
+	Roles  []role                 `yaml:"roles"`
+}
+
+type role struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_kubernetes_auth", config{})
+}
+
+// Validate checks the kubernetes auth configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config and roles of Kubernetes auth methods are
+// configured exactly as provided.
+//
+// Roles of a declared auth method that are missing from the configuration are
+// deleted; auth methods that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode kubernetes auth configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		mount := path.Join("auth", e.Path)
+
+		if e.Config != nil {
+			configPath := path.Join(mount, "config")
+			desired = append(desired, endpoint.Entry{Path: configPath, Data: e.Config, Sensitive: sensitiveConfig})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingConfig, ok, err := endpoint.Read(client, configPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingConfig)
+			}
+		}
+
+		for _, r := range e.Roles {
+			desired = append(desired, endpoint.Entry{Path: path.Join(mount, "role", r.Name), Data: r.Options})
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingRoles, err := endpoint.ReadAll(client, path.Join(mount, "role"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingRoles...)
+	}
+
+	return endpoint.Apply(ctx, "vault_kubernetes_auth", desired, existing, dryRun)
+}
@@ -0,0 +1,105 @@
+// Package kv implements the application of a declarative configuration
+// for Vault KV version 2 secrets engines.
+package kv
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// durationSettings lists the settings that Vault returns formatted as Go
+// durations, e.g. "768h0m0s".
+var durationSettings = []string{"delete_version_after"}
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	// Config holds the settings written to <path>/config, e.g. max_versions,
+	// cas_required and delete_version_after.
+	Config map[string]interface{} `yaml:"config"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_kv", config{})
+}
+
+// Validate checks the kv configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the settings of KV version 2 secrets engines are
+// configured as provided.
+//
+// Settings are only updated, so secrets engines that aren't declared keep
+// their settings.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode kv configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		configPath := path.Join(e.Path, "config")
+		desired = append(desired, withNormalizedDurations(endpoint.Entry{Path: configPath, Data: e.Config}))
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingConfig, ok, err := endpoint.Read(client, configPath)
+		if err != nil {
+			return err
+		}
+		if ok {
+			existing = append(existing, withNormalizedDurations(existingConfig))
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_kv", desired, existing, dryRun)
+}
+
+// withNormalizedDurations formats the durations of an entry the way Vault
+// returns them, so that "72h" and "72h0m0s" compare equal. Durations may be
+// declared as strings or as a number of seconds.
+func withNormalizedDurations(e endpoint.Entry) endpoint.Entry {
+	data := make(map[string]interface{}, len(e.Data))
+	for k, v := range e.Data {
+		data[k] = v
+	}
+
+	for _, k := range durationSettings {
+		if d, ok := duration(data[k]); ok {
+			data[k] = d.String()
+		}
+	}
+
+	e.Data = data
+	return e
+}
+
+func duration(v interface{}) (time.Duration, bool) {
+	switch v := v.(type) {
+	case int:
+		return time.Duration(v) * time.Second, true
+	case string:
+		d, err := time.ParseDuration(v)
+		return d, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,74 @@
+package kv
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+func TestNormalizedDurationsCompareEqualToVaultFormat(t *testing.T) {
+	returned := withNormalizedDurations(endpoint.Entry{
+		Path: "secret/config",
+		Data: map[string]interface{}{"max_versions": 10, "delete_version_after": "72h0m0s"},
+	})
+
+	for _, declared := range []interface{}{"72h", 259200} {
+		configured := withNormalizedDurations(endpoint.Entry{
+			Path: "secret/config",
+			Data: map[string]interface{}{"max_versions": 10, "delete_version_after": declared},
+		})
+		require.Empty(t, configured.Differences(returned))
+	}
+}
+
+func TestNormalizedDurationsLeaveOtherValuesUntouched(t *testing.T) {
+	e := withNormalizedDurations(endpoint.Entry{
+		Path: "secret/config",
+		Data: map[string]interface{}{"cas_required": true, "delete_version_after": "30d"},
+	})
+	require.Equal(t, true, e.Data["cas_required"])
+	require.Equal(t, "30d", e.Data["delete_version_after"])
+}
+
+func TestMissingKeysNeverIncludeExistingKeys(t *testing.T) {
+	declared := map[string]interface{}{
+		"role_id":   "${env:ROLE_ID}",
+		"secret_id": "${file:/secrets/secret_id}",
+		"webhook":   nil,
+		"token":     nil,
+	}
+	existing := map[string]interface{}{"role_id": "existing", "token": "existing"}
+
+	toBeCreated, unpopulated := missingKeys(declared, existing)
+	require.Equal(t, []string{"secret_id"}, toBeCreated)
+	require.Equal(t, []string{"webhook"}, unpopulated)
+
+	toBeCreated, unpopulated = missingKeys(declared, nil)
+	require.Equal(t, []string{"role_id", "secret_id"}, toBeCreated)
+	require.Equal(t, []string{"token", "webhook"}, unpopulated)
+}
+
+func TestCurrentVersionOfKVv2Secret(t *testing.T) {
+	require.Equal(t, 3, currentVersion(map[string]interface{}{
+		"metadata": map[string]interface{}{"version": json.Number("3")},
+	}))
+	require.Equal(t, 0, currentVersion(map[string]interface{}{"data": nil}))
+}
+
+func TestChangedKeysOfMergedSecret(t *testing.T) {
+	declared := map[string]interface{}{"db_password": "new", "api_key": "same", "webhook": nil}
+	existing := map[string]interface{}{"db_password": "old", "api_key": "same", "owned_elsewhere": "kept"}
+
+	populated := populatedKeys(declared)
+	require.Equal(t, []string{"api_key", "db_password"}, populated)
+
+	values := make(map[string]interface{}, len(populated))
+	for _, k := range populated {
+		values[k] = declared[k]
+	}
+	require.Equal(t, []string{"db_password"}, changedKeys(values, existing))
+	require.Equal(t, []string{"api_key", "db_password"}, changedKeys(values, nil))
+}
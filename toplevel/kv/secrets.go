@@ -0,0 +1,260 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// secretsEntry declares the secrets that must exist in a KV secrets engine.
+type secretsEntry struct {
+	Path string `yaml:"_path" validate:"required"`
+	// Version is the version of the KV secrets engine, 1 unless specified.
+	Version int      `yaml:"version"`
+	Secrets []secret `yaml:"secrets"`
+}
+
+// secret declares the keys that must exist at a path of a KV secrets engine.
+//
+// Values are usually references to environment variables or files, so that
+// they aren't committed with the configuration. Keys without a value must be
+// populated by other means and are only reported when missing.
+type secret struct {
+	Path string                 `yaml:"path" validate:"required"`
+	Data map[string]interface{} `yaml:"data"`
+	// Merge has the declared keys with a value kept in sync, overwriting
+	// their existing values when they differ, for secrets whose other keys
+	// are owned by someone else. It requires version 2 of the secrets engine.
+	Merge bool `yaml:"merge"`
+}
+
+// seed is a secret that is missing some of its declared keys, or whose
+// merged keys differ.
+type seed struct {
+	path string
+	// merge is set if the secret is merged.
+	merge bool
+	// keys are the keys that are written.
+	keys []string
+	// data holds the existing keys of the secret merged with the written ones.
+	data map[string]interface{}
+}
+
+// casMismatch is part of the error returned by KV v2 when the version of a
+// secret differs from the one given for check-and-set.
+const casMismatch = "check-and-set parameter did not match"
+
+type secretsConfig struct{}
+
+var _ toplevel.Configuration = secretsConfig{}
+var _ toplevel.Validator = secretsConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_kv_secrets", secretsConfig{})
+}
+
+// Validate checks the kv secrets configuration without contacting Vault.
+func (c secretsConfig) Validate(entriesBytes []byte) error {
+	var entries []secretsEntry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the declared keys of KV secrets exist.
+//
+// Only missing keys are created: existing values are never overwritten, unless
+// the secret is merged, and secrets or keys that aren't declared are left
+// untouched.
+func (c secretsConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []secretsEntry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode kv secrets configuration")
+	}
+
+	seeds := make([]seed, 0)
+	for _, e := range entries {
+		for _, s := range e.Secrets {
+			p := e.dataPath(s.Path)
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existing, version, err := readSecret(client, p, e.Version)
+			if err != nil {
+				return err
+			}
+
+			toBeWritten, unpopulated := missingKeys(s.Data, existing)
+			for _, k := range unpopulated {
+				logrus.WithField("path", p).WithField("key", k).Warn("secret is missing a key that must be populated manually")
+			}
+			if s.Merge {
+				if e.Version != 2 {
+					return errors.Errorf("failed to merge secret %s: merging requires version 2 of the KV secrets engine", p)
+				}
+				toBeWritten = populatedKeys(s.Data)
+			}
+
+			written := make(map[string]interface{}, len(toBeWritten))
+			for _, k := range toBeWritten {
+				written[k] = s.Data[k]
+			}
+			written, _ = endpoint.Normalize(written).(map[string]interface{})
+			if _, err := endpoint.ResolveReferences(written); err != nil {
+				return errors.Wrapf(err, "failed to resolve referenced values of %s", p)
+			}
+			toBeWritten = changedKeys(written, existing)
+			if len(toBeWritten) == 0 {
+				continue
+			}
+
+			data := make(map[string]interface{}, len(existing)+len(written))
+			for k, v := range existing {
+				data[k] = v
+			}
+			for _, k := range toBeWritten {
+				data[k] = written[k]
+			}
+			// The secret is only written if it is still at the version read,
+			// so that keys written meanwhile are never overwritten.
+			if e.Version == 2 {
+				data = map[string]interface{}{
+					"data":    data,
+					"options": map[string]interface{}{"cas": version},
+				}
+			}
+
+			seeds = append(seeds, seed{path: p, merge: s.Merge, keys: toBeWritten, data: data})
+		}
+	}
+
+	// Only the written keys are planned, never their values.
+	actions := make([]vault.Action, 0, len(seeds))
+	for _, s := range seeds {
+		s := s
+		name := "create keys"
+		if s.merge {
+			name = "merge keys"
+		}
+		actions = append(actions, vault.Action{
+			Name:       name,
+			Key:        s.path,
+			Data:       map[string]interface{}{"keys": s.keys},
+			Operations: []vault.Operation{vault.WriteOperation(s.path, false)},
+			Perform:    s.write,
+		})
+	}
+	return vault.Act(ctx, "vault_kv_secrets", "kv", actions, dryRun)
+}
+
+// dataPath returns the path where a secret of the secrets engine is written.
+func (e secretsEntry) dataPath(p string) string {
+	if e.Version == 2 {
+		return path.Join(e.Path, "data", p)
+	}
+	return path.Join(e.Path, p)
+}
+
+// readSecret returns the keys of a secret, or nil if it doesn't exist, along
+// with its current version in a KV v2 secrets engine: 0 if it doesn't exist.
+func readSecret(client *api.Client, p string, version int) (map[string]interface{}, int, error) {
+	secret, err := client.Logical().Read(p)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to read secret %s from Vault instance", p)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, nil
+	}
+
+	if version == 2 {
+		data, _ := secret.Data["data"].(map[string]interface{})
+		return data, currentVersion(secret.Data), nil
+	}
+	return secret.Data, 0, nil
+}
+
+// currentVersion returns the version of a secret read from a KV v2 secrets
+// engine.
+func currentVersion(data map[string]interface{}) int {
+	metadata, _ := data["metadata"].(map[string]interface{})
+	switch v := metadata["version"].(type) {
+	case json.Number:
+		n, _ := v.Int64()
+		return int(n)
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// missingKeys returns the declared keys missing from an existing secret, split
+// between the ones with a value and the ones that must be populated manually.
+func missingKeys(declared, existing map[string]interface{}) (toBeCreated, unpopulated []string) {
+	for k, v := range declared {
+		if _, ok := existing[k]; ok {
+			continue
+		}
+		if v == nil {
+			unpopulated = append(unpopulated, k)
+		} else {
+			toBeCreated = append(toBeCreated, k)
+		}
+	}
+	sort.Strings(toBeCreated)
+	sort.Strings(unpopulated)
+
+	return
+}
+
+// populatedKeys returns the declared keys that have a value.
+func populatedKeys(declared map[string]interface{}) []string {
+	keys := make([]string, 0, len(declared))
+	for k, v := range declared {
+		if v != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// changedKeys returns the keys whose value is missing from an existing secret
+// or differs from it.
+func changedKeys(values, existing map[string]interface{}) []string {
+	changed := make([]string, 0, len(values))
+	for k, v := range values {
+		if ev, ok := existing[k]; !ok || fmt.Sprintf("%v", ev) != fmt.Sprintf("%v", v) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func (s seed) write(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_kv_secrets", Key: s.path, Operation: "write"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(s.path, s.data); err != nil {
+		toplevel.Emit(event.WithError(err))
+		if strings.Contains(err.Error(), casMismatch) {
+			return errors.Errorf("secret %s changed while being seeded, keys weren't created; run again to seed the keys still missing", s.path)
+		}
+		return errors.Wrapf(err, "failed to write secret %s to Vault instance", s.path)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", s.path).WithField("keys", s.keys).Info("successfully wrote secret keys to Vault instance")
+	return nil
+}
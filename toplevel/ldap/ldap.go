@@ -0,0 +1,97 @@
+// Package ldap implements the application of a declarative configuration
+// for Vault LDAP auth methods and their group policy mappings.
+package ldap
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConfig lists the settings of the auth method that Vault never
+// returns.
+var sensitiveConfig = []string{"bindpass"}
+
+type entry struct {
+	Path   string                 `yaml:"_path" validate:"required"`
+	Config map[string]interface{} `yaml:"config"`
+	Groups []group                `yaml:"groups"`
+}
+
+type group struct {
+	Name     string   `yaml:"name" validate:"required"`
+	Policies []string `yaml:"policies"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_ldap_auth", config{})
+}
+
+// Validate checks the ldap auth configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config and group policy mappings of LDAP auth methods
+// are configured exactly as provided.
+//
+// Groups of a declared auth method that are missing from the configuration
+// are deleted; auth methods that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode ldap auth configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		mount := path.Join("auth", e.Path)
+
+		if e.Config != nil {
+			configPath := path.Join(mount, "config")
+			desired = append(desired, endpoint.Entry{Path: configPath, Data: e.Config, Sensitive: sensitiveConfig})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingConfig, ok, err := endpoint.Read(client, configPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingConfig)
+			}
+		}
+
+		for _, g := range e.Groups {
+			desired = append(desired, endpoint.Entry{
+				Path: path.Join(mount, "groups", g.Name),
+				Data: map[string]interface{}{"policies": append([]string{}, g.Policies...)},
+			})
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingGroups, err := endpoint.ReadAll(client, path.Join(mount, "groups"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingGroups...)
+	}
+
+	return endpoint.Apply(ctx, "vault_ldap_auth", desired, existing, dryRun)
+}
@@ -0,0 +1,131 @@
+// Package license implements a check of the license of a Vault Enterprise
+// instance.
+package license
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// statusPath is where the state of the license is reported.
+const statusPath = "sys/license/status"
+
+// expectations are declared as a single mapping.
+type expectations struct {
+	// ExpiryWarningDays is how many days before its expiration the license is
+	// reported.
+	ExpiryWarningDays int `yaml:"expiry_warning_days"`
+	// Features must all be enabled by the license.
+	Features []string `yaml:"features"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_license", config{})
+}
+
+// Validate checks the license configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var expected expectations
+	return toplevel.ValidateEntries(entriesBytes, &expected)
+}
+
+// Apply checks that the license of the Vault Enterprise instance meets the
+// provided expectations. It never makes changes.
+//
+// An error is returned if the license doesn't meet expectations, which is only
+// reported with warnings in dry-run mode. Other Vault instances are skipped
+// with a warning.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var expected expectations
+	if err := yaml.Unmarshal(entriesBytes, &expected); err != nil {
+		return errors.Wrap(err, "failed to decode license configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return err
+	}
+	if !vault.IsEnterprise(version) {
+		logrus.WithField("version", version).Warn("skipping license check on a Vault instance that isn't Enterprise")
+		return nil
+	}
+
+	status, _, err := endpoint.Read(client, statusPath)
+	if err != nil {
+		return err
+	}
+	// Vault 1.8 and later report the autoloaded license.
+	license := status.Data
+	if autoloaded, ok := status.Data["autoloaded"].(map[string]interface{}); ok {
+		license = autoloaded
+	}
+
+	failures := expected.failures(license, time.Now())
+	vault.ReportFindings("vault_license", failures)
+	for _, f := range failures {
+		if dryRun == true {
+			logrus.WithField("license", statusPath).Warn(f)
+			continue
+		}
+		logrus.WithField("license", statusPath).Error(f)
+	}
+	if len(failures) > 0 && !dryRun {
+		return errors.New("license doesn't meet expectations")
+	}
+
+	return nil
+}
+
+// failures describes how a license doesn't meet the expectations.
+func (e expectations) failures(license map[string]interface{}, now time.Time) []string {
+	if len(license) == 0 {
+		return []string{"no license is installed"}
+	}
+
+	failures := make([]string, 0)
+	expiration, _ := license["expiration_time"].(string)
+	if expiresAt, err := time.Parse(time.RFC3339, expiration); err != nil {
+		failures = append(failures, fmt.Sprintf("failed to parse license expiration time '%s'", expiration))
+	} else if !expiresAt.After(now) {
+		failures = append(failures, fmt.Sprintf("license expired on %s", expiresAt.Format(time.RFC3339)))
+	} else if warnAt := expiresAt.AddDate(0, 0, -e.ExpiryWarningDays); !warnAt.After(now) {
+		failures = append(failures, fmt.Sprintf("license expires on %s, in less than %d days", expiresAt.Format(time.RFC3339), e.ExpiryWarningDays))
+	}
+
+	features := make(map[string]struct{})
+	if listed, ok := license["features"].([]interface{}); ok {
+		for _, f := range listed {
+			features[fmt.Sprintf("%v", f)] = struct{}{}
+		}
+	}
+	missing := make([]string, 0)
+	for _, f := range e.Features {
+		if _, ok := features[f]; !ok {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		failures = append(failures, fmt.Sprintf("license is missing features: %s", strings.Join(missing, ", ")))
+	}
+
+	return failures
+}
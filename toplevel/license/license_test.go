@@ -0,0 +1,55 @@
+package license
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailures(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	expected := expectations{ExpiryWarningDays: 30, Features: []string{"Namespaces", "DR Replication"}}
+
+	table := []struct {
+		description string
+		license     map[string]interface{}
+		failures    int
+	}{
+		{
+			description: "missing license",
+			license:     nil,
+			failures:    1,
+		},
+		{
+			description: "valid license with every feature",
+			license: map[string]interface{}{
+				"expiration_time": "2021-01-01T00:00:00Z",
+				"features":        []interface{}{"Namespaces", "DR Replication", "HSM"},
+			},
+			failures: 0,
+		},
+		{
+			description: "license expiring soon",
+			license: map[string]interface{}{
+				"expiration_time": "2020-06-15T00:00:00Z",
+				"features":        []interface{}{"Namespaces", "DR Replication"},
+			},
+			failures: 1,
+		},
+		{
+			description: "expired license missing a feature",
+			license: map[string]interface{}{
+				"expiration_time": "2020-05-01T00:00:00Z",
+				"features":        []interface{}{"Namespaces"},
+			},
+			failures: 2,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			require.Len(t, expected.failures(tt.license, now), tt.failures)
+		})
+	}
+}
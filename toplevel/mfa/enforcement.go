@@ -0,0 +1,185 @@
+package mfa
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// enforcementPath is where login MFA enforcements are managed.
+const enforcementPath = "identity/mfa/login-enforcement"
+
+// enforcement requires MFA for the logins matching any of its targets.
+//
+// MFA methods, auth methods, groups and entities are declared by name, or by
+// path for auth methods, and resolved into the IDs and accessors that Vault
+// stores.
+type enforcement struct {
+	Name             string   `yaml:"name" validate:"required"`
+	MFAMethods       []string `yaml:"mfa_methods"`
+	AuthMethods      []string `yaml:"auth_methods"`
+	AuthMethodTypes  []string `yaml:"auth_method_types"`
+	IdentityGroups   []string `yaml:"identity_groups"`
+	IdentityEntities []string `yaml:"identity_entities"`
+}
+
+// idSettings lists the settings of enforcements holding lists of IDs, which
+// Vault returns in no particular order.
+var idSettings = []string{"mfa_method_ids", "auth_method_accessors", "auth_method_types", "identity_group_ids", "identity_entity_ids"}
+
+type enforcementsConfig struct{}
+
+var _ toplevel.Configuration = enforcementsConfig{}
+var _ toplevel.Validator = enforcementsConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_mfa_login_enforcements", enforcementsConfig{})
+}
+
+// Validate checks the mfa login enforcements configuration without contacting Vault.
+func (c enforcementsConfig) Validate(entriesBytes []byte) error {
+	var enforcements []enforcement
+	return toplevel.ValidateEntries(entriesBytes, &enforcements)
+}
+
+// Apply ensures that the login MFA enforcements are configured exactly as
+// provided.
+func (c enforcementsConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var enforcements []enforcement
+	if err := yaml.Unmarshal(entriesBytes, &enforcements); err != nil {
+		return errors.Wrap(err, "failed to decode mfa login enforcements configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	methods, err := methodIDs(client)
+	if err != nil {
+		return err
+	}
+	accessors, err := vault.AuthAccessors(client)
+	if err != nil {
+		return err
+	}
+
+	desired := make([]endpoint.Entry, 0, len(enforcements))
+	for _, e := range enforcements {
+		data := map[string]interface{}{"auth_method_types": sorted(e.AuthMethodTypes)}
+		for _, r := range []struct {
+			key, kind string
+			names     []string
+			lookup    func(string) (string, bool, error)
+		}{
+			{"mfa_method_ids", "mfa method", e.MFAMethods, mapLookup(methods)},
+			{"auth_method_accessors", "auth method", e.AuthMethods, mapLookup(accessors)},
+			{"identity_group_ids", "identity group", e.IdentityGroups, identityLookup(client, "identity/group")},
+			{"identity_entity_ids", "identity entity", e.IdentityEntities, identityLookup(client, "identity/entity")},
+		} {
+			ids, err := resolve(r.kind, r.names, r.lookup, dryRun)
+			if err != nil {
+				return err
+			}
+			data[r.key] = ids
+		}
+		desired = append(desired, endpoint.Entry{Path: path.Join(enforcementPath, e.Name), Data: data})
+	}
+
+	existing, err := endpoint.ReadAll(client, enforcementPath)
+	if err != nil {
+		return err
+	}
+	for _, e := range existing {
+		for _, k := range idSettings {
+			if ids, ok := e.Data[k].([]interface{}); ok {
+				e.Data[k] = sortedStrings(ids)
+			}
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_mfa_login_enforcements", desired, existing, dryRun)
+}
+
+// methodIDs returns the IDs of the named MFA methods by name.
+func methodIDs(client *api.Client) (map[string]string, error) {
+	methods, err := namedMethods(client)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string)
+	for _, e := range methods {
+		ids[e.Data[methodNameKey].(string)] = path.Base(e.Path)
+	}
+	return ids, nil
+}
+
+func mapLookup(m map[string]string) func(string) (string, bool, error) {
+	return func(name string) (string, bool, error) {
+		id, ok := m[strings.Trim(name, "/")]
+		return id, ok, nil
+	}
+}
+
+// identityLookup resolves the names of the identity objects under dir.
+func identityLookup(client *api.Client, dir string) func(string) (string, bool, error) {
+	return func(name string) (string, bool, error) {
+		e, ok, err := endpoint.Read(client, path.Join(dir, "name", name))
+		if err != nil || !ok {
+			return "", false, err
+		}
+		id, _ := e.Data["id"].(string)
+		return id, true, nil
+	}
+}
+
+// resolve resolves the names of objects into their sorted IDs.
+//
+// Objects that don't exist yet are only expected in dry-run mode, where they
+// are left out.
+func resolve(kind string, names []string, lookup func(string) (string, bool, error), dryRun bool) ([]string, error) {
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		id, ok, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if !dryRun {
+				return nil, errors.Errorf("failed to find %s %s of login enforcement", kind, name)
+			}
+			logrus.WithField("name", name).Warnf("%s of login enforcement does not exist yet", kind)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func sorted(xs []string) []string {
+	s := append([]string{}, xs...)
+	sort.Strings(s)
+	return s
+}
+
+func sortedStrings(xs []interface{}) []string {
+	s := make([]string, 0, len(xs))
+	for _, x := range xs {
+		if str, ok := x.(string); ok {
+			s = append(s, str)
+		}
+	}
+	sort.Strings(s)
+	return s
+}
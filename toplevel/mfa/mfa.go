@@ -0,0 +1,107 @@
+// Package mfa implements the application of a declarative configuration
+// for the login MFA of Vault.
+package mfa
+
+import (
+	"context"
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+const (
+	methodPath = "identity/mfa/method"
+	// methodNameKey holds the name that identifies a method, as Vault assigns
+	// their IDs.
+	methodNameKey = "method_name"
+)
+
+// methodTypes lists the types of MFA methods.
+var methodTypes = []string{"duo", "okta", "pingid", "totp"}
+
+// sensitiveOptions lists the settings of MFA methods that Vault never returns.
+var sensitiveOptions = []string{"secret_key", "integration_key", "api_token", "settings_file_base64"}
+
+type method struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Type    string                 `yaml:"type" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type methodsConfig struct{}
+
+var _ toplevel.Configuration = methodsConfig{}
+var _ toplevel.Validator = methodsConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_mfa_methods", methodsConfig{})
+}
+
+// Validate checks the mfa methods configuration without contacting Vault.
+func (c methodsConfig) Validate(entriesBytes []byte) error {
+	var methods []method
+	return toplevel.ValidateEntries(entriesBytes, &methods)
+}
+
+// Apply ensures that the named MFA methods are configured exactly as
+// provided. Methods created without a name aren't managed.
+func (c methodsConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var methods []method
+	if err := yaml.Unmarshal(entriesBytes, &methods); err != nil {
+		return errors.Wrap(err, "failed to decode mfa methods configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := namedMethods(client)
+	if err != nil {
+		return err
+	}
+	paths := make(map[string]string, len(existing))
+	for _, e := range existing {
+		paths[path.Join(path.Dir(e.Path), e.Data[methodNameKey].(string))] = e.Path
+	}
+
+	desired := make([]endpoint.Entry, 0, len(methods))
+	for _, m := range methods {
+		data := make(map[string]interface{}, len(m.Options)+1)
+		for k, v := range m.Options {
+			data[k] = v
+		}
+		data[methodNameKey] = m.Name
+
+		// methods are created by writing to the directory of their type
+		p, ok := paths[path.Join(methodPath, m.Type, m.Name)]
+		if !ok {
+			p = path.Join(methodPath, m.Type)
+		}
+		desired = append(desired, endpoint.Entry{Path: p, Data: data, Sensitive: sensitiveOptions})
+	}
+
+	return endpoint.Apply(ctx, "vault_mfa_methods", desired, existing, dryRun)
+}
+
+// namedMethods returns the existing MFA methods that have a name.
+func namedMethods(client *api.Client) ([]endpoint.Entry, error) {
+	methods := make([]endpoint.Entry, 0)
+	for _, t := range methodTypes {
+		existingMethods, err := endpoint.ReadAll(client, path.Join(methodPath, t))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range existingMethods {
+			if name, _ := e.Data[methodNameKey].(string); name != "" {
+				methods = append(methods, e)
+			}
+		}
+	}
+	return methods, nil
+}
@@ -0,0 +1,18 @@
+package mfa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSortsIDsAndSkipsMissingNamesInDryRun(t *testing.T) {
+	lookup := mapLookup(map[string]string{"oidc": "auth_oidc_2", "userpass": "auth_userpass_1"})
+
+	ids, err := resolve("auth method", []string{"userpass/", "missing", "oidc"}, lookup, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"auth_oidc_2", "auth_userpass_1"}, ids)
+
+	_, err = resolve("auth method", []string{"missing"}, lookup, false)
+	require.Error(t, err)
+}
@@ -0,0 +1,220 @@
+// Package namespace implements the application of a declarative configuration
+// for Vault Enterprise namespaces.
+package namespace
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+)
+
+// entry is a namespace, declared with its full path, e.g. "team-a/dev".
+type entry struct {
+	Path string `yaml:"path" validate:"required"`
+}
+
+var _ vault.Item = entry{}
+
+func (e entry) Key() string {
+	return strings.Trim(e.Path, "/")
+}
+
+func (e entry) Equals(i interface{}) bool {
+	entry, ok := i.(entry)
+	if !ok {
+		return false
+	}
+
+	return vault.EqualPathNames(e.Path, entry.Path)
+}
+
+// parent returns the path of the namespace holding this one, or "" for the
+// namespaces of the root namespace.
+func (e entry) parent() string {
+	if p := path.Dir(e.Key()); p != "." {
+		return p
+	}
+	return ""
+}
+
+// apiPath returns the path managing the namespace, prefixed by the path of
+// its parent so that it's requested from the root namespace.
+func (e entry) apiPath() string {
+	return path.Join(e.parent(), "sys/namespaces", path.Base(e.Key()))
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_namespaces", config{})
+}
+
+// Validate checks the namespaces configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the namespaces of a Vault Enterprise instance are exactly
+// the ones provided. The parents of nested namespaces don't need to be
+// declared.
+//
+// Deleting a namespace deletes everything it contains. Other Vault instances
+// are skipped with a warning.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode namespaces configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return err
+	}
+	if !vault.IsEnterprise(version) {
+		logrus.WithField("version", version).Warn("skipping namespaces configuration on a Vault instance that isn't Enterprise")
+		return nil
+	}
+
+	desired := withParents(entries)
+	existing, err := listNamespaces(client, "")
+	if err != nil {
+		return err
+	}
+
+	toBeWritten, toBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:       "vault_namespaces",
+		Package:    "namespace",
+		Desired:    asItems(desired),
+		Existing:   asItems(existing),
+		Operations: operations,
+	}, dryRun)
+	if err != nil {
+		return err
+	}
+
+	// Parents are created before their children, and deleted after them.
+	sort.Slice(toBeWritten, func(i, j int) bool { return toBeWritten[i].Key() < toBeWritten[j].Key() })
+	sort.Slice(toBeDeleted, func(i, j int) bool { return toBeDeleted[i].Key() > toBeDeleted[j].Key() })
+
+	for _, e := range toBeWritten {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := e.(entry).write(client); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range toBeDeleted {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := e.(entry).delete(client); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withParents returns the declared namespaces along with their parents, once
+// each.
+func withParents(entries []entry) []entry {
+	seen := make(map[string]struct{})
+	namespaces := make([]entry, 0, len(entries))
+	for _, e := range entries {
+		for p := e.Key(); p != ""; p = (entry{Path: p}).parent() {
+			if _, ok := seen[p]; ok {
+				break
+			}
+			seen[p] = struct{}{}
+			namespaces = append(namespaces, entry{Path: p})
+		}
+	}
+	return namespaces
+}
+
+// listNamespaces returns the namespaces nested in a namespace, recursively.
+func listNamespaces(client *api.Client, parent string) ([]entry, error) {
+	secret, err := client.Logical().List(path.Join(parent, "sys/namespaces"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list namespaces of %q from Vault instance", parent)
+	}
+
+	namespaces := make([]entry, 0)
+	if secret == nil || secret.Data == nil {
+		return namespaces, nil
+	}
+	keys, _ := secret.Data["keys"].([]interface{})
+	for _, k := range keys {
+		child := entry{Path: path.Join(parent, strings.Trim(k.(string), "/"))}
+		children, err := listNamespaces(client, child.Key())
+		if err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, child)
+		namespaces = append(namespaces, children...)
+	}
+
+	return namespaces, nil
+}
+
+func (e entry) write(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_namespaces", Key: e.Key(), Operation: "write"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(e.apiPath(), nil); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to create namespace %s in Vault instance", e.Key())
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("namespace", e.Key()).Info("successfully created namespace in Vault instance")
+	return nil
+}
+
+func (e entry) delete(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_namespaces", Key: e.Key(), Operation: "delete"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Delete(e.apiPath()); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to delete namespace %s from Vault instance", e.Key())
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("namespace", e.Key()).Info("successfully deleted namespace from Vault instance")
+	return nil
+}
+
+// operations lists the requests made to Vault to create, or delete, a namespace.
+func operations(e vault.Item, delete bool) []vault.Operation {
+	if delete {
+		return []vault.Operation{vault.DeleteOperation(e.(entry).apiPath(), false)}
+	}
+	return []vault.Operation{vault.WriteOperation(e.(entry).apiPath(), false)}
+}
+
+func asItems(xs []entry) (items []vault.Item) {
+	items = make([]vault.Item, 0)
+	for _, x := range xs {
+		items = append(items, x)
+	}
+
+	return
+}
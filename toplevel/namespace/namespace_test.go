@@ -0,0 +1,22 @@
+package namespace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithParentsAddsUndeclaredParentsOnce(t *testing.T) {
+	namespaces := withParents([]entry{{Path: "team-a/dev/"}, {Path: "team-a"}, {Path: "team-a/prod"}})
+
+	keys := make([]string, 0, len(namespaces))
+	for _, n := range namespaces {
+		keys = append(keys, n.Key())
+	}
+	require.Equal(t, []string{"team-a/dev", "team-a", "team-a/prod"}, keys)
+}
+
+func TestAPIPathIsRequestedFromTheParentNamespace(t *testing.T) {
+	require.Equal(t, "sys/namespaces/team-a", entry{Path: "team-a/"}.apiPath())
+	require.Equal(t, "team-a/dev/sys/namespaces/app", entry{Path: "team-a/dev/app"}.apiPath())
+}
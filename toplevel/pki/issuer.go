@@ -0,0 +1,118 @@
+package pki
+
+import (
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// issuersConfig is the settings endpoint holding the default issuer.
+const issuersConfig = "issuers"
+
+// issuer is the configuration of an issuer of a PKI secrets engine, written
+// to <path>/issuer/<name>. Its key and certificate are only set when the CA
+// is bootstrapped and are never compared.
+type issuer struct {
+	Name string `yaml:"name" validate:"required"`
+	// Ref is the ID of an existing issuer, or "default", to give the name to
+	// when no issuer has it yet, e.g. the issuer of a bootstrapped CA.
+	Ref string `yaml:"ref"`
+	// Options are the settings of the issuer, e.g. leaf_not_after_behavior
+	// and usage.
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// issuerNames returns the names of the issuers of a secrets engine by ID,
+// leaving out the issuers without one.
+func issuerNames(client *api.Client, mount string) (map[string]string, error) {
+	secret, err := client.Logical().List(path.Join(mount, "issuers"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list issuers of %s from Vault instance", mount)
+	}
+
+	names := make(map[string]string)
+	if secret == nil || secret.Data == nil {
+		return names, nil
+	}
+	keyInfo, _ := secret.Data["key_info"].(map[string]interface{})
+	for id, info := range keyInfo {
+		info, _ := info.(map[string]interface{})
+		if name, _ := info["issuer_name"].(string); name != "" {
+			names[id] = name
+		}
+	}
+	return names, nil
+}
+
+// issuerEntries returns the desired and existing settings of the declared
+// issuers of the secrets engine and of its default issuer.
+//
+// Issuers are identified by their name, whatever their generated ID, and the
+// ones missing from the configuration are left untouched, as they hold the
+// keys of CAs.
+func (e entry) issuerEntries(client *api.Client) (desired, existing []endpoint.Entry, err error) {
+	desired = make([]endpoint.Entry, 0)
+	existing = make([]endpoint.Entry, 0)
+	if len(e.Issuers) == 0 && e.DefaultIssuer == "" {
+		return desired, existing, nil
+	}
+
+	names, err := issuerNames(client, e.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make(map[string]string, len(names))
+	for id, name := range names {
+		ids[name] = id
+	}
+
+	for _, i := range e.Issuers {
+		data := normalized(i.Options)
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+		data["issuer_name"] = i.Name
+		d := endpoint.Entry{ID: path.Join(e.Path, "issuer", i.Name), Path: path.Join(e.Path, "issuer", i.Name), Data: data}
+
+		id, ok := ids[i.Name]
+		if !ok {
+			if i.Ref != "" {
+				d.Path = path.Join(e.Path, "issuer", i.Ref)
+			}
+			desired = append(desired, d)
+			continue
+		}
+		desired = append(desired, d)
+
+		ex, ok, err := endpoint.Read(client, path.Join(e.Path, "issuer", id))
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			ex.ID = d.ID
+			existing = append(existing, ex)
+		}
+	}
+
+	// The default issuer is written last, once the issuers are named.
+	if e.DefaultIssuer != "" {
+		p := path.Join(e.Path, "config", issuersConfig)
+		desired = append(desired, endpoint.Entry{Path: p, Data: map[string]interface{}{"default": e.DefaultIssuer}})
+		ex, ok, err := endpoint.Read(client, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			// Vault returns the ID of the default issuer
+			if id, _ := ex.Data["default"].(string); names[id] != "" {
+				ex.Data["default"] = names[id]
+			}
+			existing = append(existing, ex)
+		}
+	}
+
+	return desired, existing, nil
+}
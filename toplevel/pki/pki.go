@@ -0,0 +1,308 @@
+// Package pki implements the application of a declarative configuration
+// for Vault PKI secrets engines.
+package pki
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+type entry struct {
+	Path         string        `yaml:"_path" validate:"required"`
+	Root         *root         `yaml:"root"`
+	Intermediate *intermediate `yaml:"intermediate"`
+	Roles        []role        `yaml:"roles"`
+	// Config holds the settings written to <path>/config/<name>, e.g. the
+	// urls, crl, cluster and acme settings.
+	Config map[string]map[string]interface{} `yaml:"config"`
+	// Issuers are the issuers of the secrets engine whose settings are
+	// managed.
+	Issuers []issuer `yaml:"issuers"`
+	// DefaultIssuer is the name of the issuer used by default.
+	DefaultIssuer string `yaml:"default_issuer"`
+}
+
+type role struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// root generates a self-signed root CA whose private key never leaves Vault.
+type root struct {
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// intermediate makes the secrets engine an intermediate CA, either signed by
+// the root CA of another PKI secrets engine of the same Vault instance or by
+// importing a certificate signed elsewhere.
+type intermediate struct {
+	// Options are used to generate the CSR of the intermediate CA.
+	Options map[string]interface{} `yaml:"options"`
+	// SignedBy is the path of the PKI secrets engine signing the CSR.
+	SignedBy string `yaml:"signed_by"`
+	// SignOptions are used by SignedBy to sign the CSR.
+	SignOptions map[string]interface{} `yaml:"sign_options"`
+	// Certificate is the PEM bundle of an intermediate CA signed outside of
+	// Vault, for a CSR previously generated by the secrets engine.
+	Certificate string `yaml:"certificate"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_pki", config{})
+}
+
+// Validate checks the pki configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	if err := toplevel.ValidateEntries(entriesBytes, &entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, ok := e.Config[issuersConfig]; ok && e.DefaultIssuer != "" {
+			return errors.Errorf("pki secrets engine %s declares both default_issuer and the issuers config", e.Path)
+		}
+	}
+	return nil
+}
+
+// Apply ensures that PKI secrets engines are configured as provided.
+//
+// CAs are only generated or imported by secrets engines that don't have one
+// yet, so an existing CA is never replaced. Roles of a declared secrets engine
+// that are missing from the configuration are deleted, while its settings and
+// issuers are only updated.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode pki configuration")
+	}
+
+	// Check which secrets engines need a CA.
+	toBeBootstrapped := make([]entry, 0)
+	for _, e := range entries {
+		if e.Root == nil && e.Intermediate == nil {
+			continue
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		bootstrapped, err := hasCA(client, e.Path)
+		if err != nil {
+			return err
+		}
+		if bootstrapped {
+			logrus.WithField("path", e.Path).Debug("skipping pki secrets engine with an existing CA")
+			continue
+		}
+		toBeBootstrapped = append(toBeBootstrapped, e)
+	}
+	toBeBootstrapped, err := bootstrapOrder(toBeBootstrapped)
+	if err != nil {
+		return err
+	}
+
+	// The keys and certificates of the CAs are never planned.
+	actions := make([]vault.Action, 0, len(toBeBootstrapped))
+	for _, e := range toBeBootstrapped {
+		actions = append(actions, vault.Action{
+			Name:       "bootstrap CA",
+			Key:        e.Path,
+			Operations: e.operations(),
+			Perform:    e.bootstrap,
+		})
+	}
+	if err := vault.Act(ctx, "vault_pki", "pki", actions, dryRun); err != nil {
+		return err
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		// Issuers are named before the settings that may refer to them, e.g.
+		// the issuers allowed by ACME.
+		desiredIssuers, existingIssuers, err := e.issuerEntries(client)
+		if err != nil {
+			return err
+		}
+		desired = append(desired, desiredIssuers...)
+		existing = append(existing, existingIssuers...)
+
+		desiredSettings, existingSettings, err := endpoint.Settings(client, e.Path, e.Config, nil)
+		if err != nil {
+			return err
+		}
+		clusterFirst(desiredSettings)
+		desired = append(desired, desiredSettings...)
+		existing = append(existing, existingSettings...)
+
+		for _, r := range e.Roles {
+			desired = append(desired, endpoint.Entry{Path: path.Join(e.Path, "roles", r.Name), Data: r.Options})
+		}
+		existingRoles, err := endpoint.ReadAll(client, path.Join(e.Path, "roles"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingRoles...)
+	}
+
+	return endpoint.Apply(ctx, "vault_pki", desired, existing, dryRun)
+}
+
+// bootstrapOrder orders the secrets engines to bootstrap so that the CA
+// signing an intermediate CA is bootstrapped before it. Secrets engines are
+// otherwise kept in the order they are declared in.
+func bootstrapOrder(entries []entry) ([]entry, error) {
+	pending := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		pending[strings.Trim(e.Path, "/")] = true
+	}
+
+	ordered := make([]entry, 0, len(entries))
+	for len(ordered) < len(entries) {
+		progressed := false
+		for _, e := range entries {
+			p := strings.Trim(e.Path, "/")
+			if !pending[p] {
+				continue
+			}
+			if e.Intermediate != nil && pending[strings.Trim(e.Intermediate.SignedBy, "/")] {
+				continue
+			}
+			ordered = append(ordered, e)
+			pending[p] = false
+			progressed = true
+		}
+		if !progressed {
+			return nil, errors.New("pki secrets engines sign each other's intermediate CAs")
+		}
+	}
+	return ordered, nil
+}
+
+// clusterFirst orders the cluster settings of a secrets engine before its
+// other settings, and has them written on their own, as ACME can only be
+// enabled once the cluster path is set.
+func clusterFirst(settings []endpoint.Entry) {
+	sort.SliceStable(settings, func(i, j int) bool {
+		return path.Base(settings[i].Path) == "cluster" && path.Base(settings[j].Path) != "cluster"
+	})
+	for i := range settings {
+		if path.Base(settings[i].Path) == "cluster" {
+			settings[i].Ordered = true
+		}
+	}
+}
+
+// hasCA reports whether a PKI secrets engine already has a CA certificate.
+func hasCA(client *api.Client, mount string) (bool, error) {
+	secret, err := client.Logical().Read(path.Join(mount, "cert/ca"))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to read CA certificate of %s from Vault instance", mount)
+	}
+	if secret == nil || secret.Data == nil {
+		return false, nil
+	}
+
+	certificate, _ := secret.Data["certificate"].(string)
+	return certificate != "", nil
+}
+
+func (e entry) bootstrap(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_pki", Key: e.Path, Operation: "bootstrap"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+
+	var err error
+	switch {
+	case e.Root != nil:
+		_, err = client.Logical().Write(path.Join(e.Path, "root/generate/internal"), normalized(e.Root.Options))
+	case e.Intermediate.Certificate != "":
+		err = e.importIntermediate(client)
+	default:
+		err = e.signIntermediate(client)
+	}
+	if err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to bootstrap CA %s", e.Path)
+	}
+
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", e.Path).Info("successfully bootstrapped CA")
+	return nil
+}
+
+// signIntermediate generates the CSR of the intermediate CA, has it signed by
+// the root CA and sets the signed certificate.
+func (e entry) signIntermediate(client *api.Client) error {
+	csr, err := client.Logical().Write(path.Join(e.Path, "intermediate/generate/internal"), normalized(e.Intermediate.Options))
+	if err != nil {
+		return err
+	}
+
+	options := normalized(e.Intermediate.SignOptions)
+	options["csr"] = csr.Data["csr"]
+	signed, err := client.Logical().Write(path.Join(e.Intermediate.SignedBy, "root/sign-intermediate"), options)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().Write(path.Join(e.Path, "intermediate/set-signed"), map[string]interface{}{
+		"certificate": signed.Data["certificate"],
+	})
+	return err
+}
+
+// importIntermediate sets the certificate of an intermediate CA signed outside
+// of Vault.
+func (e entry) importIntermediate(client *api.Client) error {
+	data := map[string]interface{}{"certificate": e.Intermediate.Certificate}
+	if _, err := endpoint.ResolveReferences(data); err != nil {
+		return err
+	}
+
+	_, err := client.Logical().Write(path.Join(e.Path, "intermediate/set-signed"), data)
+	return err
+}
+
+// normalized returns a copy of options that can be written to Vault.
+func normalized(options map[string]interface{}) map[string]interface{} {
+	m, _ := endpoint.Normalize(options).(map[string]interface{})
+	return m
+}
+
+// operations lists the requests made to Vault to bootstrap the CA of the
+// secrets engine.
+func (e entry) operations() []vault.Operation {
+	switch {
+	case e.Root != nil:
+		return []vault.Operation{vault.WriteOperation(path.Join(e.Path, "root/generate/internal"), false)}
+	case e.Intermediate.Certificate != "":
+		return []vault.Operation{vault.WriteOperation(path.Join(e.Path, "intermediate/set-signed"), false)}
+	default:
+		return []vault.Operation{
+			vault.WriteOperation(path.Join(e.Path, "intermediate/generate/internal"), false),
+			vault.WriteOperation(path.Join(e.Intermediate.SignedBy, "root/sign-intermediate"), true),
+			vault.WriteOperation(path.Join(e.Path, "intermediate/set-signed"), false),
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+func TestHasCA(t *testing.T) {
+	table := []struct {
+		description string
+		status      int
+		body        string
+		hasCA       bool
+	}{
+		{"certificate is set", http.StatusOK, `{"data": {"certificate": "-----BEGIN CERTIFICATE-----"}}`, true},
+		{"certificate is empty", http.StatusOK, `{"data": {"certificate": ""}}`, false},
+		{"mount has no CA", http.StatusNotFound, `{"errors": []}`, false},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/v1/pki/cert/ca", r.URL.Path)
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			client, err := api.NewClient(&api.Config{Address: server.URL})
+			require.NoError(t, err)
+
+			bootstrapped, err := hasCA(client, "pki/")
+			require.NoError(t, err)
+			require.Equal(t, tt.hasCA, bootstrapped)
+		})
+	}
+}
+
+func TestClusterFirst(t *testing.T) {
+	settings := []endpoint.Entry{
+		{Path: "pki/config/acme"},
+		{Path: "pki/config/urls"},
+		{Path: "pki/config/cluster"},
+	}
+	clusterFirst(settings)
+	require.Equal(t, []endpoint.Entry{
+		{Path: "pki/config/cluster", Ordered: true},
+		{Path: "pki/config/acme"},
+		{Path: "pki/config/urls"},
+	}, settings)
+}
+
+func TestClusterSettingsAreWrittenBeforeACMEConcurrently(t *testing.T) {
+	var m sync.Mutex
+	written := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/pki/config/cluster" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		m.Lock()
+		written = append(written, r.URL.Path)
+		m.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	os.Setenv("VAULT_ADDR", server.URL)
+	os.Setenv("VAULT_AUTHTYPE", "token")
+	os.Setenv("VAULT_TOKEN", "root")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_AUTHTYPE")
+	defer os.Unsetenv("VAULT_TOKEN")
+	vault.SetConcurrency(4)
+	defer vault.SetConcurrency(1)
+
+	settings := []endpoint.Entry{
+		{Path: "pki/config/acme", Data: map[string]interface{}{"enabled": true}},
+		{Path: "pki/config/urls", Data: map[string]interface{}{"issuing_certificates": []interface{}{"https://vault.example.com/v1/pki/ca"}}},
+		{Path: "pki/config/cluster", Data: map[string]interface{}{"path": "https://vault.example.com/v1/pki"}},
+	}
+	clusterFirst(settings)
+	require.NoError(t, endpoint.Apply(context.Background(), "vault_pki", settings, nil, false))
+	require.Len(t, written, 3)
+	require.Equal(t, "/v1/pki/config/cluster", written[0])
+}
+
+func TestBootstrapOrder(t *testing.T) {
+	paths := func(entries []entry) []string {
+		p := make([]string, 0, len(entries))
+		for _, e := range entries {
+			p = append(p, e.Path)
+		}
+		return p
+	}
+
+	ordered, err := bootstrapOrder([]entry{
+		{Path: "pki-issuing/", Intermediate: &intermediate{SignedBy: "pki-int/"}},
+		{Path: "pki-int/", Intermediate: &intermediate{SignedBy: "pki-root"}},
+		{Path: "pki-imported/", Intermediate: &intermediate{Certificate: "${env:CERT}"}},
+		{Path: "pki-root/", Root: &root{}},
+		{Path: "pki-external/", Intermediate: &intermediate{SignedBy: "pki-bootstrapped/"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pki-imported/", "pki-root/", "pki-external/", "pki-int/", "pki-issuing/"}, paths(ordered))
+
+	_, err = bootstrapOrder([]entry{
+		{Path: "pki-a/", Intermediate: &intermediate{SignedBy: "pki-b/"}},
+		{Path: "pki-b/", Intermediate: &intermediate{SignedBy: "pki-a/"}},
+	})
+	require.Error(t, err)
+}
+
+func TestIssuerEntries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/pki/issuers":
+			require.Equal(t, "true", r.URL.Query().Get("list"))
+			fmt.Fprint(w, `{"data": {"keys": ["abc", "def"], "key_info": {"abc": {"issuer_name": "root-2024"}, "def": {"issuer_name": ""}}}}`)
+		case "/v1/pki/issuer/abc":
+			fmt.Fprint(w, `{"data": {"issuer_id": "abc", "issuer_name": "root-2024", "leaf_not_after_behavior": "err", "usage": "read-only,issuing-certificates", "serial_number": "1a:2b", "certificate": "-----BEGIN CERTIFICATE-----"}}`)
+		case "/v1/pki/config/issuers":
+			fmt.Fprint(w, `{"data": {"default": "abc", "default_follows_latest_issuer": false}}`)
+		default:
+			t.Fatalf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	e := entry{
+		Path: "pki/",
+		Issuers: []issuer{
+			{Name: "root-2024", Options: map[string]interface{}{"leaf_not_after_behavior": "err", "usage": "read-only,issuing-certificates"}},
+			{Name: "intermediate", Ref: "def", Options: map[string]interface{}{"leaf_not_after_behavior": "truncate"}},
+		},
+		DefaultIssuer: "root-2024",
+	}
+	desired, existing, err := e.issuerEntries(client)
+	require.NoError(t, err)
+	require.Len(t, desired, 3)
+	require.Len(t, existing, 2)
+
+	require.Equal(t, "pki/issuer/root-2024", desired[0].Path)
+	require.True(t, desired[0].Equals(existing[0]), "generated fields must not be compared")
+
+	require.Equal(t, "pki/issuer/intermediate", desired[1].Key())
+	require.Equal(t, "pki/issuer/def", desired[1].Path)
+	require.Equal(t, "intermediate", desired[1].Data["issuer_name"])
+
+	require.Equal(t, "pki/config/issuers", desired[2].Path)
+	require.True(t, desired[2].Equals(existing[1]), "the default issuer must be compared by name")
+}
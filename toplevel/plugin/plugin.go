@@ -0,0 +1,161 @@
+// Package plugin implements the application of a declarative configuration
+// for the plugin catalog of Vault.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+const (
+	catalogPath = "sys/plugins/catalog"
+	reloadPath  = "sys/plugins/reload/backend"
+)
+
+// pluginTypes lists the types of plugins registered in the catalog.
+var pluginTypes = []string{"auth", "database", "secret"}
+
+type entry struct {
+	Name    string   `yaml:"name" validate:"required"`
+	Type    string   `yaml:"type" validate:"required"`
+	SHA256  string   `yaml:"sha256"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Env is never returned by Vault, as it may hold secrets.
+	Env     []string `yaml:"env"`
+	Version string   `yaml:"version"`
+}
+
+func (e entry) catalogEntry() endpoint.Entry {
+	data := map[string]interface{}{
+		"sha256":  e.SHA256,
+		"command": e.Command,
+		"args":    e.Args,
+	}
+	if len(e.Env) > 0 {
+		data["env"] = e.Env
+	}
+	if e.Version != "" {
+		data["version"] = e.Version
+	}
+
+	return endpoint.Entry{
+		Path:      path.Join(catalogPath, e.Type, e.Name),
+		Data:      data,
+		Sensitive: []string{"env"},
+		Sudo:      true,
+	}
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_plugins", config{})
+}
+
+// Validate checks the plugins configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the plugins registered in the catalog are exactly the
+// ones provided, besides the builtin plugins.
+//
+// Mounts using a plugin whose SHA256 changed are reloaded, so that the new
+// binary is rolled out.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode plugins configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0, len(entries))
+	for _, e := range entries {
+		desired = append(desired, e.catalogEntry())
+	}
+	existing := make([]endpoint.Entry, 0)
+	for _, t := range pluginTypes {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		registered, err := endpoint.ReadAll(client, path.Join(catalogPath, t))
+		if err != nil {
+			return err
+		}
+		for _, e := range registered {
+			if builtin, _ := e.Data["builtin"].(bool); builtin {
+				continue
+			}
+			e.Sudo = true
+			existing = append(existing, e)
+		}
+	}
+
+	toBeReloaded := upgraded(entries, existing)
+
+	if err := endpoint.Apply(ctx, "vault_plugins", desired, existing, dryRun); err != nil {
+		return err
+	}
+
+	actions := make([]vault.Action, 0, len(toBeReloaded))
+	for _, e := range toBeReloaded {
+		actions = append(actions, vault.Action{
+			Name:       "reload",
+			Key:        e.Name,
+			Data:       map[string]interface{}{"sha256": e.SHA256},
+			Operations: []vault.Operation{vault.WriteOperation(reloadPath, true)},
+			Perform:    e.reload,
+		})
+	}
+	return vault.Act(ctx, "vault_plugins", "plugin", actions, dryRun)
+}
+
+// upgraded returns the registered plugins whose SHA256 changes, except for
+// database plugins which are reloaded by their secrets engines.
+func upgraded(entries []entry, existing []endpoint.Entry) []entry {
+	sums := make(map[string]string, len(existing))
+	for _, e := range existing {
+		sums[e.Path] = fmt.Sprintf("%v", e.Data["sha256"])
+	}
+
+	toBeReloaded := make([]entry, 0)
+	for _, e := range entries {
+		sum, ok := sums[e.catalogEntry().Path]
+		if !ok || sum == e.SHA256 {
+			continue
+		}
+		if e.Type == "database" {
+			logrus.WithField("name", e.Name).Warn("database plugins must be reloaded through the database/reload endpoint of their secrets engines")
+			continue
+		}
+		toBeReloaded = append(toBeReloaded, e)
+	}
+	return toBeReloaded
+}
+
+func (e entry) reload(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_plugins", Key: e.Name, Operation: "reload"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(reloadPath, map[string]interface{}{"plugin": e.Name}); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to reload plugin %s", e.Name)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("name", e.Name).Info("successfully reloaded plugin")
+	return nil
+}
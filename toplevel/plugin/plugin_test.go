@@ -0,0 +1,27 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+func TestUpgradedOnlyReloadsChangedRegisteredPlugins(t *testing.T) {
+	entries := []entry{
+		{Name: "unchanged", Type: "secret", SHA256: "aaa"},
+		{Name: "changed", Type: "auth", SHA256: "bbb"},
+		{Name: "new", Type: "secret", SHA256: "ccc"},
+		{Name: "changed-db", Type: "database", SHA256: "ddd"},
+	}
+	existing := []endpoint.Entry{
+		{Path: "sys/plugins/catalog/secret/unchanged", Data: map[string]interface{}{"sha256": "aaa"}},
+		{Path: "sys/plugins/catalog/auth/changed", Data: map[string]interface{}{"sha256": "old"}},
+		{Path: "sys/plugins/catalog/database/changed-db", Data: map[string]interface{}{"sha256": "old"}},
+	}
+
+	toBeReloaded := upgraded(entries, existing)
+	require.Len(t, toBeReloaded, 1)
+	require.Equal(t, "changed", toBeReloaded[0].Name)
+}
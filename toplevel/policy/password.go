@@ -0,0 +1,184 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// passwordPoliciesPath is where Vault's password policies are managed.
+const passwordPoliciesPath = "sys/policies/password"
+
+type passwordConfig struct{}
+
+var _ toplevel.Configuration = passwordConfig{}
+var _ toplevel.Validator = passwordConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_password_policies", passwordConfig{})
+}
+
+type passwordEntry struct {
+	Name   string `yaml:"name" validate:"required"`
+	Policy string `yaml:"policy"`
+}
+
+var _ vault.FieldDiffer = passwordEntry{}
+
+func (e passwordEntry) Key() string {
+	return e.Name
+}
+
+func (e passwordEntry) Equals(i interface{}) bool {
+	entry, ok := i.(passwordEntry)
+	if !ok {
+		return false
+	}
+
+	return e.Name == entry.Name && len(e.Differences(entry)) == 0
+}
+
+// Differences returns the names of the fields that differ from another entry.
+// Policies are compared regardless of their formatting and comments.
+func (e passwordEntry) Differences(i interface{}) []string {
+	entry, ok := i.(passwordEntry)
+	if !ok || normalizedPasswordPolicy(e.Policy) == normalizedPasswordPolicy(entry.Policy) {
+		return nil
+	}
+	return []string{"policy"}
+}
+
+func (e passwordEntry) FieldValue(field string) interface{} {
+	return e.Policy
+}
+
+// Validate checks the password policies configuration without contacting Vault.
+func (c passwordConfig) Validate(entriesBytes []byte) error {
+	var entries []passwordEntry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the password policies of the Vault instance are exactly
+// the ones provided.
+func (c passwordConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []passwordEntry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode password policies configuration")
+	}
+
+	existingPolicies := make([]passwordEntry, 0)
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	policies, err := endpoint.ReadAll(client, passwordPoliciesPath)
+	if err != nil {
+		return err
+	}
+	for _, e := range policies {
+		policy, _ := e.Data["policy"].(string)
+		existingPolicies = append(existingPolicies, passwordEntry{Name: path.Base(e.Path), Policy: policy})
+	}
+
+	toBeWritten, toBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:       "vault_password_policies",
+		Package:    "policy",
+		Desired:    asPasswordItems(entries),
+		Existing:   asPasswordItems(existingPolicies),
+		Operations: passwordOperations,
+	}, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range toBeWritten {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := e.(passwordEntry).write(client); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range toBeDeleted {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := e.(passwordEntry).delete(client); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e passwordEntry) write(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_password_policies", Key: e.Name, Operation: "write"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(path.Join(passwordPoliciesPath, e.Name), map[string]interface{}{"policy": e.Policy}); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to write password policy %s to Vault instance", e.Name)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("name", e.Name).Info("successfully wrote password policy to Vault instance")
+	return nil
+}
+
+func (e passwordEntry) delete(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_password_policies", Key: e.Name, Operation: "delete"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Delete(path.Join(passwordPoliciesPath, e.Name)); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to delete password policy %s from Vault instance", e.Name)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("name", e.Name).Info("successfully deleted password policy from Vault instance")
+	return nil
+}
+
+// normalizedPasswordPolicy returns the JSON encoding of the decoded policy, so
+// that whitespace, comments and the order of attributes don't matter. Policies
+// that can't be decoded are only trimmed.
+func normalizedPasswordPolicy(policy string) string {
+	var decoded interface{}
+	if err := hcl.Decode(&decoded, policy); err != nil {
+		return strings.TrimSpace(policy)
+	}
+
+	b, err := json.Marshal(decoded)
+	if err != nil {
+		return strings.TrimSpace(policy)
+	}
+	return string(b)
+}
+
+// passwordOperations lists the requests made to Vault to write, or delete, a
+// password policy.
+func passwordOperations(e vault.Item, delete bool) []vault.Operation {
+	if delete {
+		return []vault.Operation{vault.DeleteOperation(path.Join(passwordPoliciesPath, e.Key()), false)}
+	}
+	return []vault.Operation{vault.WriteOperation(path.Join(passwordPoliciesPath, e.Key()), false)}
+}
+
+func asPasswordItems(xs []passwordEntry) (items []vault.Item) {
+	items = make([]vault.Item, 0)
+	for _, x := range xs {
+		items = append(items, x)
+	}
+
+	return
+}
@@ -0,0 +1,23 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPoliciesCompareRegardlessOfFormatting(t *testing.T) {
+	declared := passwordEntry{Name: "db", Policy: `
+# at least one digit
+length = 20
+rule "charset" {
+  charset   = "0123456789"
+  min-chars = 1
+}
+`}
+	stored := passwordEntry{Name: "db", Policy: "length=20\nrule \"charset\" {\n\tcharset = \"0123456789\"\n\tmin-chars = 1\n}"}
+	require.True(t, declared.Equals(stored))
+
+	changed := passwordEntry{Name: "db", Policy: "length = 24\nrule \"charset\" {\n  charset = \"0123456789\"\n  min-chars = 1\n}\n"}
+	require.Equal(t, []string{"policy"}, declared.Differences(changed))
+}
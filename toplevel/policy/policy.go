@@ -1,28 +1,39 @@
 // Package policy implements the application of a declarative configuration
-// for Vault policies.
+// for Vault ACL policies.
 package policy
 
 import (
+	"context"
+	"path"
+	"sort"
+
 	"github.com/app-sre/vault-manager/pkg/vault"
 	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
+// aclPoliciesPath is where Vault's ACL policies are managed.
+const aclPoliciesPath = "sys/policies/acl"
+
 type config struct{}
 
 var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+var _ toplevel.Exporter = config{}
 
 func init() {
 	toplevel.RegisterConfiguration("vault_policies", config{})
 }
 
 type entry struct {
-	Name  string `yaml:"name"`
+	Name  string `yaml:"name" validate:"required"`
 	Rules string `yaml:"rules"`
 }
 
-var _ vault.Item = entry{}
+var _ vault.FieldDiffer = entry{}
 
 func (e entry) Key() string {
 	return e.Name
@@ -37,74 +48,193 @@ func (e entry) Equals(i interface{}) bool {
 	return e.Name == entry.Name && e.Rules == entry.Rules
 }
 
-func (c config) Apply(entriesBytes []byte, dryRun bool) {
+// Differences returns the names of the fields that differ from another entry.
+func (e entry) Differences(i interface{}) []string {
+	entry, ok := i.(entry)
+	if !ok || e.Rules == entry.Rules {
+		return nil
+	}
+	return []string{"rules"}
+}
+
+func (e entry) FieldValue(field string) interface{} {
+	return e.Rules
+}
+
+func (e entry) write(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_policies", Key: e.Name, Operation: "write"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(path.Join(aclPoliciesPath, e.Name), map[string]interface{}{"policy": e.Rules}); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to write policy %s to Vault instance", e.Name)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("name", e.Name).Info("successfully wrote policy to Vault instance")
+	return nil
+}
+
+func (e entry) delete(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_policies", Key: e.Name, Operation: "delete"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Delete(path.Join(aclPoliciesPath, e.Name)); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to delete policy %s from Vault instance", e.Name)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("name", e.Name).Info("successfully deleted policy from Vault instance")
+	return nil
+}
+
+// Validate checks the policies configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
 	// Unmarshal the list of configured secrets engines.
 	var entries []entry
 	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
-		logrus.WithError(err).Fatal("failed to decode policies configuration")
+		return errors.Wrap(err, "failed to decode policies configuration")
 	}
 
-	// List the existing policies.
-	existingPolicyNames, err := vault.ClientFromEnv().Sys().ListPolicies()
+	existingPolicies, err := existingEntries(ctx)
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to list policies from Vault instance")
+		return err
 	}
 
-	// Build a list of all the existing entries.
-	existingPolicies := make([]entry, 0)
-	if existingPolicies != nil {
-		for _, name := range existingPolicyNames {
-			policy, err := vault.ClientFromEnv().Sys().GetPolicy(name)
-			if err != nil {
-				logrus.WithError(err).WithField("name", name).Fatal("failed to get existing policy from Vault instance")
-			}
-			existingPolicies = append(existingPolicies, entry{Name: name, Rules: policy})
+	// Diff the local configuration with the Vault instance.
+	toBeWritten, toBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:       "vault_policies",
+		Package:    "policy",
+		Desired:    asItems(entries),
+		Existing:   asItems(existingPolicies),
+		Operations: operations,
+		Skip: func(e vault.Item, delete bool) bool {
+			// the builtin policies are never deleted
+			return delete && isDefaultPolicy(e.Key())
+		},
+	}, dryRun)
+	if err != nil {
+		return err
+	}
+
+	// Write any missing policies to the Vault instance.
+	if err := vault.ForEach(toBeWritten, func(e vault.Item) error {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
 		}
+		return e.(entry).write(client)
+	}); err != nil {
+		return err
 	}
 
-	// Diff the local configuration with the Vault instance.
-	toBeWritten, toBeDeleted := vault.DiffItems(asItems(entries), asItems(existingPolicies))
+	// Delete any policies from the Vault instance.
+	if err := vault.ForEach(toBeDeleted, func(e vault.Item) error {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		return e.(entry).delete(client)
+	}); err != nil {
+		return err
+	}
 
-	if dryRun == true {
-		for _, w := range toBeWritten {
-			logrus.Infof("[Dry Run]\tpackage=policy\tentry to be written='%v'", w)
+	return nil
+}
+
+// Export returns the ACL policies of an instance of Vault, except for the
+// builtin ones.
+func (c config) Export(ctx context.Context) (interface{}, error) {
+	existingPolicies, err := existingEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exported := make([]entry, 0, len(existingPolicies))
+	for _, e := range existingPolicies {
+		if !isDefaultPolicy(e.Name) {
+			exported = append(exported, e)
 		}
-		for _, d := range toBeDeleted {
-			if isDefaultPolicy(d.Key()) {
-				continue
-			}
+	}
+	sort.Slice(exported, func(i, j int) bool { return exported[i].Name < exported[j].Name })
+	return exported, nil
+}
 
-			logrus.Infof("[Dry Run]\tpackage=policy\tentry to be deleted='%v'", d)
+// existingEntries lists the ACL policies of an instance of Vault.
+func existingEntries(ctx context.Context) ([]entry, error) {
+	// List the existing policies.
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existingPolicyNames, err := listPolicies(client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build a list of all the existing entries.
+	existingPolicies := make([]entry, 0)
+	for _, name := range existingPolicyNames {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		// Write any missing policies to the Vault instance.
-		for _, e := range toBeWritten {
-			ent := e.(entry)
-			if err := vault.ClientFromEnv().Sys().PutPolicy(ent.Name, ent.Rules); err != nil {
-				logrus.WithError(err).WithField("name", ent.Name).Fatal("failed to write policy to Vault instance")
-			}
-			logrus.WithField("name", ent.Name).Info("successfully wrote policy to Vault instance")
+		rules, err := readPolicy(client, name)
+		if err != nil {
+			return nil, err
 		}
+		existingPolicies = append(existingPolicies, entry{Name: name, Rules: rules})
+	}
+	return existingPolicies, nil
+}
 
-		// Delete any policies from the Vault instance.
-		for _, e := range toBeDeleted {
-			ent := e.(entry)
-			if isDefaultPolicy(ent.Name) {
-				continue
-			}
-
-			if err := vault.ClientFromEnv().Sys().DeletePolicy(ent.Name); err != nil {
-				logrus.WithError(err).WithField("name", ent.Name).Fatal("failed to delete policy from Vault instance")
-			}
-			logrus.WithField("name", ent.Name).Info("successfully deleted policy from Vault instance")
-		}
+// listPolicies returns the names of the ACL policies of the Vault instance.
+func listPolicies(client *api.Client) ([]string, error) {
+	secret, err := client.Logical().List(aclPoliciesPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list policies from Vault instance")
+	}
+
+	var names []string
+	if secret == nil {
+		return names, nil
+	}
+	keys, _ := secret.Data["keys"].([]interface{})
+	for _, k := range keys {
+		names = append(names, k.(string))
+	}
+
+	return names, nil
+}
+
+// readPolicy returns the rules of an ACL policy of the Vault instance.
+func readPolicy(client *api.Client, name string) (string, error) {
+	secret, err := client.Logical().Read(path.Join(aclPoliciesPath, name))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get existing policy %s from Vault instance", name)
 	}
+	if secret == nil {
+		return "", nil
+	}
+
+	rules, _ := secret.Data["policy"].(string)
+	return rules, nil
 }
 
 func isDefaultPolicy(name string) bool {
 	return name == "root" || name == "default"
 }
 
+// operations lists the requests made to Vault to write, or delete, a policy.
+func operations(e vault.Item, delete bool) []vault.Operation {
+	if delete {
+		return []vault.Operation{vault.DeleteOperation(path.Join(aclPoliciesPath, e.Key()), false)}
+	}
+	return []vault.Operation{vault.WriteOperation(path.Join(aclPoliciesPath, e.Key()), false)}
+}
+
 func asItems(xs []entry) (items []vault.Item) {
 	items = make([]vault.Item, 0)
 	for _, x := range xs {
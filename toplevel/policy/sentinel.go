@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sentinelKind describes one type of Sentinel policies of Vault Enterprise.
+type sentinelKind struct {
+	// name is the name of the top-level managing the policies.
+	name string
+	// dir is where the policies are managed, e.g. "sys/policies/egp".
+	dir string
+}
+
+type sentinelEntry struct {
+	Name             string `yaml:"name" validate:"required"`
+	Policy           string `yaml:"policy"`
+	EnforcementLevel string `yaml:"enforcement_level"`
+	// Paths are the request paths an endpoint governing policy applies to.
+	Paths []string `yaml:"paths"`
+}
+
+type sentinelConfig struct {
+	kind sentinelKind
+}
+
+var _ toplevel.Configuration = sentinelConfig{}
+var _ toplevel.Validator = sentinelConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_egp_policies", sentinelConfig{sentinelKind{
+		name: "vault_egp_policies",
+		dir:  "sys/policies/egp",
+	}})
+	toplevel.RegisterConfiguration("vault_rgp_policies", sentinelConfig{sentinelKind{
+		name: "vault_rgp_policies",
+		dir:  "sys/policies/rgp",
+	}})
+}
+
+// Validate checks the sentinel policies configuration without contacting Vault.
+func (c sentinelConfig) Validate(entriesBytes []byte) error {
+	var entries []sentinelEntry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the Sentinel policies of a type are configured exactly as
+// provided. Vault instances that aren't Enterprise are skipped with a warning.
+func (c sentinelConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []sentinelEntry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode sentinel policies configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return err
+	}
+	if !vault.IsEnterprise(version) {
+		logrus.WithField("version", version).WithField("name", c.kind.name).Warn("skipping sentinel policies configuration on a Vault instance that isn't Enterprise")
+		return nil
+	}
+
+	desired := make([]endpoint.Entry, 0, len(entries))
+	for _, e := range entries {
+		data := map[string]interface{}{
+			"policy":            e.Policy,
+			"enforcement_level": e.EnforcementLevel,
+		}
+		if e.Paths != nil {
+			data["paths"] = append([]string{}, e.Paths...)
+		}
+		desired = append(desired, endpoint.Entry{Path: path.Join(c.kind.dir, e.Name), Data: data})
+	}
+	existing, err := endpoint.ReadAll(client, c.kind.dir)
+	if err != nil {
+		return err
+	}
+
+	return endpoint.Apply(ctx, c.kind.name, desired, existing, dryRun)
+}
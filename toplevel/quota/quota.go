@@ -0,0 +1,168 @@
+// Package quota implements the application of a declarative configuration
+// for Vault resource quotas.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// quotaKind describes one type of resource quota.
+type quotaKind struct {
+	// name is the name of the top-level managing the quotas.
+	name string
+	// dir is where the quotas are managed, e.g. "sys/quotas/rate-limit".
+	dir string
+	// enterprise is set for the quotas only supported by Vault Enterprise.
+	enterprise bool
+	// defaults are the options of the default quota built into Vault, if
+	// any, which can't be deleted and is reset to them instead.
+	defaults map[string]interface{}
+}
+
+// defaultQuota is the name of the quota built into Vault.
+const defaultQuota = "default"
+
+type entry struct {
+	Name string `yaml:"name" validate:"required"`
+	// ScopeNamespace is the Vault Enterprise namespace that a quota of the
+	// root namespace applies to, which prefixes its path. Unlike namespace,
+	// which manages the quota inside of the namespace, it leaves the quota in
+	// the namespace it's applied in.
+	ScopeNamespace string `yaml:"scope_namespace"`
+	// Options are written to <dir>/<name>, e.g. the path, rate and interval of
+	// a rate limit quota.
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct {
+	kind quotaKind
+}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_rate_limit_quotas", config{quotaKind{
+		name: "vault_rate_limit_quotas",
+		dir:  "sys/quotas/rate-limit",
+	}})
+	toplevel.RegisterConfiguration("vault_lease_count_quotas", config{quotaKind{
+		name:       "vault_lease_count_quotas",
+		dir:        "sys/quotas/lease-count",
+		enterprise: true,
+		defaults:   map[string]interface{}{"path": "", "max_leases": 300000},
+	}})
+}
+
+// Validate checks the quotas configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the quotas of a type are configured exactly as provided.
+//
+// Quotas are identified by the path they apply to along with their name, so
+// that changing the path of a quota deletes and creates it again. The default
+// quota is reset rather than deleted when it isn't declared.
+//
+// Quotas only supported by Vault Enterprise are skipped with a warning on
+// other Vault instances.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode quotas configuration")
+	}
+
+	if c.kind.enterprise {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		version, err := vault.Version(client)
+		if err != nil {
+			return err
+		}
+		if !vault.IsEnterprise(version) {
+			logrus.WithField("version", version).WithField("name", c.kind.name).Warn("skipping quotas configuration on a Vault instance that isn't Enterprise")
+			return nil
+		}
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := endpoint.ReadAll(client, c.kind.dir)
+	if err != nil {
+		return err
+	}
+
+	desired, existing := c.kind.quotas(entries, existing)
+	return endpoint.Apply(ctx, c.kind.name, desired, existing, dryRun)
+}
+
+// quotas returns the desired and existing quotas, identified by their scope
+// and name. The default quota is reset when it isn't declared.
+func (k quotaKind) quotas(entries []entry, existing []endpoint.Entry) (desired, identified []endpoint.Entry) {
+	desired = make([]endpoint.Entry, 0, len(entries)+1)
+	declaredDefault := false
+	for _, e := range entries {
+		data := make(map[string]interface{}, len(e.Options)+1)
+		for key, v := range e.Options {
+			data[key] = v
+		}
+		if e.ScopeNamespace != "" {
+			p, _ := data["path"].(string)
+			data["path"] = strings.Trim(e.ScopeNamespace, "/") + "/" + strings.TrimLeft(p, "/")
+		}
+
+		desired = append(desired, k.quota(e.Name, data))
+		declaredDefault = declaredDefault || e.Name == defaultQuota
+	}
+
+	identified = make([]endpoint.Entry, 0, len(existing))
+	for _, e := range existing {
+		name := path.Base(e.Path)
+		identified = append(identified, k.quota(name, e.Data))
+		if name == defaultQuota && k.defaults != nil && !declaredDefault {
+			desired = append(desired, k.quota(defaultQuota, k.defaults))
+		}
+	}
+
+	return desired, identified
+}
+
+// quota returns the entry of a quota, identified by its name and the path it
+// applies to, e.g. "sys/quotas/rate-limit/login@auth/approle/login". The path
+// is part of the identity rather than compared.
+func (k quotaKind) quota(name string, data map[string]interface{}) endpoint.Entry {
+	id := path.Join(k.dir, name)
+	if p, ok := data["path"]; ok && p != nil {
+		if scope := strings.Trim(fmt.Sprintf("%v", p), "/"); scope != "" {
+			id += "@" + scope
+		}
+	}
+
+	compared := make([]string, 0, len(data))
+	for key := range data {
+		if key != "path" {
+			compared = append(compared, key)
+		}
+	}
+	sort.Strings(compared)
+
+	return endpoint.Entry{Path: path.Join(k.dir, name), ID: id, Data: data, Compared: compared}
+}
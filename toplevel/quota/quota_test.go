@@ -0,0 +1,153 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+var rateLimit = quotaKind{name: "vault_rate_limit_quotas", dir: "sys/quotas/rate-limit"}
+
+func keys(items []vault.Item) []string {
+	k := make([]string, 0, len(items))
+	for _, i := range items {
+		k = append(k, i.Key())
+	}
+	return k
+}
+
+func diff(kind quotaKind, entries []entry, existing []endpoint.Entry) (toBeWritten, toBeDeleted []string) {
+	desired, identified := kind.quotas(entries, existing)
+	desiredItems := make([]vault.Item, 0, len(desired))
+	for _, d := range desired {
+		desiredItems = append(desiredItems, d)
+	}
+	existingItems := make([]vault.Item, 0, len(identified))
+	for _, e := range identified {
+		existingItems = append(existingItems, e)
+	}
+	w, d := vault.DiffItems(desiredItems, existingItems)
+	return keys(w), keys(d)
+}
+
+func TestPathScopedAndGlobalQuotasAreIdentifiedByTheirPath(t *testing.T) {
+	existing := []endpoint.Entry{
+		{Path: "sys/quotas/rate-limit/global", Data: map[string]interface{}{"path": "", "rate": 1000}},
+		{Path: "sys/quotas/rate-limit/login", Data: map[string]interface{}{"path": "auth/approle/login/", "rate": 10}},
+	}
+
+	// The path is part of the identity, so it isn't compared.
+	w, d := diff(rateLimit, []entry{
+		{Name: "global", Options: map[string]interface{}{"rate": 1000}},
+		{Name: "login", Options: map[string]interface{}{"path": "auth/approle/login", "rate": 10}},
+	}, existing)
+	require.Empty(t, w)
+	require.Empty(t, d)
+
+	// Changing the path of a quota deletes it and creates it again.
+	w, d = diff(rateLimit, []entry{
+		{Name: "global", Options: map[string]interface{}{"rate": 1000}},
+		{Name: "login", Options: map[string]interface{}{"path": "auth/userpass/login", "rate": 10}},
+	}, existing)
+	require.Equal(t, []string{"sys/quotas/rate-limit/login@auth/userpass/login"}, w)
+	require.Equal(t, []string{"sys/quotas/rate-limit/login@auth/approle/login"}, d)
+
+	// Making a global quota path-scoped also replaces it.
+	w, d = diff(rateLimit, []entry{
+		{Name: "global", Options: map[string]interface{}{"path": "kv/", "rate": 1000}},
+		{Name: "login", Options: map[string]interface{}{"path": "auth/approle/login", "rate": 20}},
+	}, existing)
+	require.Equal(t, []string{"sys/quotas/rate-limit/global@kv", "sys/quotas/rate-limit/login@auth/approle/login"}, w)
+	require.Equal(t, []string{"sys/quotas/rate-limit/global"}, d)
+}
+
+func TestScopeNamespacePrefixesTheQuotaPath(t *testing.T) {
+	existing := []endpoint.Entry{
+		{Path: "sys/quotas/rate-limit/team", Data: map[string]interface{}{"path": "team-a/kv/", "rate": 10}},
+	}
+
+	w, d := diff(rateLimit, []entry{
+		{Name: "team", ScopeNamespace: "team-a", Options: map[string]interface{}{"path": "kv/", "rate": 10}},
+	}, existing)
+	require.Empty(t, w)
+	require.Empty(t, d)
+
+	w, d = diff(rateLimit, []entry{
+		{Name: "team", ScopeNamespace: "team-b", Options: map[string]interface{}{"path": "kv/", "rate": 10}},
+	}, existing)
+	require.Equal(t, []string{"sys/quotas/rate-limit/team@team-b/kv"}, w)
+	require.Equal(t, []string{"sys/quotas/rate-limit/team@team-a/kv"}, d)
+}
+
+func TestDefaultQuotaIsResetInsteadOfDeleted(t *testing.T) {
+	leaseCount := quotaKind{
+		name:     "vault_lease_count_quotas",
+		dir:      "sys/quotas/lease-count",
+		defaults: map[string]interface{}{"path": "", "max_leases": 300000},
+	}
+
+	w, d := diff(leaseCount, nil, []endpoint.Entry{
+		{Path: "sys/quotas/lease-count/default", Data: map[string]interface{}{"path": "", "max_leases": 1000}},
+	})
+	require.Equal(t, []string{"sys/quotas/lease-count/default"}, w)
+	require.Empty(t, d)
+
+	w, d = diff(leaseCount, nil, []endpoint.Entry{
+		{Path: "sys/quotas/lease-count/default", Data: map[string]interface{}{"path": "", "max_leases": 300000}},
+	})
+	require.Empty(t, w)
+	require.Empty(t, d)
+}
+
+func TestApplyScopesQuotasToNamespaces(t *testing.T) {
+	table := []struct {
+		description string
+		cfg         string
+		namespace   string
+		path        string
+	}{
+		{"quota of the root namespace scoped to a namespace", "- name: team\n  scope_namespace: team-a\n  options: {path: kv/, rate: 10}\n", "", "team-a/kv/"},
+		{"quota inside of a namespace", "- name: team\n  namespace: team-a\n  options: {path: kv/, rate: 10}\n", "team-a", "kv/"},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			var namespace, written string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut && r.Method != http.MethodPost {
+					w.WriteHeader(http.StatusNotFound)
+					fmt.Fprint(w, `{"errors": []}`)
+					return
+				}
+				require.Equal(t, "/v1/sys/quotas/rate-limit/team", r.URL.Path)
+				var body map[string]interface{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				namespace = r.Header.Get("X-Vault-Namespace")
+				written, _ = body["path"].(string)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			os.Setenv("VAULT_ADDR", server.URL)
+			os.Setenv("VAULT_AUTHTYPE", "token")
+			os.Setenv("VAULT_TOKEN", "root")
+			defer os.Unsetenv("VAULT_ADDR")
+			defer os.Unsetenv("VAULT_AUTHTYPE")
+			defer os.Unsetenv("VAULT_TOKEN")
+
+			require.NoError(t, toplevel.Apply(context.Background(), "vault_rate_limit_quotas", []byte(tt.cfg), false))
+			require.Equal(t, tt.namespace, namespace)
+			require.Equal(t, tt.path, written)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package rabbitmq implements the application of a declarative configuration
+// for Vault RabbitMQ secrets engines.
+package rabbitmq
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConfig lists the settings of the secrets engine that Vault never
+// returns.
+var sensitiveConfig = []string{"password"}
+
+// encodedSettings lists the settings of a role that Vault expects as JSON
+// strings, which may be declared as mappings of virtual hosts to permissions.
+var encodedSettings = []string{"vhosts", "vhost_topics"}
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	// Config holds the settings written to <path>/config/<name>, e.g. the
+	// connection and lease settings.
+	Config map[string]map[string]interface{} `yaml:"config"`
+	Roles  []role                            `yaml:"roles"`
+}
+
+type role struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_rabbitmq", config{})
+}
+
+// Validate checks the rabbitmq configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the settings and roles of RabbitMQ secrets engines are
+// configured exactly as provided.
+//
+// Roles of a declared secrets engine that are missing from the configuration
+// are deleted; secrets engines that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode rabbitmq configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		desiredSettings, existingSettings, err := endpoint.Settings(client, e.Path, e.Config, sensitiveConfig)
+		if err != nil {
+			return err
+		}
+		desired = append(desired, desiredSettings...)
+		existing = append(existing, existingSettings...)
+
+		for _, r := range e.Roles {
+			role, err := endpoint.EncodeJSON(endpoint.Entry{Path: path.Join(e.Path, "roles", r.Name), Data: r.Options}, encodedSettings...)
+			if err != nil {
+				return err
+			}
+			desired = append(desired, role)
+		}
+		existingRoles, err := endpoint.ReadAll(client, path.Join(e.Path, "roles"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingRoles...)
+	}
+
+	return endpoint.Apply(ctx, "vault_rabbitmq", desired, existing, dryRun)
+}
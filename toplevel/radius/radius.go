@@ -0,0 +1,97 @@
+// Package radius implements the application of a declarative configuration
+// for Vault RADIUS auth methods and their user policy mappings.
+package radius
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// sensitiveConfig lists the settings of the auth method that Vault never
+// returns.
+var sensitiveConfig = []string{"secret"}
+
+type entry struct {
+	Path   string                 `yaml:"_path" validate:"required"`
+	Config map[string]interface{} `yaml:"config"`
+	Users  []user                 `yaml:"users"`
+}
+
+type user struct {
+	Name     string   `yaml:"name" validate:"required"`
+	Policies []string `yaml:"policies"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_radius_auth", config{})
+}
+
+// Validate checks the radius auth configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the config and user policy mappings of RADIUS auth methods
+// are configured exactly as provided.
+//
+// Users of a declared auth method that are missing from the configuration
+// are deleted; auth methods that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode radius auth configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		mount := path.Join("auth", e.Path)
+
+		if e.Config != nil {
+			configPath := path.Join(mount, "config")
+			desired = append(desired, endpoint.Entry{Path: configPath, Data: e.Config, Sensitive: sensitiveConfig})
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingConfig, ok, err := endpoint.Read(client, configPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				existing = append(existing, existingConfig)
+			}
+		}
+
+		for _, u := range e.Users {
+			desired = append(desired, endpoint.Entry{
+				Path: path.Join(mount, "users", u.Name),
+				Data: map[string]interface{}{"policies": append([]string{}, u.Policies...)},
+			})
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingUsers, err := endpoint.ReadAll(client, path.Join(mount, "users"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingUsers...)
+	}
+
+	return endpoint.Apply(ctx, "vault_radius_auth", desired, existing, dryRun)
+}
@@ -0,0 +1,60 @@
+// Package raft implements the application of a declarative configuration
+// for the integrated storage of a Vault cluster.
+package raft
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// autopilotPath is where the autopilot settings of the cluster are managed.
+const autopilotPath = "sys/storage/raft/autopilot/configuration"
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_raft_autopilot", config{})
+}
+
+// Validate checks the raft autopilot configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var settings map[string]interface{}
+	return toplevel.ValidateEntries(entriesBytes, &settings)
+}
+
+// Apply ensures that the autopilot settings of a cluster using integrated
+// storage are configured as provided. They are declared as a single mapping,
+// e.g. cleanup_dead_servers, min_quorum and server_stabilization_time.
+//
+// Settings are only updated, as autopilot always has settings.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(entriesBytes, &settings); err != nil {
+		return errors.Wrap(err, "failed to decode raft autopilot configuration")
+	}
+
+	desired := []endpoint.Entry{{Path: autopilotPath, Data: settings}}
+	existing := make([]endpoint.Entry, 0, 1)
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	e, ok, err := endpoint.Read(client, autopilotPath)
+	if err != nil {
+		return err
+	}
+	if ok {
+		existing = append(existing, e)
+	}
+
+	return endpoint.Apply(ctx, "vault_raft_autopilot", desired, existing, dryRun)
+}
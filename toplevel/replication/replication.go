@@ -0,0 +1,142 @@
+// Package replication implements assertions on the replication state of a
+// Vault Enterprise cluster.
+package replication
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// statusPath is where the state of every type of replication is reported.
+const statusPath = "sys/replication/status"
+
+// replicationTypes lists the types of replication, whose state is reported in
+// the status under their name.
+var replicationTypes = []string{"dr", "performance"}
+
+// expected is the declared state of one type of replication.
+type expected struct {
+	// Mode is either primary, secondary or disabled.
+	Mode string `yaml:"mode"`
+	// PrimaryClusterAddr is the address secondaries reach the primary at.
+	PrimaryClusterAddr string `yaml:"primary_cluster_addr"`
+	// Enable has a cluster whose replication is disabled enabled as a
+	// primary, when Mode is primary.
+	Enable bool `yaml:"enable"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_replication", config{})
+}
+
+// Validate checks the replication configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var declared map[string]expected
+	return toplevel.ValidateEntries(entriesBytes, &declared)
+}
+
+// Apply reports how the replication state of the cluster differs from the
+// declared one, as a single mapping of the replication types (dr and
+// performance) to their expected state. The only change ever made is enabling
+// a primary, when requested.
+//
+// Other Vault instances are skipped with a warning.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var declared map[string]expected
+	if err := yaml.Unmarshal(entriesBytes, &declared); err != nil {
+		return errors.Wrap(err, "failed to decode replication configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return err
+	}
+	if !vault.IsEnterprise(version) {
+		logrus.WithField("version", version).Warn("skipping replication configuration on a Vault instance that isn't Enterprise")
+		return nil
+	}
+
+	status, _, err := endpoint.Read(client, statusPath)
+	if err != nil {
+		return err
+	}
+
+	actions := make([]vault.Action, 0)
+	for _, t := range replicationTypes {
+		e, ok := declared[t]
+		if !ok {
+			continue
+		}
+		state, _ := status.Data[t].(map[string]interface{})
+
+		if e.Enable && e.Mode == "primary" && fmt.Sprintf("%v", state["mode"]) == "disabled" {
+			t, enablePath := t, path.Join("sys/replication", t, "primary/enable")
+			actions = append(actions, vault.Action{
+				Name:       "enable primary",
+				Key:        t,
+				Data:       map[string]interface{}{"primary_cluster_addr": e.PrimaryClusterAddr},
+				Operations: []vault.Operation{vault.WriteOperation(enablePath, true)},
+				Perform:    func(client *api.Client) error { return e.enablePrimary(client, t, enablePath) },
+			})
+			continue
+		}
+
+		findings := make([]string, 0)
+		for _, d := range e.drift(state) {
+			logrus.WithField("replication", t).Warn(d)
+			findings = append(findings, t+": "+d)
+		}
+		vault.ReportFindings("vault_replication", findings)
+	}
+
+	return vault.Act(ctx, "vault_replication", "replication", actions, dryRun)
+}
+
+// drift describes how the reported state of a type of replication differs
+// from the expected one.
+func (e expected) drift(state map[string]interface{}) []string {
+	drift := make([]string, 0)
+	if mode := fmt.Sprintf("%v", state["mode"]); e.Mode != "" && mode != e.Mode {
+		drift = append(drift, fmt.Sprintf("replication mode is '%s' instead of '%s'", mode, e.Mode))
+	}
+	if addr, _ := state["primary_cluster_addr"].(string); e.PrimaryClusterAddr != "" && addr != e.PrimaryClusterAddr {
+		drift = append(drift, fmt.Sprintf("primary cluster address is '%s' instead of '%s'", addr, e.PrimaryClusterAddr))
+	}
+	return drift
+}
+
+func (e expected) enablePrimary(client *api.Client, name, p string) error {
+	data := make(map[string]interface{})
+	if e.PrimaryClusterAddr != "" {
+		data["primary_cluster_addr"] = e.PrimaryClusterAddr
+	}
+
+	event := toplevel.Event{Name: "vault_replication", Key: name, Operation: "enable"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(p, data); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to enable replication primary %s", name)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("replication", name).Info("successfully enabled replication primary")
+	return nil
+}
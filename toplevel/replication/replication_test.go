@@ -0,0 +1,15 @@
+package replication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriftOnlyReportsDeclaredState(t *testing.T) {
+	state := map[string]interface{}{"mode": "secondary", "primary_cluster_addr": "https://vault-a:8201"}
+
+	require.Empty(t, expected{Mode: "secondary"}.drift(state))
+	require.Empty(t, expected{PrimaryClusterAddr: "https://vault-a:8201"}.drift(state))
+	require.Len(t, expected{Mode: "primary", PrimaryClusterAddr: "https://vault-b:8201"}.drift(state), 2)
+}
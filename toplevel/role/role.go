@@ -3,9 +3,12 @@
 package role
 
 import (
+	"context"
 	"path/filepath"
+	"sort"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 
@@ -14,13 +17,13 @@ import (
 )
 
 type entry struct {
-	Name    string                 `yaml:"name"`
+	Name    string                 `yaml:"name" validate:"required"`
 	Type    string                 `yaml:"type"`
-	Mount   string                 `yaml:"mount"`
-	Options map[string]interface{} `yaml:"options"`
+	Mount   string                 `yaml:"mount" validate:"required"`
+	Options map[string]interface{} `yaml:"options,omitempty"`
 }
 
-var _ vault.Item = entry{}
+var _ vault.FieldDiffer = entry{}
 
 func (e entry) Key() string {
 	return e.Name
@@ -38,7 +41,28 @@ func (e entry) Equals(i interface{}) bool {
 		vault.OptionsEqual(e.Options, entry.Options)
 }
 
-func (e entry) Save(client *api.Client) {
+// Differences returns the names of the fields that differ from another entry.
+func (e entry) Differences(i interface{}) []string {
+	entry, ok := i.(entry)
+	if !ok {
+		return nil
+	}
+
+	var fields []string
+	if e.Type != entry.Type {
+		fields = append(fields, "type")
+	}
+	if e.Mount != entry.Mount {
+		fields = append(fields, "mount")
+	}
+	for _, k := range vault.OptionsDiff(e.Options, entry.Options) {
+		fields = append(fields, "options."+k)
+	}
+
+	return fields
+}
+
+func (e entry) Save(client *api.Client) error {
 	path := filepath.Join("auth", e.Mount, "role", e.Name)
 	options := make(map[string]interface{})
 	for k, v := range e.Options {
@@ -48,63 +72,155 @@ func (e entry) Save(client *api.Client) {
 		}
 		options[k] = v
 	}
+	event := toplevel.Event{Name: "vault_roles", Key: path, Operation: "write"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
 	_, err := client.Logical().Write(path, options)
 	if err != nil {
-		logrus.WithError(err).WithField("path", path).WithField("type", e.Type).Fatalf("failed to write role to Vault instance")
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to write %s role %s to Vault instance", e.Type, path)
 	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
 	logrus.WithField("path", path).WithField("type", e.Type).Info("successfully wrote role")
+	return nil
 }
 
-func (e entry) Delete(client *api.Client) {
+func (e entry) Delete(client *api.Client) error {
 	path := filepath.Join("auth", e.Mount, "role", e.Name)
+	event := toplevel.Event{Name: "vault_roles", Key: path, Operation: "delete"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
 	_, err := client.Logical().Delete(path)
 	if err != nil {
-		logrus.WithError(err).WithField("path", path).WithField("type", e.Type).Fatal("failed to delete role from Vault instance")
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to delete %s role %s from Vault instance", e.Type, path)
 	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
 	logrus.WithField("path", path).WithField("type", e.Type).Info("successfully deleted role from Vault instance")
+	return nil
 }
 
 type config struct{}
 
 var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+var _ toplevel.Exporter = config{}
 
 func init() {
 	toplevel.RegisterConfiguration("vault_roles", config{})
 }
 
+// Validate checks the role configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
 // Apply ensures that an instance of Vault's roles are configured exactly
 // as provided.
-//
-// This function exits the program if an error occurs.
-func (c config) Apply(entriesBytes []byte, dryRun bool) {
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
 	var entries []entry
 	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
-		logrus.WithError(err).Fatal("failed to decode role configuration")
+		return errors.Wrap(err, "failed to decode role configuration")
 	}
 
-	existingAuthBackends, err := vault.ClientFromEnv().Sys().ListAuth()
+	existingRoles, err := existingEntries(ctx)
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to list authentication backends from Vault instance")
+		return err
 	}
 
-	existingRoles := make([]entry, 0)
+	// Diff the local configuration with the Vault instance.
+	entriesToBeWritten, entriesToBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:       "vault_roles",
+		Package:    "role",
+		Desired:    asItems(entries),
+		Existing:   asItems(existingRoles),
+		Operations: operations,
+	}, dryRun)
+	if err != nil {
+		return err
+	}
+
+	// Write any missing App Roles to the Vault instance.
+	if err := vault.ForEach(entriesToBeWritten, func(e vault.Item) error {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		return e.(entry).Save(client)
+	}); err != nil {
+		return err
+	}
+
+	// Delete any App Roles from the Vault instance.
+	if err := vault.ForEach(entriesToBeDeleted, func(e vault.Item) error {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		return e.(entry).Delete(client)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
 
+// Export returns the roles of the authentication backends enabled on an
+// instance of Vault, with their durations formatted as declared.
+func (c config) Export(ctx context.Context) (interface{}, error) {
+	existingRoles, err := existingEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range existingRoles {
+		existingRoles[i].Options = vault.FormatDurations(existingRoles[i].Options)
+	}
+
+	sort.Slice(existingRoles, func(i, j int) bool {
+		if existingRoles[i].Mount != existingRoles[j].Mount {
+			return existingRoles[i].Mount < existingRoles[j].Mount
+		}
+		return existingRoles[i].Name < existingRoles[j].Name
+	})
+	return existingRoles, nil
+}
+
+// existingEntries lists the roles of the authentication backends enabled on an
+// instance of Vault.
+func existingEntries(ctx context.Context) ([]entry, error) {
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existingAuthBackends, err := client.Sys().ListAuth()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list authentication backends from Vault instance")
+	}
+
+	existingRoles := make([]entry, 0)
 	if existingAuthBackends != nil {
 		for authBackend := range existingAuthBackends {
 			// Get the secret with the existing App Roles.
 			path := filepath.Join("auth", authBackend, "role")
-			secret, err := vault.ClientFromEnv().Logical().List(path)
+			client, err := vault.ClientFromEnv(ctx)
 			if err != nil {
-				logrus.WithError(err).Fatal("failed to list roles from Vault instance")
+				return nil, err
+			}
+			secret, err := client.Logical().List(path)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to list roles from Vault instance")
 			}
 
 			if secret != nil {
 				// Build a list of all the existing entries.
 				for _, roleName := range secret.Data["keys"].([]interface{}) {
 					path := filepath.Join("auth", authBackend, "role", roleName.(string))
-					roleSecret, err := vault.ClientFromEnv().Logical().Read(path)
+					client, err := vault.ClientFromEnv(ctx)
+					if err != nil {
+						return nil, err
+					}
+					roleSecret, err := client.Logical().Read(path)
 					if err != nil {
-						logrus.WithError(err).WithField("path", path).WithField("type", existingAuthBackends[authBackend].Type).Fatal("failed to read role secret")
+						return nil, errors.Wrapf(err, "failed to read %s role secret %s", existingAuthBackends[authBackend].Type, path)
 					}
 
 					existingRoles = append(existingRoles, entry{
@@ -117,28 +233,16 @@ func (c config) Apply(entriesBytes []byte, dryRun bool) {
 			}
 		}
 	}
+	return existingRoles, nil
+}
 
-	// Diff the local configuration with the Vault instance.
-	entriesToBeWritten, entriesToBeDeleted := vault.DiffItems(asItems(entries), asItems(existingRoles))
-
-	if dryRun == true {
-		for _, w := range entriesToBeWritten {
-			logrus.Infof("[Dry Run]\tpackage=role\tentry to be written='%v'", w)
-		}
-		for _, d := range entriesToBeDeleted {
-			logrus.Infof("[Dry Run]\tpackage=role\tentry to be deleted='%v'", d)
-		}
-	} else {
-		// Write any missing App Roles to the Vault instance.
-		for _, e := range entriesToBeWritten {
-			e.(entry).Save(vault.ClientFromEnv())
-		}
-
-		// Delete any App Roles from the Vault instance.
-		for _, e := range entriesToBeDeleted {
-			e.(entry).Delete(vault.ClientFromEnv())
-		}
+// operations lists the requests made to Vault to write, or delete, a role.
+func operations(e vault.Item, delete bool) []vault.Operation {
+	ent := e.(entry)
+	if delete {
+		return []vault.Operation{vault.DeleteOperation(filepath.Join("auth", ent.Mount, "role", ent.Name), false)}
 	}
+	return []vault.Operation{vault.WriteOperation(filepath.Join("auth", ent.Mount, "role", ent.Name), false)}
 }
 
 func asItems(xs []entry) (items []vault.Item) {
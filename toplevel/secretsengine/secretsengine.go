@@ -5,9 +5,14 @@
 package secretsengine
 
 import (
+	"context"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 
@@ -16,13 +21,85 @@ import (
 )
 
 type entry struct {
-	Path        string            `yaml:"_path"`
-	Type        string            `yaml:"type"`
-	Description string            `yaml:"description"`
-	Options     map[string]string `yaml:"options"`
+	Path                  string            `yaml:"_path" validate:"required"`
+	Type                  string            `yaml:"type" validate:"required"`
+	Description           string            `yaml:"description,omitempty"`
+	Options               map[string]string `yaml:"options,omitempty"`
+	SealWrap              bool              `yaml:"seal_wrap,omitempty"`
+	ExternalEntropyAccess bool              `yaml:"external_entropy_access,omitempty"`
+	Config                mountConfig       `yaml:"config,omitempty"`
 }
 
-var _ vault.Item = entry{}
+// mountConfig holds the settings of a mount that can be tuned after it has
+// been enabled.
+type mountConfig struct {
+	DefaultLeaseTTL         string   `yaml:"default_lease_ttl,omitempty"`
+	MaxLeaseTTL             string   `yaml:"max_lease_ttl,omitempty"`
+	AuditNonHMACRequestKeys []string `yaml:"audit_non_hmac_request_keys,omitempty"`
+	ListingVisibility       string   `yaml:"listing_visibility,omitempty"`
+}
+
+// hiddenListing is the default listing visibility of a mount, reported by
+// Vault as an empty string.
+const hiddenListing = "hidden"
+
+// listingVisibility returns the listing visibility, which is hidden unless
+// set.
+func (c mountConfig) listingVisibility() string {
+	if c.ListingVisibility == "" {
+		return hiddenListing
+	}
+	return c.ListingVisibility
+}
+
+// ambiguousOptions returns the settings that have been set, along with the
+// listing visibility which is hidden unless set, so that they can be compared
+// with vault.OptionsDiff.
+func (c mountConfig) ambiguousOptions() map[string]interface{} {
+	opts := make(map[string]interface{})
+	if c.DefaultLeaseTTL != "" && c.DefaultLeaseTTL != "0" {
+		opts["default_lease_ttl"] = c.DefaultLeaseTTL
+	}
+	if c.MaxLeaseTTL != "" && c.MaxLeaseTTL != "0" {
+		opts["max_lease_ttl"] = c.MaxLeaseTTL
+	}
+	if len(c.AuditNonHMACRequestKeys) > 0 {
+		keys := append([]string{}, c.AuditNonHMACRequestKeys...)
+		sort.Strings(keys)
+		opts["audit_non_hmac_request_keys"] = keys
+	}
+	opts["listing_visibility"] = c.listingVisibility()
+	return opts
+}
+
+// input returns the configuration as accepted by Vault, resetting the lease
+// TTLs and the listing visibility that aren't set to their defaults.
+func (c mountConfig) input() api.MountConfigInput {
+	input := api.MountConfigInput{
+		DefaultLeaseTTL:         c.DefaultLeaseTTL,
+		MaxLeaseTTL:             c.MaxLeaseTTL,
+		AuditNonHMACRequestKeys: c.AuditNonHMACRequestKeys,
+		ListingVisibility:       c.listingVisibility(),
+	}
+	if input.DefaultLeaseTTL == "" {
+		input.DefaultLeaseTTL = "system"
+	}
+	if input.MaxLeaseTTL == "" {
+		input.MaxLeaseTTL = "system"
+	}
+	return input
+}
+
+func configFromOutput(out api.MountConfigOutput) mountConfig {
+	return mountConfig{
+		DefaultLeaseTTL:         strconv.Itoa(out.DefaultLeaseTTL),
+		MaxLeaseTTL:             strconv.Itoa(out.MaxLeaseTTL),
+		AuditNonHMACRequestKeys: out.AuditNonHMACRequestKeys,
+		ListingVisibility:       out.ListingVisibility,
+	}
+}
+
+var _ vault.FieldDiffer = entry{}
 
 func (e entry) Key() string {
 	return e.Path
@@ -34,10 +111,51 @@ func (e entry) Equals(i interface{}) bool {
 		return false
 	}
 
+	// a policy that can't be read is reported by Apply before comparing entries
+	policy, _ := vault.FieldPolicyFor("vault_secret_engines")
 	return vault.EqualPathNames(e.Path, entry.Path) &&
-		e.Type == entry.Type &&
-		e.Description == entry.Description &&
-		vault.OptionsEqual(e.ambiguousOptions(), entry.ambiguousOptions())
+		!policy.Significant(e.Differences(entry))
+}
+
+// Differences returns the names of the fields that differ from another entry.
+func (e entry) Differences(i interface{}) []string {
+	entry, ok := i.(entry)
+	if !ok {
+		return nil
+	}
+
+	var fields []string
+	if e.Type != entry.Type {
+		fields = append(fields, "type")
+	}
+	if e.Description != entry.Description {
+		fields = append(fields, "description")
+	}
+	if e.SealWrap != entry.SealWrap {
+		fields = append(fields, "seal_wrap")
+	}
+	if e.ExternalEntropyAccess != entry.ExternalEntropyAccess {
+		fields = append(fields, "external_entropy_access")
+	}
+	for _, k := range vault.OptionsDiff(e.ambiguousOptions(), entry.ambiguousOptions()) {
+		fields = append(fields, "options."+k)
+	}
+	for _, k := range vault.OptionsDiff(e.Config.ambiguousOptions(), entry.Config.ambiguousOptions()) {
+		fields = append(fields, "config."+k)
+	}
+
+	return fields
+}
+
+// requiresRemount reports whether reaching the configured state of an already
+// enabled mount requires it to be disabled and enabled again, which destroys
+// all of its data.
+//
+// Any other difference is reconciled by tuning the mount.
+func (e entry) requiresRemount(existing entry) bool {
+	return e.Type != existing.Type ||
+		e.SealWrap != existing.SealWrap ||
+		e.ExternalEntropyAccess != existing.ExternalEntropyAccess
 }
 
 func (e entry) ambiguousOptions() map[string]interface{} {
@@ -48,86 +166,322 @@ func (e entry) ambiguousOptions() map[string]interface{} {
 	return opts
 }
 
-func (e entry) enable(client *api.Client) {
-	if err := client.Sys().Mount(e.Path, &api.MountInput{
-		Type:        e.Type,
-		Description: e.Description,
-		Options:     e.Options,
-	}); err != nil {
-		logrus.WithError(err).WithField("path", e.Path).Fatal("failed to enable mount")
+func (e entry) enable(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_secret_engines", Key: e.Path, Operation: "enable"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+
+	// The vendored API client predates external_entropy_access, so mounts
+	// using it are enabled through a raw write.
+	var err error
+	if e.ExternalEntropyAccess {
+		_, err = client.Logical().Write(path.Join("sys/mounts", e.Path), map[string]interface{}{
+			"type":                    e.Type,
+			"description":             e.Description,
+			"options":                 e.Options,
+			"seal_wrap":               e.SealWrap,
+			"external_entropy_access": e.ExternalEntropyAccess,
+			"config":                  e.Config.input(),
+		})
+	} else {
+		err = client.Sys().Mount(e.Path, &api.MountInput{
+			Type:        e.Type,
+			Description: e.Description,
+			Options:     e.Options,
+			SealWrap:    e.SealWrap,
+			Config:      e.Config.input(),
+		})
+	}
+	if err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to enable mount %s", e.Path)
 	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
 	logrus.WithField("path", e.Path).Info("successfully enabled mount")
+	return nil
+}
+
+func (e entry) tune(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_secret_engines", Key: e.Path, Operation: "tune"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+
+	input := e.Config.input()
+	input.Description = &e.Description
+	input.Options = e.Options
+	if err := client.Sys().TuneMount(e.Path, input); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to tune mount %s", e.Path)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", e.Path).Info("successfully tuned mount")
+	return nil
 }
 
-func (e entry) disable(client *api.Client) {
+func (e entry) disable(client *api.Client) error {
+	event := toplevel.Event{Name: "vault_secret_engines", Key: e.Path, Operation: "disable"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
 	if err := client.Sys().Unmount(e.Path); err != nil {
-		logrus.WithError(err).WithField("path", e.Path).Fatal("failed to disable mount")
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to disable mount %s", e.Path)
 	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
 	logrus.WithField("path", e.Path).Info("successfully disabled mount")
+	return nil
 }
 
 type config struct{}
 
 var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+var _ toplevel.Exporter = config{}
 
 func init() {
 	toplevel.RegisterConfiguration("vault_secret_engines", config{})
 }
 
+// Validate checks the secrets engines configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
 // Apply ensures that an instance of Vault's secrets engine are configured
 // exactly as provided.
-//
-// This function exits the program if an error occurs.
-func (c config) Apply(entriesBytes []byte, dryRun bool) {
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
 	// Unmarshal the list of configured secrets engines.
 	var entries []entry
 	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
-		logrus.WithError(err).Fatal("failed to decode secrets engines configuration")
+		return errors.Wrap(err, "failed to decode secrets engines configuration")
+	}
+
+	// Drop the mount options that the Vault instance does not support, because
+	// they would be ignored and never show up as enabled.
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
 	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return err
+	}
+	entries = supportedEntries(entries, version)
 
+	existingSecretsEngines, err := existingEntries(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	toBeWritten, toBeDeleted, err := vault.Reconcile(ctx, vault.Changes{
+		Name:     "vault_secret_engines",
+		Package:  "secrets-engine",
+		Desired:  asItems(entries),
+		Existing: asItems(existingSecretsEngines),
+		Operations: func(e vault.Item, delete bool) []vault.Operation {
+			return operations(e, delete, existingSecretsEngines)
+		},
+		Skip: func(e vault.Item, delete bool) bool {
+			if delete {
+				// the default mounts are never disabled
+				return isDefaultMount(e.Key())
+			}
+			// mounts that can only reach the configured state by being
+			// remounted are never touched automatically
+			return requiresRemount(e.(entry), existingSecretsEngines)
+		},
+	}, dryRun)
+	if err != nil {
+		return err
+	}
+
+	// Already enabled mounts only drifting in their settings are tuned.
+	toBeEnabled, toBeTuned := splitTunes(toBeWritten, existingSecretsEngines)
+
+	for _, e := range toBeEnabled {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := e.(entry).enable(client); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range toBeTuned {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := e.(entry).tune(client); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range toBeDeleted {
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if err := e.(entry).disable(client); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Export returns the secrets engines enabled on an instance of Vault, except
+// for the default ones.
+func (c config) Export(ctx context.Context) (interface{}, error) {
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return nil, err
+	}
+	existingSecretsEngines, err := existingEntries(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	exported := make([]entry, 0, len(existingSecretsEngines))
+	for _, e := range existingSecretsEngines {
+		if isDefaultMount(e.Path) {
+			continue
+		}
+		// lease TTLs of 0 are the system defaults, which aren't declared
+		if e.Config.DefaultLeaseTTL == "0" {
+			e.Config.DefaultLeaseTTL = ""
+		}
+		if e.Config.MaxLeaseTTL == "0" {
+			e.Config.MaxLeaseTTL = ""
+		}
+		exported = append(exported, e)
+	}
+	sort.Slice(exported, func(i, j int) bool { return exported[i].Path < exported[j].Path })
+	return exported, nil
+}
+
+// existingEntries lists the secrets engines enabled on an instance of Vault
+// of the provided version.
+func existingEntries(ctx context.Context, version string) ([]entry, error) {
 	// List the existing secrets engines.
-	existingMounts, err := vault.ClientFromEnv().Sys().ListMounts()
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existingMounts, err := client.Sys().ListMounts()
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to list Mounts from Vault instance")
+		return nil, errors.Wrap(err, "failed to list Mounts from Vault instance")
+	}
+
+	externalEntropyAccess := make(map[string]bool)
+	if vault.IsHSM(version) {
+		externalEntropyAccess, err = listExternalEntropyAccess(client)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Build a list of all the existing entries.
 	existingSecretsEngines := make([]entry, 0)
-	if existingSecretsEngines != nil {
-		for path, engine := range existingMounts {
-			existingSecretsEngines = append(existingSecretsEngines, entry{
-				Path:        path,
-				Type:        engine.Type,
-				Description: engine.Description,
-				Options:     engine.Options,
-			})
-		}
+	for path, engine := range existingMounts {
+		existingSecretsEngines = append(existingSecretsEngines, entry{
+			Path:                  path,
+			Type:                  engine.Type,
+			Description:           engine.Description,
+			Options:               engine.Options,
+			SealWrap:              engine.SealWrap,
+			ExternalEntropyAccess: externalEntropyAccess[path],
+			Config:                configFromOutput(engine.Config),
+		})
 	}
+	return existingSecretsEngines, nil
+}
 
-	toBeWritten, toBeDeleted := vault.DiffItems(asItems(entries), asItems(existingSecretsEngines))
+// supportedEntries returns the provided entries without the seal_wrap and
+// external_entropy_access options when the Vault instance does not support
+// them.
+func supportedEntries(entries []entry, version string) []entry {
+	enterprise, hsm := vault.IsEnterprise(version), vault.IsHSM(version)
 
-	if dryRun == true {
-		for _, w := range toBeWritten {
-			logrus.Infof("[Dry Run]\tpackage=secrets-engine\tentry to be written='%v'", w)
+	supported := make([]entry, 0, len(entries))
+	for _, e := range entries {
+		if e.SealWrap && !enterprise {
+			logrus.WithField("path", e.Path).Warn("seal_wrap requires Vault Enterprise; skipping option")
+			e.SealWrap = false
 		}
-		for _, d := range toBeDeleted {
-			if !isDefaultMount(d.Key()) {
-				logrus.Infof("[Dry Run]\tpackage=secrets-engine\tentry to be deleted='%v'", d)
-			}
+		if e.ExternalEntropyAccess && !hsm {
+			logrus.WithField("path", e.Path).Warn("external_entropy_access requires Vault Enterprise with HSM support; skipping option")
+			e.ExternalEntropyAccess = false
 		}
-	} else {
-		// TODO(riuvshin): implement tuning
-		for _, e := range toBeWritten {
-			e.(entry).enable(vault.ClientFromEnv())
+		supported = append(supported, e)
+	}
+
+	return supported
+}
+
+// listExternalEntropyAccess returns whether each existing mount has external
+// entropy access enabled, which ListMounts doesn't expose.
+func listExternalEntropyAccess(client *api.Client) (map[string]bool, error) {
+	secret, err := client.Logical().Read("sys/mounts")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list Mounts from Vault instance")
+	}
+
+	access := make(map[string]bool)
+	if secret == nil {
+		return access, nil
+	}
+	for mountPath, v := range secret.Data {
+		if mount, ok := v.(map[string]interface{}); ok {
+			enabled, _ := mount["external_entropy_access"].(bool)
+			access[mountPath] = enabled
 		}
+	}
 
-		for _, e := range toBeDeleted {
-			ent := e.(entry)
-			if !isDefaultMount(ent.Path) {
-				ent.disable(vault.ClientFromEnv())
-			}
+	return access, nil
+}
+
+// requiresRemount reports whether an existing mount can only reach its
+// configured state by being remounted, warning about it.
+func requiresRemount(ent entry, existing []entry) bool {
+	ex, ok := findEntry(existing, ent.Path)
+	if !ok || !ent.requiresRemount(ex) {
+		return false
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"path":                    ent.Path,
+		"seal_wrap":               ent.SealWrap,
+		"external_entropy_access": ent.ExternalEntropyAccess,
+	}).Warn("changing seal_wrap or external_entropy_access requires a destructive remount; remount the secrets engine manually")
+	vault.MarkDrift()
+	return true
+}
+
+// splitTunes separates the entries that must be enabled from the ones that are
+// already enabled and only need to be tuned.
+func splitTunes(toBeWritten []vault.Item, existing []entry) (toBeEnabled, toBeTuned []vault.Item) {
+	toBeEnabled = make([]vault.Item, 0)
+	toBeTuned = make([]vault.Item, 0)
+	for _, e := range toBeWritten {
+		if _, ok := findEntry(existing, e.Key()); ok {
+			toBeTuned = append(toBeTuned, e)
+		} else {
+			toBeEnabled = append(toBeEnabled, e)
 		}
 	}
+	return
+}
+
+func findEntry(entries []entry, path string) (entry, bool) {
+	for _, e := range entries {
+		if vault.EqualPathNames(e.Path, path) {
+			return e, true
+		}
+	}
+	return entry{}, false
 }
 
 func isDefaultMount(path string) bool {
@@ -142,6 +496,19 @@ func isDefaultMount(path string) bool {
 	}
 }
 
+// operations lists the requests made to Vault to enable, tune, or disable, a
+// mount.
+func operations(e vault.Item, delete bool, existing []entry) []vault.Operation {
+	switch _, ok := findEntry(existing, e.Key()); {
+	case delete:
+		return []vault.Operation{vault.DeleteOperation(path.Join("sys/mounts", e.Key()), false)}
+	case ok:
+		return []vault.Operation{vault.WriteOperation(path.Join("sys/mounts", e.Key(), "tune"), false)}
+	default:
+		return []vault.Operation{vault.WriteOperation(path.Join("sys/mounts", e.Key()), false)}
+	}
+}
+
 func asItems(xs []entry) (items []vault.Item) {
 	items = make([]vault.Item, 0)
 	for _, x := range xs {
@@ -0,0 +1,152 @@
+// Package ssh implements the application of a declarative configuration
+// for Vault SSH secrets engines.
+package ssh
+
+import (
+	"context"
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+type entry struct {
+	Path  string `yaml:"_path" validate:"required"`
+	CA    *ca    `yaml:"ca"`
+	Roles []role `yaml:"roles"`
+}
+
+// ca configures the key signing the client certificates, which is either
+// generated by Vault or imported.
+type ca struct {
+	PrivateKey string `yaml:"private_key"`
+	PublicKey  string `yaml:"public_key"`
+}
+
+type role struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_ssh", config{})
+}
+
+// Validate checks the ssh configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that SSH secrets engines are configured as provided.
+//
+// The CA is only configured by secrets engines that don't have one yet, so an
+// existing signing key is never replaced. Roles of a declared secrets engine
+// that are missing from the configuration are deleted.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode ssh configuration")
+	}
+
+	// Check which secrets engines need a CA.
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	toBeConfigured := make([]entry, 0)
+	for _, e := range entries {
+		if e.CA == nil {
+			continue
+		}
+		if hasCA(client, e.Path) {
+			logrus.WithField("path", e.Path).Debug("skipping ssh secrets engine with an existing CA")
+			continue
+		}
+		toBeConfigured = append(toBeConfigured, e)
+	}
+
+	// The keys of the CA are never planned.
+	actions := make([]vault.Action, 0, len(toBeConfigured))
+	for _, e := range toBeConfigured {
+		actions = append(actions, vault.Action{
+			Name:       "configure CA",
+			Key:        e.Path,
+			Operations: []vault.Operation{vault.WriteOperation(path.Join(e.Path, "config/ca"), false)},
+			Perform:    e.configureCA,
+		})
+	}
+	if err := vault.Act(ctx, "vault_ssh", "ssh", actions, dryRun); err != nil {
+		return err
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		for _, r := range e.Roles {
+			desired = append(desired, endpoint.Entry{Path: path.Join(e.Path, "roles", r.Name), Data: r.Options})
+		}
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingRoles, err := endpoint.ReadAll(client, path.Join(e.Path, "roles"))
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingRoles...)
+	}
+
+	return endpoint.Apply(ctx, "vault_ssh", desired, existing, dryRun)
+}
+
+// hasCA reports whether an SSH secrets engine already has a signing key.
+func hasCA(client *api.Client, mount string) bool {
+	secret, err := client.Logical().Read(path.Join(mount, "config/ca"))
+	if err != nil {
+		// Vault reports a missing signing key as an error.
+		logrus.WithError(err).WithField("path", mount).Debug("failed to read CA public key")
+		return false
+	}
+	if secret == nil || secret.Data == nil {
+		return false
+	}
+
+	publicKey, _ := secret.Data["public_key"].(string)
+	return publicKey != ""
+}
+
+func (e entry) configureCA(client *api.Client) error {
+	data := map[string]interface{}{"generate_signing_key": true}
+	if e.CA.PrivateKey != "" {
+		data = map[string]interface{}{
+			"private_key": e.CA.PrivateKey,
+			"public_key":  e.CA.PublicKey,
+		}
+	}
+
+	event := toplevel.Event{Name: "vault_ssh", Key: e.Path, Operation: "configure"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	_, err := endpoint.ResolveReferences(data)
+	if err == nil {
+		_, err = client.Logical().Write(path.Join(e.Path, "config/ca"), data)
+	}
+	if err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to configure CA %s", e.Path)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", e.Path).Info("successfully configured CA")
+	return nil
+}
@@ -0,0 +1,82 @@
+package sysconfig
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// auditedHeadersPath is where the request headers recorded by audit devices
+// are managed.
+const auditedHeadersPath = "sys/config/auditing/request-headers"
+
+type auditedHeader struct {
+	Name string `yaml:"name" validate:"required"`
+	// HMAC is true if the values of the header are hashed in audit logs.
+	HMAC bool `yaml:"hmac"`
+}
+
+type auditedHeadersConfig struct{}
+
+var _ toplevel.Configuration = auditedHeadersConfig{}
+var _ toplevel.Validator = auditedHeadersConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_audited_request_headers", auditedHeadersConfig{})
+}
+
+// Validate checks the audited request headers configuration without contacting Vault.
+func (c auditedHeadersConfig) Validate(entriesBytes []byte) error {
+	var headers []auditedHeader
+	return toplevel.ValidateEntries(entriesBytes, &headers)
+}
+
+// Apply ensures that the request headers recorded by audit devices are
+// configured exactly as provided.
+func (c auditedHeadersConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var headers []auditedHeader
+	if err := yaml.Unmarshal(entriesBytes, &headers); err != nil {
+		return errors.Wrap(err, "failed to decode audited request headers configuration")
+	}
+
+	// Vault stores the names of headers in lower case.
+	desired := make([]endpoint.Entry, 0, len(headers))
+	for _, h := range headers {
+		desired = append(desired, endpoint.Entry{
+			Path: path.Join(auditedHeadersPath, strings.ToLower(h.Name)),
+			Data: map[string]interface{}{"hmac": h.HMAC},
+			Sudo: true,
+		})
+	}
+
+	// Audited headers are all returned at once rather than listed.
+	existing := make([]endpoint.Entry, 0)
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	e, ok, err := endpoint.Read(client, auditedHeadersPath)
+	if err != nil {
+		return err
+	}
+	if ok {
+		returned, _ := e.Data["headers"].(map[string]interface{})
+		for name, settings := range returned {
+			data, _ := settings.(map[string]interface{})
+			existing = append(existing, endpoint.Entry{
+				Path: path.Join(auditedHeadersPath, strings.ToLower(name)),
+				Data: data,
+				Sudo: true,
+			})
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_audited_request_headers", desired, existing, dryRun)
+}
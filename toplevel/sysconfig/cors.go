@@ -0,0 +1,127 @@
+// Package sysconfig implements the application of a declarative configuration
+// for the settings of a Vault instance under sys/config.
+package sysconfig
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// corsPath is where the CORS settings of the Vault instance are managed.
+const corsPath = "sys/config/cors"
+
+// stdAllowedHeaders lists the canonical names of the headers that Vault always
+// allows and returns along with the declared ones.
+var stdAllowedHeaders = []string{
+	"Content-Type",
+	"X-Requested-With",
+	"X-Vault-Aws-Iam-Server-Id",
+	"X-Vault-Mfa",
+	"X-Vault-No-Request-Forwarding",
+	"X-Vault-Wrap-Format",
+	"X-Vault-Wrap-Ttl",
+	"X-Vault-Policy-Override",
+	"Authorization",
+	"X-Vault-Token",
+}
+
+// cors is declared as a single mapping rather than a list of entries.
+type cors struct {
+	Enabled        bool     `yaml:"enabled"`
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+}
+
+type corsConfig struct{}
+
+var _ toplevel.Configuration = corsConfig{}
+var _ toplevel.Validator = corsConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_cors", corsConfig{})
+}
+
+// Validate checks the cors configuration without contacting Vault.
+func (c corsConfig) Validate(entriesBytes []byte) error {
+	var declared cors
+	return toplevel.ValidateEntries(entriesBytes, &declared)
+}
+
+// Apply ensures that the CORS settings of the Vault instance are configured
+// as provided. Vault disables CORS when its settings are deleted.
+func (c corsConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var declared cors
+	if err := yaml.Unmarshal(entriesBytes, &declared); err != nil {
+		return errors.Wrap(err, "failed to decode cors configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0, 1)
+	if declared.Enabled {
+		data := map[string]interface{}{"allowed_origins": append([]string{}, declared.AllowedOrigins...)}
+		if declared.AllowedHeaders != nil {
+			data["allowed_headers"] = customHeaders(declared.AllowedHeaders)
+		}
+		desired = append(desired, endpoint.Entry{Path: corsPath, Data: data, Sudo: true})
+	}
+
+	existing := make([]endpoint.Entry, 0, 1)
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	e, ok, err := endpoint.Read(client, corsPath)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if enabled, _ := e.Data["enabled"].(bool); enabled {
+			headers, _ := e.Data["allowed_headers"].([]interface{})
+			e.Data["allowed_headers"] = customHeaders(headers)
+			e.Sudo = true
+			existing = append(existing, e)
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_cors", desired, existing, dryRun)
+}
+
+// customHeaders returns the canonical names of the headers that Vault doesn't
+// allow by default.
+func customHeaders(headers interface{}) []string {
+	names := make([]string, 0)
+	switch headers := headers.(type) {
+	case []string:
+		names = append(names, headers...)
+	case []interface{}:
+		for _, h := range headers {
+			if s, ok := h.(string); ok {
+				names = append(names, s)
+			}
+		}
+	}
+
+	custom := make([]string, 0, len(names))
+	for _, h := range names {
+		h = http.CanonicalHeaderKey(h)
+		if !isStdAllowedHeader(h) {
+			custom = append(custom, h)
+		}
+	}
+	return custom
+}
+
+func isStdAllowedHeader(name string) bool {
+	for _, h := range stdAllowedHeaders {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
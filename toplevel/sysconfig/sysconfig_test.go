@@ -0,0 +1,15 @@
+package sysconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomHeadersLeaveOutTheHeadersAllowedByDefault(t *testing.T) {
+	returned := []interface{}{"Content-Type", "X-Requested-With", "X-Vault-Token", "X-Custom-Header"}
+	require.Equal(t, []string{"X-Custom-Header"}, customHeaders(returned))
+
+	declared := []string{"x-custom-header", "authorization"}
+	require.Equal(t, []string{"X-Custom-Header"}, customHeaders(declared))
+}
@@ -0,0 +1,139 @@
+package sysconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+const (
+	// uiHeadersPath is where the headers returned by the UI are managed.
+	uiHeadersPath = "sys/config/ui/headers"
+	// customMessagesPath is where the messages displayed by the UI are
+	// managed.
+	customMessagesPath = "sys/config/ui/custom-messages"
+)
+
+type uiHeader struct {
+	Name   string   `yaml:"name" validate:"required"`
+	Values []string `yaml:"values"`
+}
+
+// customMessage is a banner or modal displayed by the UI, identified by its
+// title as Vault assigns the IDs of messages.
+type customMessage struct {
+	Title string `yaml:"title"`
+	// Message is declared in plain text and written base64 encoded.
+	Message string `yaml:"message"`
+	// Options are the other settings of the message, e.g. type,
+	// authenticated, start_time and end_time.
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type uiHeadersConfig struct{}
+
+var _ toplevel.Configuration = uiHeadersConfig{}
+var _ toplevel.Validator = uiHeadersConfig{}
+
+type customMessagesConfig struct{}
+
+var _ toplevel.Configuration = customMessagesConfig{}
+var _ toplevel.Validator = customMessagesConfig{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_ui_headers", uiHeadersConfig{})
+	toplevel.RegisterConfiguration("vault_ui_custom_messages", customMessagesConfig{})
+}
+
+// Validate checks the ui headers configuration without contacting Vault.
+func (c uiHeadersConfig) Validate(entriesBytes []byte) error {
+	var headers []uiHeader
+	return toplevel.ValidateEntries(entriesBytes, &headers)
+}
+
+// Apply ensures that the headers returned by the UI are configured exactly as
+// provided.
+func (c uiHeadersConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var headers []uiHeader
+	if err := yaml.Unmarshal(entriesBytes, &headers); err != nil {
+		return errors.Wrap(err, "failed to decode ui headers configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0, len(headers))
+	for _, h := range headers {
+		desired = append(desired, endpoint.Entry{
+			Path: path.Join(uiHeadersPath, h.Name),
+			Data: map[string]interface{}{"values": append([]string{}, h.Values...)},
+			Sudo: true,
+		})
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := endpoint.ReadAll(client, uiHeadersPath)
+	if err != nil {
+		return err
+	}
+	for i := range existing {
+		existing[i].Sudo = true
+	}
+
+	return endpoint.Apply(ctx, "vault_ui_headers", desired, existing, dryRun)
+}
+
+// Validate checks the ui custom messages configuration without contacting Vault.
+func (c customMessagesConfig) Validate(entriesBytes []byte) error {
+	var messages []customMessage
+	return toplevel.ValidateEntries(entriesBytes, &messages)
+}
+
+// Apply ensures that the messages displayed by the UI are configured exactly
+// as provided.
+func (c customMessagesConfig) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var messages []customMessage
+	if err := yaml.Unmarshal(entriesBytes, &messages); err != nil {
+		return errors.Wrap(err, "failed to decode ui custom messages configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := endpoint.ReadAll(client, customMessagesPath)
+	if err != nil {
+		return err
+	}
+	paths := make(map[string]string, len(existing))
+	for _, e := range existing {
+		title, _ := e.Data["title"].(string)
+		paths[title] = e.Path
+	}
+
+	desired := make([]endpoint.Entry, 0, len(messages))
+	for _, m := range messages {
+		data := make(map[string]interface{}, len(m.Options)+2)
+		for k, v := range m.Options {
+			data[k] = v
+		}
+		data["title"] = m.Title
+		data["message"] = base64.StdEncoding.EncodeToString([]byte(m.Message))
+
+		// messages are created by writing to the directory of messages
+		p, ok := paths[m.Title]
+		if !ok {
+			p = customMessagesPath
+		}
+		desired = append(desired, endpoint.Entry{Path: p, Data: data})
+	}
+
+	return endpoint.Apply(ctx, "vault_ui_custom_messages", desired, existing, dryRun)
+}
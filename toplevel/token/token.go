@@ -0,0 +1,63 @@
+// Package token implements the application of a declarative configuration
+// for the roles of Vault's token auth method.
+package token
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// rolesPath is where token roles are managed.
+const rolesPath = "auth/token/roles"
+
+type entry struct {
+	Name string `yaml:"name" validate:"required"`
+	// Options are written to auth/token/roles/<name>, e.g. allowed_policies,
+	// orphan, period and token_type.
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_token_roles", config{})
+}
+
+// Validate checks the token roles configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the token roles are configured exactly as provided.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode token roles configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0, len(entries))
+	for _, e := range entries {
+		desired = append(desired, endpoint.Entry{Path: path.Join(rolesPath, e.Name), Data: e.Options})
+	}
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := endpoint.ReadAll(client, rolesPath)
+	if err != nil {
+		return err
+	}
+
+	return endpoint.Apply(ctx, "vault_token_roles", desired, existing, dryRun)
+}
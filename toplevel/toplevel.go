@@ -3,10 +3,26 @@
 package toplevel
 
 import (
+	"context"
+	"sort"
 	"strings"
 	"sync"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/tracing"
+	"github.com/app-sre/vault-manager/pkg/vault"
+)
+
+const (
+	// namespaceKey is the field of an entry holding the Vault Enterprise
+	// namespace it's applied in.
+	namespaceKey = "namespace"
+	// instanceKey is the field of an entry holding the Vault instance it's
+	// applied to.
+	instanceKey = "instance"
 )
 
 var (
@@ -17,9 +33,19 @@ var (
 // Configuration represents a block of declarative configuration data that can
 // be applied to a service.
 //
-// If an error occurs applying a configuration, the process should exit.
+// Apply returns the first error that occurs, leaving the changes made before
+// it in place. Vault requests are cancelled along with the provided context.
 type Configuration interface {
-	Apply([]byte, bool)
+	Apply(context.Context, []byte, bool) error
+}
+
+// Exporter is a Configuration able to read the configuration of an instance of
+// Vault back, in the form it's declared in.
+//
+// Export returns the entries of the top-level, omitting the ones that are
+// built into Vault.
+type Exporter interface {
+	Export(context.Context) (interface{}, error)
 }
 
 // RegisterConfiguration makes a Configuration available by the provided name.
@@ -47,14 +73,184 @@ func RegisterConfiguration(name string, c Configuration) {
 	configs[name] = c
 }
 
+// Registered returns true if a Configuration is registered by the provided
+// name.
+func Registered(name string) bool {
+	configsM.RLock()
+	defer configsM.RUnlock()
+
+	_, ok := configs[name]
+	return ok
+}
+
+// Exporters returns the sorted names of the registered Configurations that
+// are Exporters.
+func Exporters() []string {
+	configsM.RLock()
+	defer configsM.RUnlock()
+
+	names := make([]string, 0)
+	for name, c := range configs {
+		if _, ok := c.(Exporter); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export looks up registered top-level configuration by name and reads its
+// configuration from an instance of Vault.
+func Export(ctx context.Context, name string) (interface{}, error) {
+	configsM.RLock()
+	defer configsM.RUnlock()
+	c, ok := configs[name]
+	if !ok {
+		return nil, errors.Errorf("failed to find top-level configuration %s", name)
+	}
+	e, ok := c.(Exporter)
+	if !ok {
+		return nil, errors.Errorf("top-level configuration %s can't be exported", name)
+	}
+
+	entries, err := e.Export(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to export %s", name)
+	}
+	return entries, nil
+}
+
+// defaultInstance is the instance that entries not carrying an instance field
+// are applied to, the one configured by VAULT_ADDR when empty.
+var defaultInstance string
+
+// SetDefaultInstance makes Apply apply the entries not carrying an instance
+// field to a named Vault instance instead of the default one, e.g. when the
+// configuration of another instance is mirrored to it.
+func SetDefaultInstance(name string) {
+	defaultInstance = name
+}
+
 // Apply looks up registered top-level configuration by name and applies it an
 // instance of Vault.
-func Apply(name string, cfg []byte, dryRun bool) {
+//
+// Entries carrying an instance or a namespace field are applied separately, to
+// their Vault instance and inside of their Vault Enterprise namespace, so that
+// each instance and namespace is reconciled with the entries declared for it.
+// Other entries are applied in the root namespace of the instance set by
+// SetDefaultInstance. Namespaces left out by vault.SetNamespaceFilter are
+// skipped, and instances and namespaces aren't applied anymore once the
+// context is done. Applying a top-level is traced as a child of the span of
+// the context.
+func Apply(ctx context.Context, name string, cfg []byte, dryRun bool) (err error) {
+	ctx, span := tracing.Start(ctx, "apply "+name, tracing.KindInternal)
+	span.SetAttribute("vault_manager.toplevel", name)
+	span.SetAttribute("vault_manager.dry_run", dryRun)
+	defer func() { span.End(err) }()
+
 	configsM.RLock()
 	defer configsM.RUnlock()
 	c, ok := configs[name]
 	if !ok {
-		logrus.WithField("name", name).Fatal("failed to find top-level configuration")
+		return errors.Errorf("failed to find top-level configuration %s", name)
+	}
+
+	scopes, err := entryScopes(cfg)
+	if err != nil {
+		return errors.Wrapf(err, "failed to split configuration of %s by instance and namespace", name)
+	}
+	defer vault.SetInstance("")
+	defer vault.SetNamespace("")
+	for _, s := range scopes {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrapf(err, "failed to apply %s", name)
+		}
+		if !vault.NamespaceManaged(s.namespace) {
+			logrus.WithFields(logrus.Fields{
+				"name":      name,
+				"instance":  s.instance,
+				"namespace": s.namespace,
+			}).Debug("skipping configuration of a namespace left out by the namespace filter")
+			continue
+		}
+		if s.instance != "" || s.namespace != "" {
+			logrus.WithFields(logrus.Fields{
+				"name":      name,
+				"instance":  s.instance,
+				"namespace": s.namespace,
+			}).Info("applying configuration in instance and namespace")
+		}
+		instance := s.instance
+		if instance == "" {
+			instance = defaultInstance
+		}
+		vault.SetInstance(instance)
+		vault.SetNamespace(s.namespace)
+		if err := c.Apply(ctx, s.cfg, dryRun); err != nil {
+			return errors.Wrapf(err, "failed to apply %s%s", name, s)
+		}
+	}
+
+	Emit(Event{Type: BlockComplete, Name: name})
+	return nil
+}
+
+// scope is the configuration of a top-level applied in one namespace of an
+// instance.
+type scope struct {
+	instance  string
+	namespace string
+	cfg       []byte
+}
+
+// String describes where the scope is applied, for error messages.
+func (s scope) String() string {
+	var where string
+	if s.namespace != "" {
+		where += " in namespace " + s.namespace
+	}
+	if s.instance != "" {
+		where += " of instance " + s.instance
+	}
+	return where
+}
+
+// entryScopes splits a top-level configuration by the instance and namespace
+// of its entries, in the order they are first declared. Configurations that
+// aren't lists of entries, or whose entries don't declare instances nor
+// namespaces, are applied as is in the root namespace of the default instance.
+func entryScopes(cfg []byte) ([]scope, error) {
+	var entries []map[interface{}]interface{}
+	if err := yaml.Unmarshal(cfg, &entries); err != nil {
+		return []scope{{cfg: cfg}}, nil
+	}
+
+	type where struct{ instance, namespace string }
+	order := make([]where, 0)
+	grouped := make(map[where][]map[interface{}]interface{})
+	for _, e := range entries {
+		instance, _ := e[instanceKey].(string)
+		ns, _ := e[namespaceKey].(string)
+		w := where{instance: strings.TrimSpace(instance), namespace: strings.Trim(ns, "/")}
+		delete(e, instanceKey)
+		delete(e, namespaceKey)
+
+		if _, ok := grouped[w]; !ok {
+			order = append(order, w)
+		}
+		grouped[w] = append(grouped[w], e)
+	}
+	if len(order) <= 1 && len(grouped[where{}]) == len(entries) {
+		return []scope{{cfg: cfg}}, nil
+	}
+
+	scopes := make([]scope, 0, len(order))
+	for _, w := range order {
+		b, err := yaml.Marshal(grouped[w])
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope{instance: w.instance, namespace: w.namespace, cfg: b})
 	}
-	c.Apply(cfg, dryRun)
+	return scopes, nil
 }
@@ -0,0 +1,158 @@
+package toplevel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+)
+
+func TestEntryScopesKeepConfigurationsWithoutNamespaces(t *testing.T) {
+	for _, cfg := range []string{
+		"- name: a\n- name: b\n",
+		"key: value\n",
+	} {
+		scopes, err := entryScopes([]byte(cfg))
+		require.NoError(t, err)
+		require.Equal(t, []scope{{cfg: []byte(cfg)}}, scopes)
+	}
+}
+
+func TestEntryScopesSplitEntriesByNamespace(t *testing.T) {
+	cfg := "- name: a\n  namespace: team-a/\n- name: b\n- name: c\n  namespace: team-a\n"
+
+	scopes, err := entryScopes([]byte(cfg))
+	require.NoError(t, err)
+	require.Equal(t, []scope{
+		{namespace: "team-a", cfg: []byte("- name: a\n- name: c\n")},
+		{namespace: "", cfg: []byte("- name: b\n")},
+	}, scopes)
+}
+
+func TestEntryScopesSplitEntriesByInstance(t *testing.T) {
+	cfg := "- name: a\n  instance: dr\n- name: b\n  instance: dr\n  namespace: team-a\n- name: c\n"
+
+	scopes, err := entryScopes([]byte(cfg))
+	require.NoError(t, err)
+	require.Equal(t, []scope{
+		{instance: "dr", cfg: []byte("- name: a\n")},
+		{instance: "dr", namespace: "team-a", cfg: []byte("- name: b\n")},
+		{cfg: []byte("- name: c\n")},
+	}, scopes)
+}
+
+type exportedConfig struct{}
+
+func (exportedConfig) Apply(context.Context, []byte, bool) error { return nil }
+
+func (exportedConfig) Export(context.Context) (interface{}, error) {
+	return []string{"entry"}, nil
+}
+
+type appliedConfig struct{}
+
+func (appliedConfig) Apply(context.Context, []byte, bool) error { return nil }
+
+func TestExportOnlyExporters(t *testing.T) {
+	RegisterConfiguration("test_exported", exportedConfig{})
+	RegisterConfiguration("test_applied", appliedConfig{})
+
+	require.Contains(t, Exporters(), "test_exported")
+	require.NotContains(t, Exporters(), "test_applied")
+
+	entries, err := Export(context.Background(), "test_exported")
+	require.NoError(t, err)
+	require.Equal(t, []string{"entry"}, entries)
+
+	_, err = Export(context.Background(), "test_applied")
+	require.Error(t, err)
+}
+
+// recordingConfig records the instances and namespaces it's applied in.
+type recordingConfig struct {
+	scopes *[]string
+}
+
+func (c recordingConfig) Apply(context.Context, []byte, bool) error {
+	*c.scopes = append(*c.scopes, vault.ScopeKey(""))
+	return nil
+}
+
+func TestApplySkipsNamespacesLeftOutByTheFilter(t *testing.T) {
+	var applied []string
+	RegisterConfiguration("test_namespaced", recordingConfig{&applied})
+	defer vault.SetNamespaceFilter(nil)
+	cfg := []byte("- name: a\n  namespace: team-a\n- name: b\n  namespace: infra\n- name: c\n- name: d\n  namespace: team-b/dev\n")
+
+	vault.SetNamespaceFilter([]string{"team-*"})
+	require.NoError(t, Apply(context.Background(), "test_namespaced", cfg, true))
+	require.Equal(t, []string{"team-a", "team-b/dev"}, applied)
+
+	applied = nil
+	vault.SetNamespaceFilter([]string{"*"})
+	require.NoError(t, Apply(context.Background(), "test_namespaced", cfg, true))
+	require.Equal(t, []string{"team-a", "infra", "", "team-b/dev"}, applied, "* matches the root namespace")
+}
+
+func TestApplyUsesTheDefaultInstance(t *testing.T) {
+	var applied []string
+	RegisterConfiguration("test_mirrored", recordingConfig{&applied})
+	SetDefaultInstance("dr")
+	defer SetDefaultInstance("")
+
+	table := []struct {
+		description string
+		cfg         string
+		applied     []string
+	}{
+		{"no entries", "[]\n", []string{"dr:"}},
+		{"entries without instance", "- name: a\n- name: b\n  namespace: team-a\n", []string{"dr:", "dr:team-a"}},
+		{"entries with instance", "- name: a\n  instance: primary\n", []string{"primary:"}},
+		{"configuration that isn't a list", "enabled: true\n", []string{"dr:"}},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			applied = nil
+			require.NoError(t, Apply(context.Background(), "test_mirrored", []byte(tt.cfg), true))
+			require.Equal(t, tt.applied, applied)
+			require.Empty(t, vault.Instance(), "the instance must be reset once applied")
+		})
+	}
+}
+
+type validatedRole struct {
+	Name string `yaml:"name" validate:"required"`
+}
+
+type validatedEntry struct {
+	Path    string          `yaml:"_path" validate:"required"`
+	Enabled bool            `yaml:"enabled"`
+	Roles   []validatedRole `yaml:"roles"`
+}
+
+func TestValidateEntriesAcceptsValidEntries(t *testing.T) {
+	var entries []validatedEntry
+	err := ValidateEntries([]byte("- _path: a/\n  enabled: true\n  roles:\n  - name: r\n"), &entries)
+	require.NoError(t, err)
+	require.Equal(t, []validatedEntry{{Path: "a/", Enabled: true, Roles: []validatedRole{{Name: "r"}}}}, entries)
+}
+
+func TestValidateEntriesReportsEveryProblem(t *testing.T) {
+	var entries []validatedEntry
+	err := ValidateEntries([]byte("- _path: a/\n  enabeld: true\n- enabled: maybe\n  roles:\n  - {}\n"), &entries)
+	require.Equal(t, ValidationErrors{
+		errors.New("entry 1: unknown field enabeld"),
+		errors.New("entry 2: cannot unmarshal !!str `maybe` into bool"),
+		errors.New("entry 2: missing required field _path"),
+		errors.New("entry 2: missing required field roles[0].name"),
+	}.Error(), err.Error())
+}
+
+func TestValidateEntriesRequiresAList(t *testing.T) {
+	var entries []validatedEntry
+	require.EqualError(t, ValidateEntries([]byte("_path: a/\n"), &entries), "configuration must be a list of entries")
+}
@@ -0,0 +1,115 @@
+// Package totp implements the application of a declarative configuration
+// for the keys of Vault TOTP secrets engines.
+package totp
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// generateOnly lists the options only used when generating a key, which are
+// never returned by Vault.
+var generateOnly = []string{"exported", "key_size", "qr_size", "skew"}
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	Keys []key  `yaml:"keys"`
+}
+
+type key struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_totp", config{})
+}
+
+// Validate checks the totp configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the keys of TOTP secrets engines exist.
+//
+// Keys are generated by Vault and can't be updated, so existing keys are never
+// regenerated, which would replace their seed; their differences with the
+// configuration are only reported. Keys are never deleted.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode totp configuration")
+	}
+
+	toBeGenerated := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		for _, k := range e.Keys {
+			desired := endpoint.Entry{Path: path.Join(e.Path, "keys", k.Name), Data: k.Options, Sensitive: generateOnly}
+
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existing, ok, err := endpoint.Read(client, desired.Path)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				toBeGenerated = append(toBeGenerated, desired)
+				continue
+			}
+			if fields := desired.Differences(existing); len(fields) > 0 {
+				logrus.WithFields(logrus.Fields{
+					"path":   desired.Path,
+					"fields": strings.Join(fields, ","),
+				}).Warn("existing totp key differs from configuration but is not regenerated")
+			}
+		}
+	}
+
+	actions := make([]vault.Action, 0, len(toBeGenerated))
+	for _, k := range toBeGenerated {
+		k := k
+		actions = append(actions, vault.Action{
+			Name:       "generate",
+			Key:        k.Path,
+			Data:       k.DigestFields(),
+			Operations: []vault.Operation{vault.WriteOperation(k.Path, false)},
+			Perform:    func(client *api.Client) error { return generate(client, k) },
+		})
+	}
+	return vault.Act(ctx, "vault_totp", "totp", actions, dryRun)
+}
+
+// generate has Vault generate a key. The response holding the seed of the key
+// is discarded.
+func generate(client *api.Client, k endpoint.Entry) error {
+	data, _ := endpoint.Normalize(k.Data).(map[string]interface{})
+	data["generate"] = true
+
+	event := toplevel.Event{Name: "vault_totp", Key: k.Path, Operation: "generate"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(k.Path, data); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to generate totp key %s", k.Path)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", k.Path).Info("successfully generated totp key")
+	return nil
+}
@@ -0,0 +1,111 @@
+// Package transform implements the application of a declarative configuration
+// for Vault Enterprise transform secrets engines.
+package transform
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+type entry struct {
+	Path            string   `yaml:"_path" validate:"required"`
+	Alphabets       []object `yaml:"alphabets"`
+	Templates       []object `yaml:"templates"`
+	Transformations []object `yaml:"transformations"`
+	Roles           []object `yaml:"roles"`
+}
+
+type object struct {
+	Name    string                 `yaml:"name" validate:"required"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// collections returns the objects of the secrets engine by the path they are
+// written under, ordered so that objects are written after the ones they
+// refer to.
+func (e entry) collections() []collection {
+	return []collection{
+		{"alphabet", e.Alphabets},
+		{"template", e.Templates},
+		{"transformation", e.Transformations},
+		{"role", e.Roles},
+	}
+}
+
+type collection struct {
+	dir     string
+	objects []object
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_transform", config{})
+}
+
+// Validate checks the transform configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the alphabets, templates, transformations and roles of
+// transform secrets engines are configured exactly as provided.
+//
+// The transform secrets engine is only available in Vault Enterprise, so
+// nothing is applied to other Vault instances.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode transform configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := vault.Version(client)
+	if err != nil {
+		return err
+	}
+	if !vault.IsEnterprise(version) {
+		logrus.WithField("version", version).Warn("skipping transform configuration on a Vault instance that isn't Enterprise")
+		return nil
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		collections := e.collections()
+		for _, c := range collections {
+			for _, o := range c.objects {
+				desired = append(desired, endpoint.Entry{Path: path.Join(e.Path, c.dir, o.Name), Data: o.Options})
+			}
+		}
+		// objects are deleted before the ones they refer to
+		for i := len(collections) - 1; i >= 0; i-- {
+			client, err := vault.ClientFromEnv(ctx)
+			if err != nil {
+				return err
+			}
+			existingObjects, err := endpoint.ReadAll(client, path.Join(e.Path, collections[i].dir))
+			if err != nil {
+				return err
+			}
+			existing = append(existing, existingObjects...)
+		}
+	}
+
+	return endpoint.Apply(ctx, "vault_transform", desired, existing, dryRun)
+}
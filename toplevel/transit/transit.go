@@ -0,0 +1,147 @@
+// Package transit implements the application of a declarative configuration
+// for the keys of Vault transit secrets engines.
+package transit
+
+import (
+	"context"
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+type entry struct {
+	Path string `yaml:"_path" validate:"required"`
+	Keys []key  `yaml:"keys"`
+}
+
+type key struct {
+	Name string `yaml:"name" validate:"required"`
+	Type string `yaml:"type"`
+	// Config holds the settings written to the config endpoint of the key,
+	// e.g. exportable, allow_plaintext_backup, min_decryption_version,
+	// auto_rotate_period and deletion_allowed.
+	Config map[string]interface{} `yaml:"config"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_transit", config{})
+}
+
+// Validate checks the transit configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the keys of transit secrets engines exist and are
+// configured as provided.
+//
+// Keys are never deleted nor recreated, as this would make the data they
+// encrypted unrecoverable.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode transit configuration")
+	}
+
+	client, err := vault.ClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	desired, existing, toBeCreated, err := keyEntries(client, entries)
+	if err != nil {
+		return err
+	}
+
+	actions := make([]vault.Action, 0, len(toBeCreated))
+	for _, k := range toBeCreated {
+		k := k
+		actions = append(actions, vault.Action{
+			Name:       "create",
+			Key:        k.path,
+			Data:       map[string]interface{}{"type": k.keyType},
+			Operations: []vault.Operation{vault.WriteOperation(k.path, false)},
+			Perform:    func(client *api.Client) error { return create(client, k.path, k.keyType) },
+		})
+	}
+	if err := vault.Act(ctx, "vault_transit", "transit", actions, dryRun); err != nil {
+		return err
+	}
+
+	return endpoint.Apply(ctx, "vault_transit", desired, existing, dryRun)
+}
+
+// newKey is a declared key missing from Vault.
+type newKey struct {
+	path    string
+	keyType string
+}
+
+// keyEntries returns the desired and existing config of the declared keys, and
+// the keys to be created.
+//
+// The config of an existing key is only compared when the key declares one,
+// as the config endpoint of a key can't be deleted.
+func keyEntries(client *api.Client, entries []entry) (desired, existing []endpoint.Entry, toBeCreated []newKey, err error) {
+	desired = make([]endpoint.Entry, 0)
+	existing = make([]endpoint.Entry, 0)
+	toBeCreated = make([]newKey, 0)
+	for _, e := range entries {
+		for _, k := range e.Keys {
+			keyPath := path.Join(e.Path, "keys", k.Name)
+			if k.Config != nil {
+				desired = append(desired, endpoint.Entry{Path: path.Join(keyPath, "config"), Data: k.Config})
+			}
+
+			existingKey, ok, err := endpoint.Read(client, keyPath)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if !ok {
+				toBeCreated = append(toBeCreated, newKey{path: keyPath, keyType: k.Type})
+				continue
+			}
+			if existingType, _ := existingKey.Data["type"].(string); k.Type != "" && k.Type != existingType {
+				logrus.WithFields(logrus.Fields{
+					"path":     keyPath,
+					"type":     k.Type,
+					"existing": existingType,
+				}).Warn("type of existing transit key differs from configuration but can't be changed")
+			}
+			if k.Config != nil {
+				existingKey.Path = path.Join(keyPath, "config")
+				existing = append(existing, existingKey)
+			}
+		}
+	}
+	return desired, existing, toBeCreated, nil
+}
+
+func create(client *api.Client, p, keyType string) error {
+	data := map[string]interface{}{}
+	if keyType != "" {
+		data["type"] = keyType
+	}
+
+	event := toplevel.Event{Name: "vault_transit", Key: p, Operation: "create"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(p, data); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to create transit key %s", p)
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", p).WithField("type", keyType).Info("successfully created transit key")
+	return nil
+}
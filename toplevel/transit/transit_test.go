@@ -0,0 +1,84 @@
+package transit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+func TestKeyEntries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/transit/keys/app", "/v1/transit/keys/db":
+			fmt.Fprint(w, `{"data": {"type": "aes256-gcm96", "exportable": false, "deletion_allowed": false, "latest_version": 3}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	table := []struct {
+		description string
+		key         key
+		desired     []endpoint.Entry
+		existing    int
+		toBeCreated []newKey
+	}{
+		{
+			description: "existing key without config",
+			key:         key{Name: "app"},
+			desired:     []endpoint.Entry{},
+			existing:    0,
+			toBeCreated: []newKey{},
+		},
+		{
+			description: "existing key with config",
+			key:         key{Name: "db", Config: map[string]interface{}{"deletion_allowed": false}},
+			desired:     []endpoint.Entry{{Path: "transit/keys/db/config", Data: map[string]interface{}{"deletion_allowed": false}}},
+			existing:    1,
+			toBeCreated: []newKey{},
+		},
+		{
+			description: "missing key",
+			key:         key{Name: "new", Type: "rsa-4096", Config: map[string]interface{}{"exportable": true}},
+			desired:     []endpoint.Entry{{Path: "transit/keys/new/config", Data: map[string]interface{}{"exportable": true}}},
+			existing:    0,
+			toBeCreated: []newKey{{path: "transit/keys/new", keyType: "rsa-4096"}},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.description, func(t *testing.T) {
+			desired, existing, toBeCreated, err := keyEntries(client, []entry{{Path: "transit/", Keys: []key{tt.key}}})
+			require.NoError(t, err)
+			require.Equal(t, tt.desired, desired)
+			require.Len(t, existing, tt.existing)
+			require.Equal(t, tt.toBeCreated, toBeCreated)
+
+			toBeWritten, toBeDeleted := vault.DiffItems(asItems(desired), asItems(existing))
+			require.Empty(t, toBeDeleted, "the config of a key can't be deleted")
+			if tt.existing > 0 {
+				require.Empty(t, toBeWritten)
+			}
+		})
+	}
+}
+
+func asItems(entries []endpoint.Entry) []vault.Item {
+	items := make([]vault.Item, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, e)
+	}
+	return items
+}
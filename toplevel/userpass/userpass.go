@@ -0,0 +1,140 @@
+// Package userpass implements the application of a declarative configuration
+// for the users of Vault userpass auth methods.
+package userpass
+
+import (
+	"context"
+	"path"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/app-sre/vault-manager/pkg/vault"
+	"github.com/app-sre/vault-manager/toplevel"
+	"github.com/app-sre/vault-manager/toplevel/endpoint"
+)
+
+// passwordKey is the write-only setting of users holding their password.
+const passwordKey = "password"
+
+type entry struct {
+	Path  string `yaml:"_path" validate:"required"`
+	Users []user `yaml:"users"`
+}
+
+type user struct {
+	Name string `yaml:"name" validate:"required"`
+	// Password is only set when the user is created, or on every apply while
+	// RotatePassword is true, so that users may change their own passwords.
+	// It's usually a referenced secret.
+	Password       string                 `yaml:"password"`
+	RotatePassword bool                   `yaml:"rotate_password"`
+	Options        map[string]interface{} `yaml:"options"`
+}
+
+type config struct{}
+
+var _ toplevel.Configuration = config{}
+var _ toplevel.Validator = config{}
+
+func init() {
+	toplevel.RegisterConfiguration("vault_userpass_auth", config{})
+}
+
+// Validate checks the userpass users configuration without contacting Vault.
+func (c config) Validate(entriesBytes []byte) error {
+	var entries []entry
+	return toplevel.ValidateEntries(entriesBytes, &entries)
+}
+
+// Apply ensures that the users of userpass auth methods are configured exactly
+// as provided, without overwriting the passwords of existing users unless they
+// are rotated.
+//
+// Users of a declared auth method that are missing from the configuration are
+// deleted; auth methods that aren't declared are left untouched.
+func (c config) Apply(ctx context.Context, entriesBytes []byte, dryRun bool) error {
+	var entries []entry
+	if err := yaml.Unmarshal(entriesBytes, &entries); err != nil {
+		return errors.Wrap(err, "failed to decode userpass users configuration")
+	}
+
+	desired := make([]endpoint.Entry, 0)
+	existing := make([]endpoint.Entry, 0)
+	toBeRotated := make([]endpoint.Entry, 0)
+	for _, e := range entries {
+		dir := path.Join("auth", e.Path, "users")
+		client, err := vault.ClientFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		existingUsers, err := endpoint.ReadAll(client, dir)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingUsers...)
+
+		for _, u := range e.Users {
+			p := path.Join(dir, u.Name)
+			data := make(map[string]interface{}, len(u.Options)+1)
+			for k, v := range u.Options {
+				data[k] = v
+			}
+
+			switch {
+			case !exists(existingUsers, p):
+				data[passwordKey] = u.Password
+			case u.RotatePassword:
+				toBeRotated = append(toBeRotated, endpoint.Entry{
+					Path:      path.Join(p, passwordKey),
+					Data:      map[string]interface{}{passwordKey: u.Password},
+					Sensitive: []string{passwordKey},
+				})
+			}
+			desired = append(desired, endpoint.Entry{Path: p, Data: data, Sensitive: []string{passwordKey}})
+		}
+	}
+
+	if err := endpoint.Apply(ctx, "vault_userpass_auth", desired, existing, dryRun); err != nil {
+		return err
+	}
+
+	// Passwords are never planned, only the users whose password is rotated.
+	actions := make([]vault.Action, 0, len(toBeRotated))
+	for _, r := range toBeRotated {
+		r := r
+		if _, err := endpoint.ResolveReferences(r.Data); err != nil {
+			return errors.Wrapf(err, "failed to resolve referenced values of %s", r.Path)
+		}
+		actions = append(actions, vault.Action{
+			Name:       "rotate password",
+			Key:        path.Dir(r.Path),
+			Operations: []vault.Operation{vault.WriteOperation(r.Path, false)},
+			Perform:    func(client *api.Client) error { return rotate(client, r) },
+		})
+	}
+	return vault.Act(ctx, "vault_userpass_auth", "userpass", actions, dryRun)
+}
+
+func exists(entries []endpoint.Entry, p string) bool {
+	for _, e := range entries {
+		if vault.EqualPathNames(e.Path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func rotate(client *api.Client, e endpoint.Entry) error {
+	event := toplevel.Event{Name: "vault_userpass_auth", Key: path.Dir(e.Path), Operation: "rotate"}
+	toplevel.Emit(event.WithType(toplevel.ItemStarted))
+	if _, err := client.Logical().Write(e.Path, e.Data); err != nil {
+		toplevel.Emit(event.WithError(err))
+		return errors.Wrapf(err, "failed to rotate password of user %s", path.Dir(e.Path))
+	}
+	toplevel.Emit(event.WithType(toplevel.ItemSucceeded))
+	logrus.WithField("path", path.Dir(e.Path)).Info("successfully rotated password of user")
+	return nil
+}
@@ -0,0 +1,198 @@
+package toplevel
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Validator is a Configuration able to check a configuration without
+// contacting Vault.
+//
+// Validate returns ValidationErrors listing every problem found.
+type Validator interface {
+	Validate([]byte) error
+}
+
+// ValidationErrors are the problems found in a configuration.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate looks up registered top-level configuration by name and checks a
+// configuration of it without contacting Vault.
+//
+// Configurations that aren't Validators are only checked to be registered.
+func Validate(name string, cfg []byte) error {
+	configsM.RLock()
+	defer configsM.RUnlock()
+	c, ok := configs[name]
+	if !ok {
+		return errors.Errorf("unknown top-level configuration %s", name)
+	}
+	v, ok := c.(Validator)
+	if !ok {
+		return nil
+	}
+
+	return v.Validate(withoutScopes(cfg))
+}
+
+// withoutScopes removes the instance and namespace fields from the entries of
+// a configuration, keeping them in the order they are declared in.
+func withoutScopes(cfg []byte) []byte {
+	var entries []map[interface{}]interface{}
+	if err := yaml.Unmarshal(cfg, &entries); err != nil {
+		return cfg
+	}
+
+	for _, e := range entries {
+		delete(e, instanceKey)
+		delete(e, namespaceKey)
+	}
+	b, err := yaml.Marshal(entries)
+	if err != nil {
+		return cfg
+	}
+	return b
+}
+
+// ValidateEntries decodes a configuration into entries, a pointer to either a
+// slice of entries or a single value, reporting every unknown field, value of
+// the wrong type and missing required field. Fields tagged with
+// `validate:"required"` are required.
+func ValidateEntries(cfg []byte, entries interface{}) error {
+	v := reflect.ValueOf(entries).Elem()
+	if v.Kind() != reflect.Slice {
+		errs := decodeErrors(cfg, entries, "")
+		for _, field := range missingFields(v, "") {
+			errs = append(errs, errors.Errorf("missing required field %s", field))
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		return nil
+	}
+
+	var items []interface{}
+	if err := yaml.Unmarshal(cfg, &items); err != nil {
+		return ValidationErrors{errors.New("configuration must be a list of entries")}
+	}
+
+	var errs ValidationErrors
+	for i, item := range items {
+		b, err := yaml.Marshal(item)
+		if err != nil {
+			return errors.Wrap(err, "failed to remarshal entry")
+		}
+
+		label := fmt.Sprintf("entry %d: ", i+1)
+		e := reflect.New(v.Type().Elem())
+		errs = append(errs, decodeErrors(b, e.Interface(), label)...)
+		for _, field := range missingFields(e.Elem(), "") {
+			errs = append(errs, errors.Errorf("%smissing required field %s", label, field))
+		}
+		v.Set(reflect.Append(v, e.Elem()))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+var (
+	// decodeLine prefixes the errors of the YAML decoder, whose line numbers
+	// are those of the remarshaled entry.
+	decodeLine = regexp.MustCompile(`^line \d+: `)
+	// unknownField is the error of the YAML decoder for fields missing from
+	// the decoded type.
+	unknownField = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// decodeErrors strictly decodes a configuration, returning the errors of the
+// decoder prefixed with the label.
+func decodeErrors(cfg []byte, out interface{}, label string) ValidationErrors {
+	err := yaml.UnmarshalStrict(cfg, out)
+	if err == nil {
+		return nil
+	}
+
+	typeErr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return ValidationErrors{errors.Errorf("%s%s", label, strings.TrimPrefix(err.Error(), "yaml: "))}
+	}
+	errs := make(ValidationErrors, 0, len(typeErr.Errors))
+	for _, msg := range typeErr.Errors {
+		msg = decodeLine.ReplaceAllString(msg, "")
+		msg = unknownField.ReplaceAllString(msg, "unknown field $1")
+		errs = append(errs, errors.Errorf("%s%s", label, msg))
+	}
+	return errs
+}
+
+// missingFields returns the names of the required fields of a value, nested or
+// not, that aren't set.
+func missingFields(v reflect.Value, prefix string) []string {
+	var missing []string
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			missing = missingFields(v.Elem(), prefix)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			missing = append(missing, missingFields(v.Index(i), fmt.Sprintf("%s[%d]", prefix, i))...)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			tag := strings.Split(f.Tag.Get("yaml"), ",")
+			if tag[0] == "-" {
+				continue
+			}
+
+			name := prefix
+			if !contains(tag[1:], "inline") {
+				if tag[0] == "" {
+					tag[0] = strings.ToLower(f.Name)
+				}
+				if name != "" {
+					name += "."
+				}
+				name += tag[0]
+			}
+
+			field := v.Field(i)
+			if f.Tag.Get("validate") == "required" &&
+				reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+				missing = append(missing, name)
+				continue
+			}
+			missing = append(missing, missingFields(field, name)...)
+		}
+	}
+	return missing
+}
+
+func contains(xs []string, x string) bool {
+	for _, s := range xs {
+		if s == x {
+			return true
+		}
+	}
+	return false
+}